@@ -5,15 +5,29 @@ import (
 	"database/sql"
 	"log"
 	"net/http"
+	"net/url"
 	"os"
+	"strconv"
 	"strings"
 	"time"
 
+	"auth-user-service/internal/admin"
+	"auth-user-service/internal/audit"
 	"auth-user-service/internal/auth"
 	"auth-user-service/internal/database"
+	"auth-user-service/internal/notify"
+	"auth-user-service/internal/oidc"
 	"auth-user-service/internal/order"
+	"auth-user-service/internal/password"
+	"auth-user-service/internal/privacy"
+	"auth-user-service/internal/ratelimit"
+	"auth-user-service/internal/rbac"
 	"auth-user-service/internal/redis"
+	"auth-user-service/internal/sms"
+	"auth-user-service/internal/social"
+	"auth-user-service/internal/token"
 	"auth-user-service/internal/user"
+	"auth-user-service/internal/webauthn"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
@@ -65,17 +79,172 @@ func main() {
 
 	// Инициализация сервисов
 	authRepo := auth.NewRepository(db)
-	authService := auth.NewService(authRepo, getEnv("JWT_SECRET", "fallback-secret-key"))
-	authHandler := auth.NewHandler(authService)
+	accessTTL := getDurationEnv("ACCESS_TOKEN_TTL", 15*time.Minute)
+	jwtLeeway := getDurationEnv("JWT_LEEWAY", 30*time.Second)
+	keyRing := loadKeyRing(getEnv("APP_ENV", "production"), accessTTL+jwtLeeway)
+	tokenIssuer := token.NewIssuer(keyRing, token.Config{
+		Issuer:    getEnv("JWT_ISSUER", "auth-user-service"),
+		Audience:  getListEnv("JWT_AUDIENCE"),
+		AccessTTL: accessTTL,
+		Leeway:    jwtLeeway,
+	})
+	revocationStore := auth.NewRevocationStore(redisClient)
+	loginAttempts := auth.NewLoginAttemptStore(redisClient)
+	notifier := notify.NewLogNotifier()
+	frontendURL := strings.TrimSuffix(getEnv("FRONTEND_URL", "http://localhost:3000"), "/")
+	socialLogin := social.NewClient(
+		loadSocialProviders(getListEnv("SOCIAL_PROVIDERS"), frontendURL),
+		social.NewStateStore(redisClient),
+		getDurationEnv("SOCIAL_LOGIN_STATE_TTL", 10*time.Minute),
+	)
+
+	// Passkeys привязаны к домену сайта: по умолчанию это домен FRONTEND_URL
+	webauthnOrigins := getListEnv("WEBAUTHN_ORIGINS")
+	if len(webauthnOrigins) == 0 {
+		webauthnOrigins = []string{frontendURL}
+	}
+	rpID := getEnv("WEBAUTHN_RP_ID", "")
+	if rpID == "" {
+		if frontend, err := url.Parse(frontendURL); err == nil {
+			rpID = frontend.Hostname()
+		}
+	}
+	passkeys := webauthn.NewRelyingParty(webauthn.Config{
+		RPID:             rpID,
+		RPName:           getEnv("WEBAUTHN_RP_NAME", "auth-user-service"),
+		Origins:          webauthnOrigins,
+		Timeout:          getDurationEnv("WEBAUTHN_TIMEOUT", 5*time.Minute),
+		UserVerification: getEnv("WEBAUTHN_USER_VERIFICATION", "preferred"),
+	}, webauthn.NewSessionStore(redisClient))
+
+	// Коды из SMS. Пока провайдер не подключен, SMS пишутся в лог или в файл (SMS_SENDER=file)
+	rateLimitStore := ratelimit.NewStore(redisClient)
+	phoneOTP := sms.NewOTP(loadSMSSender(getEnv("SMS_SENDER", "log")), sms.NewCodeStore(redisClient), rateLimitStore, sms.Config{
+		CodeTTL:        getDurationEnv("PHONE_OTP_TTL", 5*time.Minute),
+		MaxAttempts:    getIntEnv("PHONE_OTP_MAX_ATTEMPTS", 5),
+		ResendInterval: getDurationEnv("PHONE_OTP_RESEND_INTERVAL", time.Minute),
+		SendRate:       getRateEnv("RATE_LIMIT_PHONE_OTP_PER_PHONE", ratelimit.Rate{Limit: 5, Window: time.Hour}),
+	})
+
+	rbacRepo := rbac.NewRepository(db)
+	rbacService := rbac.NewService(rbacRepo)
+
+	passwordHasher, err := password.NewHasher(password.Config{
+		Algorithm: getEnv("PASSWORD_HASH_ALGORITHM", password.AlgorithmArgon2id),
+		Argon2: password.Argon2Params{
+			Memory:      uint32(getIntEnv("ARGON2_MEMORY_KIB", int(password.DefaultArgon2Params.Memory))),
+			Iterations:  uint32(getIntEnv("ARGON2_ITERATIONS", int(password.DefaultArgon2Params.Iterations))),
+			Parallelism: uint8(getIntEnv("ARGON2_PARALLELISM", int(password.DefaultArgon2Params.Parallelism))),
+			SaltLength:  password.DefaultArgon2Params.SaltLength,
+			KeyLength:   password.DefaultArgon2Params.KeyLength,
+		},
+		BcryptCost: getIntEnv("BCRYPT_COST", 0),
+	})
+	if err != nil {
+		log.Fatalf("❌ Invalid password hashing config: %v", err)
+	}
+
+	passwordPolicy := password.NewPolicy(password.PolicyConfig{
+		MinLength:   getIntEnv("PASSWORD_MIN_LENGTH", 10),
+		MaxLength:   getIntEnv("PASSWORD_MAX_LENGTH", 128),
+		MinStrength: getIntEnv("PASSWORD_MIN_STRENGTH", 2),
+		ForbidEmail: getBoolEnv("PASSWORD_FORBID_EMAIL", true),
+	}, loadBreachedList(getEnv("BREACHED_PASSWORDS_PATH", "")))
+
+	// Журнал безопасности: входы, смена учётных данных, действия администраторов
+	auditService := audit.NewService(audit.NewRepository(db))
+	auditHandler := audit.NewHandler(auditService)
+
+	authService := auth.NewService(authRepo, passwordHasher, passwordPolicy, tokenIssuer, revocationStore, loginAttempts, rbacService, socialLogin, passkeys, phoneOTP, notifier, auditService, auth.Config{
+		RefreshTokenTTL:      getDurationEnv("REFRESH_TOKEN_TTL", 30*24*time.Hour),
+		PasswordResetTTL:     getDurationEnv("PASSWORD_RESET_TTL", time.Hour),
+		EmailVerificationTTL: getDurationEnv("EMAIL_VERIFICATION_TTL", 48*time.Hour),
+		EmailChangeTTL:       getDurationEnv("EMAIL_CHANGE_TTL", 24*time.Hour),
+		MagicLinkTTL:         getDurationEnv("MAGIC_LINK_TTL", 15*time.Minute),
+		DeletionConfirmTTL:   getDurationEnv("ACCOUNT_DELETION_CONFIRM_TTL", time.Hour),
+		Verification: auth.VerificationPolicy{
+			RequireForLogin:  getBoolEnv("REQUIRE_VERIFIED_EMAIL_FOR_LOGIN", false),
+			RequireForOrders: getBoolEnv("REQUIRE_VERIFIED_EMAIL_FOR_ORDERS", false),
+		},
+		MFAChallengeTTL: getDurationEnv("MFA_CHALLENGE_TTL", 5*time.Minute),
+		MFAMaxAttempts:  getIntEnv("MFA_MAX_ATTEMPTS", 5),
+		TOTPIssuer:      getEnv("TOTP_ISSUER", "auth-user-service"),
+		FrontendURL:     frontendURL,
+		NotifyNewDevice: getBoolEnv("NOTIFY_NEW_DEVICE_LOGIN", true),
+		Lockout: auth.LockoutPolicy{
+			MaxAccountFailures: getIntEnv("LOGIN_MAX_ACCOUNT_FAILURES", 5),
+			MaxIPFailures:      getIntEnv("LOGIN_MAX_IP_FAILURES", 50),
+			FailureWindow:      getDurationEnv("LOGIN_FAILURE_WINDOW", 15*time.Minute),
+			BaseLockout:        getDurationEnv("LOGIN_LOCKOUT_BASE", 30*time.Second),
+			MaxLockout:         getDurationEnv("LOGIN_LOCKOUT_MAX", 15*time.Minute),
+		},
+		MagicLinkAutoRegister: getBoolEnv("MAGIC_LINK_AUTO_REGISTER", false),
+		PasswordResetCooldown: getDurationEnv("PASSWORD_RESET_COOLDOWN", 5*time.Minute),
+		Cookies: auth.CookiePolicy{
+			Enabled:  getBoolEnv("AUTH_COOKIE_MODE", false),
+			Domain:   getEnv("AUTH_COOKIE_DOMAIN", ""),
+			Secure:   getBoolEnv("AUTH_COOKIE_SECURE", true),
+			SameSite: getSameSiteEnv("AUTH_COOKIE_SAMESITE", http.SameSiteLaxMode),
+			// С cookie CORS-ответ с credentials получает любой разрешённый origin,
+			// поэтому список должен быть явным и без масок
+			TrustedOrigins: getCookieTrustedOrigins(getBoolEnv("AUTH_COOKIE_MODE", false)),
+		},
+	})
 
 	userRepo := user.NewRepository(db)
 	userService := user.NewService(userRepo, redisClient)
 	userHandler := user.NewHandler(userService)
 
+	authHandler := auth.NewHandler(authService, userService, auditService)
+	rbacHandler := rbac.NewHandler(rbacService, authService, auditService)
+
+	bootstrapAdmin(authRepo, rbacService, getEnv("BOOTSTRAP_ADMIN_EMAIL", ""))
+
+	adminHandler := admin.NewHandler(userService, authService, rbacService, auditService)
+
 	orderRepo := order.NewRepository(db)
 	orderService := order.NewService(orderRepo)
 	orderHandler := order.NewHandler(orderService)
 
+	// Выгрузка данных и удаление аккаунта по запросу пользователя (GDPR, 152-ФЗ)
+	privacyService := privacy.NewService(userService, orderService, authService, auditService, privacy.Config{
+		GracePeriod: getDurationEnv("ACCOUNT_DELETION_GRACE_PERIOD", 30*24*time.Hour),
+	})
+	privacyHandler := privacy.NewHandler(privacyService, auditService)
+	if interval := getDurationEnv("ACCOUNT_DELETION_PURGE_INTERVAL", time.Hour); interval > 0 {
+		go privacy.RunPurge(privacyService, interval)
+	}
+
+	// OpenID Connect провайдер для собственных приложений. ID token подписывается
+	// асимметричным ключом, иначе клиенты не смогут проверить его по JWKS
+	var oidcHandler *oidc.Handler
+	if issuerURL := strings.TrimSuffix(getEnv("OIDC_ISSUER_URL", ""), "/"); issuerURL != "" {
+		if !keyRing.Asymmetric() {
+			log.Println("⚠️ OIDC provider disabled: ID tokens require an RSA/EC/Ed25519 signing key (JWT_SIGNING_KEY_FILES)")
+		} else {
+			oidcService := oidc.NewService(oidc.NewRepository(db), oidc.NewCodeStore(redisClient), keyRing, oidc.Config{
+				Issuer:     issuerURL,
+				CodeTTL:    getDurationEnv("OIDC_CODE_TTL", time.Minute),
+				IDTokenTTL: getDurationEnv("OIDC_ID_TOKEN_TTL", time.Hour),
+			})
+			oidcHandler = oidc.NewHandler(oidcService, authService, userService, keyRing, auditService)
+			log.Printf("🔐 OIDC provider enabled, issuer %s", issuerURL)
+		}
+	}
+
+	// Лимиты запросов: "<количество>/<окно>", "0" отключает
+	limiter := ratelimit.NewLimiter(rateLimitStore)
+	registerRate := getRateEnv("RATE_LIMIT_REGISTER", ratelimit.Rate{Limit: 5, Window: time.Hour})
+	passwordForgotRate := getRateEnv("RATE_LIMIT_PASSWORD_FORGOT", ratelimit.Rate{Limit: 5, Window: time.Hour})
+	createOrderRate := getRateEnv("RATE_LIMIT_CREATE_ORDER", ratelimit.Rate{Limit: 30, Window: time.Hour})
+	magicLinkRate := getRateEnv("RATE_LIMIT_MAGIC_LINK", ratelimit.Rate{Limit: 10, Window: time.Hour})
+	phoneOTPRate := getRateEnv("RATE_LIMIT_PHONE_OTP", ratelimit.Rate{Limit: 10, Window: time.Hour})
+	dataExportRate := getRateEnv("RATE_LIMIT_DATA_EXPORT", ratelimit.Rate{Limit: 5, Window: time.Hour})
+	phoneLoginRate := getRateEnv("RATE_LIMIT_PHONE_LOGIN", ratelimit.Rate{Limit: 30, Window: time.Hour})
+	mfaVerifyRate := getRateEnv("RATE_LIMIT_MFA_VERIFY", ratelimit.Rate{Limit: 30, Window: time.Hour})
+	passwordConfirmRate := getRateEnv("RATE_LIMIT_PASSWORD_CONFIRM", ratelimit.Rate{Limit: 10, Window: time.Hour})
+	webhookRate := getRateEnv("RATE_LIMIT_TILDA_WEBHOOK", ratelimit.Rate{Limit: 120, Window: time.Minute})
+
 	// Роутер
 	r := chi.NewRouter()
 
@@ -84,24 +253,86 @@ func main() {
 		// Разрешаем основные домены Tilda + локальная разработка
 		AllowedOrigins:   getCORSAllowedOrigins(),
 		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS", "PATCH"},
-		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token", "X-Requested-With", "Origin", "Cache-Control"},
+		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token", "X-API-Key", "X-Auth-Mode", "X-Requested-With", "Origin", "Cache-Control"},
 		ExposedHeaders:   []string{"Link", "Content-Length", "X-Total-Count"},
 		AllowCredentials: true, // Важно для работы с куками/сессиями
 		MaxAge:           300,
 	}))
 
 	// Базовые middleware
+	r.Use(middleware.RequestID)
 	r.Use(middleware.Logger)
 	r.Use(middleware.Recoverer)
 	r.Use(middleware.RealIP)
 
 	// Public routes
-	r.Post("/auth/register", authHandler.Register)
+	r.With(limiter.Limit("register", registerRate, ratelimit.ByIP)).Post("/auth/register", authHandler.Register)
 	r.Post("/auth/login", authHandler.Login)
+	r.With(authHandler.CSRFMiddleware).Post("/auth/refresh", authHandler.Refresh)
+	r.Get("/auth/csrf", authHandler.CSRFToken)
+	r.With(limiter.Limit("password_forgot", passwordForgotRate, ratelimit.ByIP)).Post("/auth/password/forgot", authHandler.ForgotPassword)
+	r.Post("/auth/password/reset", authHandler.ResetPassword)
+	r.Get("/auth/verify-email", authHandler.VerifyEmail)
+	r.Post("/auth/verify-email", authHandler.VerifyEmail)
+	r.Post("/auth/verify-email/resend", authHandler.ResendVerification)
+	r.Get("/auth/email/confirm", authHandler.ConfirmEmailChange)
+	r.Post("/auth/email/confirm", authHandler.ConfirmEmailChange)
+	r.With(limiter.Limit("mfa_verify", mfaVerifyRate, ratelimit.ByIP)).Post("/auth/2fa/verify", authHandler.VerifyMFA)
+	r.With(limiter.Limit("magic_link", magicLinkRate, ratelimit.ByIP)).Post("/auth/magic-link", authHandler.RequestMagicLink)
+	r.Get("/auth/magic-link/consume", authHandler.ConsumeMagicLink)
+	r.Get("/auth/oauth/providers", authHandler.SocialProviders)
+	r.Get("/auth/oauth/{provider}", authHandler.StartSocialLogin)
+	r.Get("/auth/oauth/{provider}/callback", authHandler.SocialCallback)
+	r.Post("/auth/oauth/{provider}/callback", authHandler.SocialCallback)
+	r.With(limiter.Limit("phone_otp", phoneOTPRate, ratelimit.ByIP)).Post("/auth/phone/otp", authHandler.RequestPhoneLogin)
+	r.With(limiter.Limit("phone_login", phoneLoginRate, ratelimit.ByIP)).Post("/auth/phone/login", authHandler.PhoneLogin)
+	r.Post("/auth/webauthn/login/begin", authHandler.BeginPasskeyLogin)
+	r.Post("/auth/webauthn/login/finish", authHandler.FinishPasskeyLogin)
+	r.Post("/oauth/token", authHandler.ClientCredentialsToken)
+	r.Post("/oauth/introspect", authHandler.IntrospectToken)
+	r.Post("/oauth/revoke", authHandler.RevokeToken)
 
 	// Protected auth routes (требуют AuthMiddleware)
-	r.With(authHandler.AuthMiddleware).Post("/auth/refresh", authHandler.Refresh)
 	r.With(authHandler.AuthMiddleware).Post("/auth/logout", authHandler.Logout)
+	r.With(authHandler.AuthMiddleware).Post("/auth/logout-all", authHandler.LogoutAll)
+	r.With(authHandler.AuthMiddleware).Post("/auth/2fa/setup", authHandler.SetupTOTP)
+	r.With(authHandler.AuthMiddleware).Post("/auth/2fa/confirm", authHandler.ConfirmTOTP)
+	r.With(authHandler.AuthMiddleware, limiter.Limit("password_confirm", passwordConfirmRate, ratelimit.ByUser)).Post("/auth/2fa/disable", authHandler.DisableTOTP)
+	r.With(authHandler.AuthMiddleware).Post("/auth/webauthn/register/begin", authHandler.BeginPasskeyRegistration)
+	r.With(authHandler.AuthMiddleware).Post("/auth/webauthn/register/finish", authHandler.FinishPasskeyRegistration)
+
+	// Admin routes (доступ по правам ролей)
+	r.Route("/admin", func(r chi.Router) {
+		r.Use(authHandler.AuthMiddleware)
+
+		r.With(rbacHandler.RequirePermission("roles:assign")).Get("/roles", rbacHandler.ListRoles)
+		r.With(rbacHandler.RequirePermission("users:read")).Get("/users/{id}/roles", rbacHandler.GetUserRoles)
+		r.With(rbacHandler.RequirePermission("roles:assign")).Post("/users/{id}/roles", rbacHandler.AssignRole)
+		r.With(rbacHandler.RequirePermission("roles:assign")).Delete("/users/{id}/roles/{role}", rbacHandler.RevokeRole)
+		r.With(rbacHandler.RequirePermission("sessions:revoke")).Post("/users/{id}/revoke-sessions", adminHandler.RevokeSessions)
+
+		r.With(rbacHandler.RequirePermission("users:read")).Get("/users", adminHandler.ListUsers)
+		r.With(rbacHandler.RequirePermission("users:read")).Get("/users/{id}", adminHandler.GetUser)
+		r.With(rbacHandler.RequirePermission("users:write")).Post("/users/{id}/disable", adminHandler.DisableUser)
+		r.With(rbacHandler.RequirePermission("users:write")).Post("/users/{id}/enable", adminHandler.EnableUser)
+		r.With(rbacHandler.RequirePermission("users:write")).Post("/users/{id}/force-password-reset", adminHandler.ForcePasswordReset)
+		r.With(rbacHandler.RequirePermission("users:write")).Delete("/users/{id}", adminHandler.DeleteUser)
+
+		r.With(rbacHandler.RequirePermission("service_accounts:manage")).Post("/service-accounts", authHandler.CreateServiceAccount)
+		r.With(rbacHandler.RequirePermission("service_accounts:manage")).Get("/service-accounts", authHandler.ListServiceAccounts)
+		r.With(rbacHandler.RequirePermission("service_accounts:manage")).Post("/service-accounts/{id}/disable", authHandler.DisableServiceAccount)
+		r.With(rbacHandler.RequirePermission("service_accounts:manage")).Post("/service-accounts/{id}/keys", authHandler.CreateAPIKey)
+		r.With(rbacHandler.RequirePermission("service_accounts:manage")).Get("/service-accounts/{id}/keys", authHandler.ListAPIKeys)
+		r.With(rbacHandler.RequirePermission("service_accounts:manage")).Delete("/service-accounts/{id}/keys/{keyID}", authHandler.RevokeAPIKey)
+
+		r.With(rbacHandler.RequirePermission("audit:read")).Get("/audit", auditHandler.ListEvents)
+
+		if oidcHandler != nil {
+			r.With(rbacHandler.RequirePermission("clients:manage")).Post("/oauth/clients", oidcHandler.RegisterClient)
+			r.With(rbacHandler.RequirePermission("clients:manage")).Get("/oauth/clients", oidcHandler.ListClients)
+			r.With(rbacHandler.RequirePermission("clients:manage")).Delete("/oauth/clients/{id}", oidcHandler.DeleteClient)
+		}
+	})
 
 	// Protected API routes
 	r.Route("/api", func(r chi.Router) {
@@ -109,16 +340,39 @@ func main() {
 
 		r.Get("/user/profile", userHandler.GetProfile)
 		r.Put("/user/profile", userHandler.UpdateProfile)
+		passwordConfirm := r.With(limiter.Limit("password_confirm", passwordConfirmRate, ratelimit.ByUser))
+		passwordConfirm.Post("/user/password", authHandler.ChangePassword)
+		passwordConfirm.Post("/user/email", authHandler.ChangeEmail)
+		r.Get("/user/sessions", authHandler.ListSessions)
+		r.Delete("/user/sessions/{id}", authHandler.RevokeSession)
+		r.Get("/user/security-events", auditHandler.SecurityEvents)
+		r.Get("/user/identities", authHandler.ListIdentities)
+		r.Post("/user/identities/{provider}", authHandler.LinkIdentity)
+		r.Delete("/user/identities/{provider}", authHandler.UnlinkIdentity)
+		r.Get("/user/passkeys", authHandler.ListPasskeys)
+		r.Delete("/user/passkeys/{id}", authHandler.DeletePasskey)
+		r.Put("/user/passkeys/passkey-only", authHandler.SetPasskeyOnly)
+		r.With(limiter.Limit("phone_otp", phoneOTPRate, ratelimit.ByUser)).Post("/user/phone/verify", authHandler.SendPhoneVerification)
+		r.Post("/user/phone/confirm", authHandler.ConfirmPhone)
+		r.With(limiter.Limit("data_export", dataExportRate, ratelimit.ByUser)).Get("/user/export", privacyHandler.ExportData)
+		passwordConfirm.Post("/user/deletion", privacyHandler.RequestDeletion)
+		passwordConfirm.Post("/user/deletion/confirmation", privacyHandler.SendDeletionConfirmation)
+		r.Delete("/user/deletion", privacyHandler.CancelDeletion)
 
 		r.Get("/orders", orderHandler.GetUserOrders)
+		r.With(rbacHandler.RequirePermission("orders:read_all")).Get("/orders/all", orderHandler.GetAllOrders)
 		r.Get("/orders/{id}", orderHandler.GetOrder)
-		r.Post("/orders", orderHandler.CreateOrder)
+		createOrder := r.With(limiter.Limit("create_order", createOrderRate, ratelimit.ByUser))
+		if authService.VerificationPolicy().RequireForOrders {
+			createOrder = createOrder.With(authHandler.RequireVerifiedEmail)
+		}
+		createOrder.Post("/orders", orderHandler.CreateOrder)
 	})
 
 	// Специальные эндпоинты для Tilda
 	r.Route("/tilda", func(r chi.Router) {
 		// Webhook для Tilda
-		r.Post("/webhook", func(w http.ResponseWriter, r *http.Request) {
+		r.With(limiter.Limit("tilda_webhook", webhookRate, ratelimit.ByIP)).Post("/webhook", func(w http.ResponseWriter, r *http.Request) {
 			// Обработка вебхуков от Tilda
 			w.Header().Set("Content-Type", "application/json")
 			w.WriteHeader(http.StatusOK)
@@ -138,6 +392,19 @@ func main() {
 		})
 	})
 
+	// Публичные ключи для проверки токенов другими сервисами
+	r.Get("/.well-known/jwks.json", keyRing.JWKSHandler)
+
+	// OpenID Connect: discovery, вход, обмен кода на токены и userinfo
+	if oidcHandler != nil {
+		r.Get("/.well-known/openid-configuration", oidcHandler.Discovery)
+		r.Get("/authorize", oidcHandler.Authorize)
+		r.Post("/authorize", oidcHandler.Authorize)
+		r.Post("/token", oidcHandler.Token)
+		r.Get("/userinfo", oidcHandler.UserInfo)
+		r.Post("/userinfo", oidcHandler.UserInfo)
+	}
+
 	// Health check
 	r.Get("/health", func(w http.ResponseWriter, r *http.Request) {
 		// Проверяем PostgreSQL
@@ -185,6 +452,252 @@ func getEnv(key, defaultValue string) string {
 	return defaultValue
 }
 
+// loadBreachedList загружает список паролей из утечек. Без него политика
+// проверяет только длину, стойкость и email
+func loadBreachedList(path string) password.BreachedList {
+	if path == "" {
+		log.Println("⚠️ BREACHED_PASSWORDS_PATH is not set: breached password check is disabled")
+		return nil
+	}
+
+	list, err := password.LoadBreachedList(path)
+	if err != nil {
+		log.Fatalf("❌ Failed to load breached passwords from %s: %v", path, err)
+	}
+	log.Printf("✅ Breached password list loaded from %s", path)
+	return list
+}
+
+// loadSMSSender выбирает способ доставки SMS: "log" - в лог, "file" - в SMS_FILE_PATH
+func loadSMSSender(kind string) sms.Sender {
+	switch kind {
+	case "log":
+		return sms.NewLogSender()
+	case "file":
+		path := getEnv("SMS_FILE_PATH", "sms.log")
+		log.Printf("📱 SMS are written to %s", path)
+		return sms.NewFileSender(path)
+	}
+	log.Fatalf("❌ Unknown SMS_SENDER %q, expected log or file", kind)
+	return nil
+}
+
+// loadSocialProviders настраивает провайдеров из SOCIAL_PROVIDERS. Для google, yandex и vk
+// достаточно SOCIAL_<NAME>_CLIENT_ID и SOCIAL_<NAME>_CLIENT_SECRET, любой другой
+// OIDC-провайдер (в том числе локальный mock) подключается через SOCIAL_<NAME>_ISSUER
+func loadSocialProviders(names []string, frontendURL string) []*social.Provider {
+	var providers []*social.Provider
+	for _, name := range names {
+		prefix := "SOCIAL_" + strings.ToUpper(name) + "_"
+
+		cfg := social.Preset(name)
+		cfg.ClientID = getEnv(prefix+"CLIENT_ID", "")
+		cfg.ClientSecret = getEnv(prefix+"CLIENT_SECRET", "")
+		cfg.RedirectURL = getEnv(prefix+"REDIRECT_URL", frontendURL+"/oauth/callback/"+name)
+		cfg.Issuer = getEnv(prefix+"ISSUER", cfg.Issuer)
+		cfg.AuthURL = getEnv(prefix+"AUTH_URL", cfg.AuthURL)
+		cfg.TokenURL = getEnv(prefix+"TOKEN_URL", cfg.TokenURL)
+		cfg.UserInfoURL = getEnv(prefix+"USERINFO_URL", cfg.UserInfoURL)
+		if scopes := getListEnv(prefix + "SCOPES"); scopes != nil {
+			cfg.Scopes = scopes
+		}
+		cfg.SubjectField = getEnv(prefix+"SUBJECT_FIELD", cfg.SubjectField)
+		cfg.EmailField = getEnv(prefix+"EMAIL_FIELD", cfg.EmailField)
+
+		provider, err := social.NewProvider(cfg, nil)
+		if err != nil {
+			log.Fatalf("❌ Invalid social login provider %s: %v", name, err)
+		}
+		providers = append(providers, provider)
+		log.Printf("✅ Social login via %s enabled", name)
+	}
+	return providers
+}
+
+// bootstrapAdmin назначает роль admin пользователю из BOOTSTRAP_ADMIN_EMAIL,
+// чтобы на пустой базе было кому раздавать роли через /admin
+func bootstrapAdmin(authRepo auth.Repository, rbacService rbac.Service, email string) {
+	if email == "" {
+		return
+	}
+
+	admin, err := authRepo.GetUserByEmail(email)
+	if err != nil {
+		log.Printf("⚠️ Bootstrap admin %s not found: %v", email, err)
+		return
+	}
+
+	if err := rbacService.AssignRole(admin.ID, "admin"); err != nil {
+		log.Printf("⚠️ Failed to assign admin role to %s: %v", email, err)
+		return
+	}
+	log.Printf("🛡️ User %s has admin role", email)
+}
+
+// loadKeyRing загружает ключи подписи JWT.
+// JWT_SIGNING_KEY_FILES - PEM-файлы через запятую, первый - активный ключ подписи,
+// остальные - старые ключи для проверки. JWT_SECRET - прежний HS256 секрет.
+// При асимметричной подписи токены старого секрета принимаются только до
+// JWT_LEGACY_HS256_UNTIL (RFC 3339), но не дольше maxLegacyWindow от старта: этого
+// хватает, чтобы истекли уже выданные access-токены.
+// Запасной секрет допускается только при APP_ENV=development
+func loadKeyRing(appEnv string, maxLegacyWindow time.Duration) *token.KeyRing {
+	const fallbackSecret = "fallback-secret-key"
+
+	keyFiles := getListEnv("JWT_SIGNING_KEY_FILES")
+
+	jwtSecret := getEnv("JWT_SECRET", "")
+	if jwtSecret == "" && len(keyFiles) == 0 {
+		jwtSecret = fallbackSecret
+	}
+	if jwtSecret == fallbackSecret {
+		if appEnv != "development" {
+			log.Fatal("❌ JWT_SECRET or JWT_SIGNING_KEY_FILES must be set (fallback secret is allowed only with APP_ENV=development)")
+		}
+		log.Println("⚠️ Using fallback JWT secret - development only!")
+	}
+
+	var legacyUntil time.Time
+	if value := getEnv("JWT_LEGACY_HS256_UNTIL", ""); value != "" {
+		var err error
+		legacyUntil, err = time.Parse(time.RFC3339, value)
+		if err != nil {
+			log.Fatalf("❌ Invalid JWT_LEGACY_HS256_UNTIL %q, expected RFC 3339 time: %v", value, err)
+		}
+		if limit := time.Now().Add(maxLegacyWindow); legacyUntil.After(limit) {
+			log.Printf("⚠️ JWT_LEGACY_HS256_UNTIL is capped to %s (access token lifetime)", limit.Format(time.RFC3339))
+			legacyUntil = limit
+		}
+	}
+
+	keyRing, err := token.LoadKeyRing(keyFiles, jwtSecret, legacyUntil)
+	if err != nil {
+		log.Fatalf("❌ Failed to load JWT signing keys: %v", err)
+	}
+
+	if keyRing.Asymmetric() {
+		log.Printf("🔑 Signing JWT with %s key %s", keyRing.SigningKey().Method.Alg(), keyRing.SigningKey().ID)
+		if until := keyRing.LegacyUntil(); !until.IsZero() {
+			log.Printf("⚠️ Tokens signed with the shared HS256 secret are accepted until %s, remove JWT_SECRET after that", until.Format(time.RFC3339))
+		}
+	} else {
+		log.Println("⚠️ Signing JWT with shared HS256 secret, set JWT_SIGNING_KEY_FILES to publish keys via JWKS")
+	}
+
+	return keyRing
+}
+
+// getDurationEnv читает длительность в формате time.ParseDuration (например "15m", "720h")
+func getDurationEnv(key string, defaultValue time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		log.Printf("⚠️ Invalid %s=%q, using default %s", key, value, defaultValue)
+		return defaultValue
+	}
+	return d
+}
+
+// getIntEnv читает целое число
+func getIntEnv(key string, defaultValue int) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		log.Printf("⚠️ Invalid %s=%q, using default %d", key, value, defaultValue)
+		return defaultValue
+	}
+	return n
+}
+
+// getListEnv читает список значений через запятую
+func getListEnv(key string) []string {
+	var list []string
+	for _, item := range strings.Split(os.Getenv(key), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// getRateEnv читает лимит запросов вида "10/1h"
+func getRateEnv(key string, defaultValue ratelimit.Rate) ratelimit.Rate {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	rate, err := ratelimit.ParseRate(value)
+	if err != nil {
+		log.Printf("⚠️ Invalid %s=%q, using default %s", key, value, defaultValue)
+		return defaultValue
+	}
+	return rate
+}
+
+// getBoolEnv читает булев флаг ("true", "1" и т.п.)
+func getBoolEnv(key string, defaultValue bool) bool {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		log.Printf("⚠️ Invalid %s=%q, using default %t", key, value, defaultValue)
+		return defaultValue
+	}
+	return b
+}
+
+// getSameSiteEnv читает атрибут SameSite для cookie: strict, lax или none
+func getSameSiteEnv(key string, defaultValue http.SameSite) http.SameSite {
+	switch value := strings.ToLower(os.Getenv(key)); value {
+	case "":
+		return defaultValue
+	case "strict":
+		return http.SameSiteStrictMode
+	case "lax":
+		return http.SameSiteLaxMode
+	case "none":
+		return http.SameSiteNoneMode
+	default:
+		log.Printf("⚠️ Invalid %s=%q, using default", key, value)
+		return defaultValue
+	}
+}
+
+// getCookieTrustedOrigins - origin сайтов для режима cookie. Сервис не запускается, если
+// CORS_ALLOWED_ORIGINS не задан (список по умолчанию содержит маски *.tilda.ws, где сайт
+// может создать кто угодно) или содержит маску
+func getCookieTrustedOrigins(cookieMode bool) []string {
+	if !cookieMode {
+		return nil
+	}
+
+	corsOrigins := getEnv("CORS_ALLOWED_ORIGINS", "")
+	if corsOrigins == "" {
+		log.Fatal("❌ AUTH_COOKIE_MODE requires an explicit CORS_ALLOWED_ORIGINS list")
+	}
+
+	var origins []string
+	for _, origin := range strings.Split(corsOrigins, ",") {
+		origin = strings.TrimSpace(origin)
+		if origin == "" {
+			continue
+		}
+		if strings.Contains(origin, "*") {
+			log.Fatalf("❌ AUTH_COOKIE_MODE does not allow wildcard origins in CORS_ALLOWED_ORIGINS: %s", origin)
+		}
+		origins = append(origins, strings.TrimSuffix(origin, "/"))
+	}
+	return origins
+}
+
 // getCORSAllowedOrigins возвращает список разрешенных доменов для CORS
 func getCORSAllowedOrigins() []string {
 	corsOrigins := getEnv("CORS_ALLOWED_ORIGINS", "")
@@ -0,0 +1,190 @@
+package admin
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"auth-user-service/internal/audit"
+	"auth-user-service/internal/auth"
+	"auth-user-service/internal/rbac"
+	"auth-user-service/internal/user"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// Handler - управление пользователями для службы поддержки
+type Handler struct {
+	users  user.Service
+	auth   auth.Service
+	roles  rbac.Service
+	events audit.Service
+}
+
+func NewHandler(users user.Service, authService auth.Service, roles rbac.Service, events audit.Service) *Handler {
+	return &Handler{users: users, auth: authService, roles: roles, events: events}
+}
+
+// UserDetails - карточка пользователя в админке
+type UserDetails struct {
+	*user.Account
+	Roles []string `json:"roles"`
+}
+
+// ListUsers - список пользователей с поиском и пагинацией.
+// Параметры: q, status (active|disabled), limit, offset. Общее количество - в X-Total-Count
+func (h *Handler) ListUsers(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	limit, _ := strconv.Atoi(query.Get("limit"))
+	if limit <= 0 || limit > 100 {
+		limit = 50
+	}
+	offset, _ := strconv.Atoi(query.Get("offset"))
+	if offset < 0 {
+		offset = 0
+	}
+
+	status := query.Get("status")
+	if status != "" && status != "active" && status != "disabled" {
+		http.Error(w, `{"error": "Invalid status"}`, http.StatusBadRequest)
+		return
+	}
+
+	accounts, total, err := h.users.ListAccounts(user.AccountFilter{
+		Query:  query.Get("q"),
+		Status: status,
+		Limit:  limit,
+		Offset: offset,
+	})
+	if err != nil {
+		log.Printf("❌ Admin user list failed: %v", err)
+		http.Error(w, `{"error": "Failed to list users"}`, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Total-Count", strconv.Itoa(total))
+	err = json.NewEncoder(w).Encode(accounts)
+	if err != nil {
+		return
+	}
+}
+
+func (h *Handler) GetUser(w http.ResponseWriter, r *http.Request) {
+	userID, ok := userIDParam(w, r)
+	if !ok {
+		return
+	}
+
+	account, err := h.users.GetAccount(userID)
+	if err != nil {
+		http.Error(w, `{"error": "Failed to get user"}`, http.StatusInternalServerError)
+		return
+	}
+	if account == nil {
+		http.Error(w, `{"error": "User not found"}`, http.StatusNotFound)
+		return
+	}
+
+	roles, err := h.roles.GetUserRoles(userID)
+	if err != nil {
+		http.Error(w, `{"error": "Failed to get user"}`, http.StatusInternalServerError)
+		return
+	}
+	if roles == nil {
+		roles = []string{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(UserDetails{Account: account, Roles: roles})
+	if err != nil {
+		return
+	}
+}
+
+func (h *Handler) DisableUser(w http.ResponseWriter, r *http.Request) {
+	h.runAction(w, r, "disabled", audit.AdminUserDisabled, h.auth.DisableUser)
+}
+
+func (h *Handler) EnableUser(w http.ResponseWriter, r *http.Request) {
+	h.runAction(w, r, "re-enabled", audit.AdminUserEnabled, h.auth.EnableUser)
+}
+
+func (h *Handler) ForcePasswordReset(w http.ResponseWriter, r *http.Request) {
+	h.runAction(w, r, "forced password reset for", audit.AdminPasswordResetForced, h.auth.ForcePasswordReset)
+}
+
+func (h *Handler) RevokeSessions(w http.ResponseWriter, r *http.Request) {
+	h.runAction(w, r, "revoked all sessions of", audit.AdminSessionsRevoked, func(userID int) error {
+		if _, err := h.auth.GetUserByID(userID); err != nil {
+			return err
+		}
+		return h.auth.RevokeAllSessions(userID)
+	})
+}
+
+func (h *Handler) DeleteUser(w http.ResponseWriter, r *http.Request) {
+	h.runAction(w, r, "deleted", audit.AdminUserDeleted, func(userID int) error {
+		account, err := h.users.GetAccount(userID)
+		if err != nil {
+			return err
+		}
+		if account == nil {
+			return user.ErrUserNotFound
+		}
+
+		// Сначала гасим сессии: после удаления строки токены проверить будет не по чему
+		if err := h.auth.RevokeAllSessions(userID); err != nil {
+			return err
+		}
+		// Журнал переживает аккаунт, но без его персональных данных
+		if err := h.events.AnonymizeUser(userID, account.Email); err != nil {
+			return err
+		}
+		return h.users.DeleteUser(userID)
+	})
+}
+
+// runAction выполняет действие над пользователем из URL и пишет его в лог и журнал безопасности
+func (h *Handler) runAction(w http.ResponseWriter, r *http.Request, action, eventType string, fn func(userID int) error) {
+	userID, ok := userIDParam(w, r)
+	if !ok {
+		return
+	}
+
+	err := fn(userID)
+	if errors.Is(err, auth.ErrUserNotFound) || errors.Is(err, user.ErrUserNotFound) {
+		http.Error(w, `{"error": "User not found"}`, http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("❌ Admin action %q on user %d failed: %v", action, userID, err)
+		http.Error(w, `{"error": "Action failed"}`, http.StatusInternalServerError)
+		return
+	}
+
+	var adminID int
+	if claims, ok := auth.GetClaimsFromContext(r.Context()); ok {
+		adminID = claims.UserID
+	}
+	log.Printf("🛡️ Admin %d %s user %d", adminID, action, userID)
+	h.events.Record(audit.NewEvent(r, eventType, userID, nil))
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(map[string]interface{}{"status": "ok", "user_id": userID})
+	if err != nil {
+		return
+	}
+}
+
+func userIDParam(w http.ResponseWriter, r *http.Request) (int, bool) {
+	userID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, `{"error": "Invalid user ID"}`, http.StatusBadRequest)
+		return 0, false
+	}
+	return userID, true
+}
@@ -0,0 +1,105 @@
+package audit
+
+import (
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+// Типы событий
+const (
+	UserRegistered       = "user.registered"
+	LoginSucceeded       = "login.succeeded"
+	LoginFailed          = "login.failed"
+	TokenRefreshed       = "token.refreshed"
+	TokenReuseDetected   = "token.reuse_detected"
+	Logout               = "logout"
+	LogoutAll            = "logout.all"
+	SessionRevoked       = "session.revoked"
+	PasswordChanged      = "password.changed"
+	PasswordReset        = "password.reset"
+	EmailChangeRequested = "email.change_requested"
+	EmailChanged         = "email.changed"
+	TwoFactorEnabled     = "2fa.enabled"
+	TwoFactorDisabled    = "2fa.disabled"
+	PasskeyAdded         = "passkey.added"
+	PasskeyRemoved       = "passkey.removed"
+	PasskeyOnlyChanged   = "passkey.only_changed"
+	PhoneVerified        = "phone.verified"
+	IdentityLinked       = "identity.linked"
+	IdentityUnlinked     = "identity.unlinked"
+	DataExported         = "account.data_exported"
+
+	AccountDeletionRequested = "account.deletion_requested"
+	AccountDeletionCancelled = "account.deletion_cancelled"
+	AccountDeleted           = "account.deleted"
+
+	AdminUserDisabled           = "admin.user_disabled"
+	AdminUserEnabled            = "admin.user_enabled"
+	AdminPasswordResetForced    = "admin.password_reset_forced"
+	AdminSessionsRevoked        = "admin.sessions_revoked"
+	AdminUserDeleted            = "admin.user_deleted"
+	AdminRoleAssigned           = "admin.role_assigned"
+	AdminRoleRevoked            = "admin.role_revoked"
+	AdminServiceAccountCreated  = "admin.service_account_created"
+	AdminServiceAccountDisabled = "admin.service_account_disabled"
+	AdminAPIKeyCreated          = "admin.api_key_created"
+	AdminAPIKeyRevoked          = "admin.api_key_revoked"
+	AdminOAuthClientCreated     = "admin.oauth_client_created"
+	AdminOAuthClientDeleted     = "admin.oauth_client_deleted"
+)
+
+// Metadata - подробности события: причина отказа, способ входа и т.п. Пароли,
+// токены и коды сюда не пишутся
+type Metadata map[string]interface{}
+
+// Event - запись журнала безопасности
+type Event struct {
+	ID   int64  `json:"id"`
+	Type string `json:"type"`
+	// UserID - чей аккаунт затронут, 0 если неизвестно (вход с несуществующим email)
+	UserID int `json:"user_id,omitempty"`
+	// ActorID - кто выполнил действие: сам пользователь или администратор
+	ActorID   int       `json:"actor_id,omitempty"`
+	IPAddress string    `json:"ip_address,omitempty"`
+	UserAgent string    `json:"user_agent,omitempty"`
+	RequestID string    `json:"request_id,omitempty"`
+	Metadata  Metadata  `json:"metadata,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// NewEvent заполняет событие данными запроса: IP, User-Agent, request ID
+// и инициатора - вошедшего пользователя из контекста
+func NewEvent(r *http.Request, eventType string, userID int, metadata Metadata) Event {
+	actorID, _ := r.Context().Value("userID").(int)
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+
+	return Event{
+		Type:      eventType,
+		UserID:    userID,
+		ActorID:   actorID,
+		IPAddress: host,
+		UserAgent: r.UserAgent(),
+		RequestID: middleware.GetReqID(r.Context()),
+		Metadata:  metadata,
+	}
+}
+
+// Filter - параметры поиска событий. Нулевые поля не ограничивают выборку
+type Filter struct {
+	UserID    int
+	ActorID   int
+	Types     []string
+	IPAddress string
+	RequestID string
+	From      time.Time
+	To        time.Time
+	Limit     int
+	Offset    int
+}
@@ -0,0 +1,144 @@
+package audit
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type Handler struct {
+	service Service
+}
+
+func NewHandler(service Service) *Handler {
+	return &Handler{service: service}
+}
+
+// SecurityEvent - событие в истории безопасности пользователя. Кто из администраторов
+// выполнил действие, пользователю не показывается
+type SecurityEvent struct {
+	Type            string    `json:"type"`
+	IPAddress       string    `json:"ip_address,omitempty"`
+	UserAgent       string    `json:"user_agent,omitempty"`
+	Metadata        Metadata  `json:"metadata,omitempty"`
+	ByAdministrator bool      `json:"by_administrator,omitempty"`
+	CreatedAt       time.Time `json:"created_at"`
+}
+
+// ListEvents - журнал для администраторов. Параметры: user_id, actor_id, type (через запятую),
+// ip, request_id, from и to (RFC 3339), limit, offset. Общее количество - в X-Total-Count
+func (h *Handler) ListEvents(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	filter := Filter{
+		IPAddress: query.Get("ip"),
+		RequestID: query.Get("request_id"),
+	}
+	filter.Limit, filter.Offset = pagination(query)
+
+	var err error
+	if filter.UserID, err = intParam(query, "user_id"); err != nil {
+		http.Error(w, `{"error": "Invalid user_id"}`, http.StatusBadRequest)
+		return
+	}
+	if filter.ActorID, err = intParam(query, "actor_id"); err != nil {
+		http.Error(w, `{"error": "Invalid actor_id"}`, http.StatusBadRequest)
+		return
+	}
+	if filter.From, err = timeParam(query, "from"); err != nil {
+		http.Error(w, `{"error": "Invalid from, expected RFC 3339 time"}`, http.StatusBadRequest)
+		return
+	}
+	if filter.To, err = timeParam(query, "to"); err != nil {
+		http.Error(w, `{"error": "Invalid to, expected RFC 3339 time"}`, http.StatusBadRequest)
+		return
+	}
+	for _, eventType := range strings.Split(query.Get("type"), ",") {
+		if eventType = strings.TrimSpace(eventType); eventType != "" {
+			filter.Types = append(filter.Types, eventType)
+		}
+	}
+
+	events, total, err := h.service.List(filter)
+	if err != nil {
+		log.Printf("❌ Audit log query failed: %v", err)
+		http.Error(w, `{"error": "Failed to get audit events"}`, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Total-Count", strconv.Itoa(total))
+	err = json.NewEncoder(w).Encode(events)
+	if err != nil {
+		return
+	}
+}
+
+// SecurityEvents - история входов и изменений безопасности своего аккаунта.
+// Параметры: limit, offset. Общее количество - в X-Total-Count
+func (h *Handler) SecurityEvents(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int)
+	if !ok {
+		http.Error(w, `{"error": "User not authenticated"}`, http.StatusUnauthorized)
+		return
+	}
+
+	filter := Filter{UserID: userID}
+	filter.Limit, filter.Offset = pagination(r.URL.Query())
+
+	events, total, err := h.service.List(filter)
+	if err != nil {
+		log.Printf("❌ Failed to get security events for user %d: %v", userID, err)
+		http.Error(w, `{"error": "Failed to get security events"}`, http.StatusInternalServerError)
+		return
+	}
+
+	result := make([]SecurityEvent, 0, len(events))
+	for _, e := range events {
+		result = append(result, SecurityEvent{
+			Type:            e.Type,
+			IPAddress:       e.IPAddress,
+			UserAgent:       e.UserAgent,
+			Metadata:        e.Metadata,
+			ByAdministrator: e.ActorID != 0 && e.ActorID != userID,
+			CreatedAt:       e.CreatedAt,
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Total-Count", strconv.Itoa(total))
+	err = json.NewEncoder(w).Encode(result)
+	if err != nil {
+		return
+	}
+}
+
+func pagination(query url.Values) (limit, offset int) {
+	limit, _ = strconv.Atoi(query.Get("limit"))
+	if limit <= 0 || limit > 100 {
+		limit = 50
+	}
+	offset, _ = strconv.Atoi(query.Get("offset"))
+	if offset < 0 {
+		offset = 0
+	}
+	return limit, offset
+}
+
+func intParam(query url.Values, name string) (int, error) {
+	if query.Get(name) == "" {
+		return 0, nil
+	}
+	return strconv.Atoi(query.Get(name))
+}
+
+func timeParam(query url.Values, name string) (time.Time, error) {
+	if query.Get(name) == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse(time.RFC3339, query.Get(name))
+}
@@ -0,0 +1,131 @@
+package audit
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+type Repository interface {
+	Insert(event *Event) error
+	List(filter Filter) ([]Event, int, error)
+	AnonymizeUser(userID int, email string) error
+}
+
+type repository struct {
+	db *sql.DB
+}
+
+func NewRepository(db *sql.DB) Repository {
+	return &repository{db: db}
+}
+
+func (r *repository) Insert(event *Event) error {
+	var metadata []byte
+	if len(event.Metadata) != 0 {
+		var err error
+		metadata, err = json.Marshal(event.Metadata)
+		if err != nil {
+			return err
+		}
+	}
+
+	return r.db.QueryRow(
+		`INSERT INTO audit_events (type, user_id, actor_id, ip_address, user_agent, request_id, metadata)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7)
+		 RETURNING id, created_at`,
+		event.Type, nullInt(event.UserID), nullInt(event.ActorID),
+		event.IPAddress, event.UserAgent, event.RequestID, metadata,
+	).Scan(&event.ID, &event.CreatedAt)
+}
+
+func (r *repository) List(filter Filter) ([]Event, int, error) {
+	where := []string{"TRUE"}
+	var args []interface{}
+	add := func(condition string, value interface{}) {
+		args = append(args, value)
+		where = append(where, fmt.Sprintf(condition, len(args)))
+	}
+
+	if filter.UserID != 0 {
+		add("user_id = $%d", filter.UserID)
+	}
+	if filter.ActorID != 0 {
+		add("actor_id = $%d", filter.ActorID)
+	}
+	if len(filter.Types) != 0 {
+		add("type = ANY($%d)", pq.Array(filter.Types))
+	}
+	if filter.IPAddress != "" {
+		add("ip_address = $%d", filter.IPAddress)
+	}
+	if filter.RequestID != "" {
+		add("request_id = $%d", filter.RequestID)
+	}
+	if !filter.From.IsZero() {
+		add("created_at >= $%d", filter.From)
+	}
+	if !filter.To.IsZero() {
+		add("created_at < $%d", filter.To)
+	}
+
+	from := " FROM audit_events WHERE " + strings.Join(where, " AND ")
+
+	var total int
+	if err := r.db.QueryRow("SELECT COUNT(*)"+from, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	args = append(args, filter.Limit, filter.Offset)
+	rows, err := r.db.Query(
+		`SELECT id, type, COALESCE(user_id, 0), COALESCE(actor_id, 0), ip_address, user_agent, request_id, metadata, created_at`+
+			from+fmt.Sprintf(" ORDER BY created_at DESC, id DESC LIMIT $%d OFFSET $%d", len(args)-1, len(args)),
+		args...,
+	)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer func(rows *sql.Rows) {
+		_ = rows.Close()
+	}(rows)
+
+	events := []Event{}
+	for rows.Next() {
+		var event Event
+		var metadata []byte
+		if err := rows.Scan(
+			&event.ID, &event.Type, &event.UserID, &event.ActorID, &event.IPAddress,
+			&event.UserAgent, &event.RequestID, &metadata, &event.CreatedAt,
+		); err != nil {
+			return nil, 0, err
+		}
+		if len(metadata) != 0 {
+			if err := json.Unmarshal(metadata, &event.Metadata); err != nil {
+				return nil, 0, err
+			}
+		}
+		events = append(events, event)
+	}
+
+	return events, total, rows.Err()
+}
+
+// AnonymizeUser стирает персональные данные удалённого аккаунта: IP и User-Agent событий,
+// где он пользователь или инициатор, адреса в metadata и неудачные входы с его email.
+// Сами события остаются. UPDATE журнала приложению запрещён, поэтому всё делает функция
+// anonymize_audit_events, которая выполняется с правами отдельной роли
+func (r *repository) AnonymizeUser(userID int, email string) error {
+	_, err := r.db.Exec("SELECT anonymize_audit_events($1, $2)", userID, email)
+	return err
+}
+
+// nullInt - 0 записывается как NULL
+func nullInt(v int) interface{} {
+	if v == 0 {
+		return nil
+	}
+	return v
+}
@@ -0,0 +1,47 @@
+package audit
+
+import (
+	"log"
+	"strings"
+)
+
+// Service пишет и читает журнал событий безопасности
+type Service interface {
+	// Record сохраняет событие. Ошибка записи не прерывает вход или другое действие -
+	// она только попадает в лог вместе с самим событием
+	Record(event Event)
+	List(filter Filter) ([]Event, int, error)
+	// AnonymizeUser стирает из журнала персональные данные удаляемого аккаунта
+	AnonymizeUser(userID int, email string) error
+}
+
+type service struct {
+	repo Repository
+}
+
+func NewService(repo Repository) Service {
+	return &service{repo: repo}
+}
+
+// maxUserAgentLength - длиннее User-Agent не бывает у настоящих браузеров
+const maxUserAgentLength = 512
+
+func (s *service) Record(event Event) {
+	if len(event.UserAgent) > maxUserAgentLength {
+		// Обрезка по байтам могла разрезать символ - Postgres не примет такую строку
+		event.UserAgent = strings.ToValidUTF8(event.UserAgent[:maxUserAgentLength], "")
+	}
+
+	if err := s.repo.Insert(&event); err != nil {
+		log.Printf("❌ Failed to record audit event %s (user %d, actor %d, request %s): %v",
+			event.Type, event.UserID, event.ActorID, event.RequestID, err)
+	}
+}
+
+func (s *service) List(filter Filter) ([]Event, int, error) {
+	return s.repo.List(filter)
+}
+
+func (s *service) AnonymizeUser(userID int, email string) error {
+	return s.repo.AnonymizeUser(userID, email)
+}
@@ -0,0 +1,35 @@
+package auth
+
+import (
+	"net/http"
+
+	"auth-user-service/internal/audit"
+)
+
+// record пишет в журнал безопасности событие, случившееся внутри сервиса
+// (неудачный вход, обновление токенов), с данными устройства client
+func (s *service) record(eventType string, userID int, client ClientInfo, metadata audit.Metadata) {
+	s.events.Record(audit.Event{
+		Type:      eventType,
+		UserID:    userID,
+		ActorID:   userID,
+		IPAddress: client.IPAddress,
+		UserAgent: client.UserAgent,
+		RequestID: client.RequestID,
+		Metadata:  metadata,
+	})
+}
+
+// recordLoginFailure - неудачный вход с причиной отказа. userID равен 0, если аккаунт не найден
+func (s *service) recordLoginFailure(userID int, client ClientInfo, reason string, metadata audit.Metadata) {
+	if metadata == nil {
+		metadata = audit.Metadata{}
+	}
+	metadata["reason"] = reason
+	s.record(audit.LoginFailed, userID, client, metadata)
+}
+
+// record пишет в журнал безопасности действие, выполненное через API
+func (h *Handler) record(r *http.Request, eventType string, userID int, metadata audit.Metadata) {
+	h.events.Record(audit.NewEvent(r, eventType, userID, metadata))
+}
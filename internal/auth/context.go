@@ -2,12 +2,22 @@ package auth
 
 import (
 	"context"
+
+	"auth-user-service/internal/token"
 )
 
 type contextKey string
 
 const (
-	userContextKey contextKey = "user"
+	userContextKey      contextKey = "user"
+	claimsContextKey    contextKey = "claims"
+	principalContextKey contextKey = "principal"
+)
+
+// Типы субъектов запроса
+const (
+	PrincipalUser           = "user"
+	PrincipalServiceAccount = "service_account"
 )
 
 // GetUserFromContext извлекает пользователя из контекста
@@ -24,3 +34,15 @@ func GetUserIDFromContext(ctx context.Context) (int, bool) {
 	}
 	return user.ID, true
 }
+
+// GetClaimsFromContext извлекает claims проверенного access-токена из контекста
+func GetClaimsFromContext(ctx context.Context) (*token.Claims, bool) {
+	claims, ok := ctx.Value(claimsContextKey).(*token.Claims)
+	return claims, ok && claims != nil
+}
+
+// GetPrincipalTypeFromContext возвращает, кто выполняет запрос: пользователь или сервисный аккаунт
+func GetPrincipalTypeFromContext(ctx context.Context) (string, bool) {
+	principal, ok := ctx.Value(principalContextKey).(string)
+	return principal, ok
+}
@@ -0,0 +1,207 @@
+package auth
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Cookie режима для браузеров. Токены в HttpOnly cookie недоступны скриптам страницы,
+// поэтому XSS на сайте не может их украсть. Взамен нужна защита от CSRF: браузер
+// подставляет cookie сам, поэтому изменяющие запросы должны нести X-CSRF-Token
+// с тем же значением, что в cookie csrf_token (double-submit)
+const (
+	accessTokenCookie  = "access_token"
+	refreshTokenCookie = "refresh_token"
+	csrfCookie         = "csrf_token"
+	csrfHeader         = "X-CSRF-Token"
+	// authModeHeader - клиент просит режим cookie заголовком "X-Auth-Mode: cookie"
+	authModeHeader = "X-Auth-Mode"
+)
+
+// CookiePolicy - настройки режима cookie
+type CookiePolicy struct {
+	// Enabled - режим доступен; клиенты включают его сами заголовком X-Auth-Mode
+	Enabled bool
+	Domain  string
+	// Secure - отключается только для локальной разработки по http
+	Secure bool
+	// SameSite - для сайта на другом домене (Tilda) нужен None, иначе браузер не отправит cookie
+	SameSite http.SameSite
+	// RefreshTTL - срок жизни cookie с refresh-токеном, заполняет сервис
+	RefreshTTL time.Duration
+	// TrustedOrigins - точные origin сайтов, с которых принимаются изменяющие запросы по cookie
+	TrustedOrigins []string
+}
+
+// cookieMode - отвечать ли на запрос cookie. Клиент в этом режиме либо явно просит его
+// заголовком, либо уже прислал сессионные cookie без заголовка Authorization
+func (h *Handler) cookieMode(r *http.Request) bool {
+	if !h.service.CookiePolicy().Enabled {
+		return false
+	}
+	if strings.EqualFold(r.Header.Get(authModeHeader), "cookie") {
+		return true
+	}
+	return r.Header.Get("Authorization") == "" && hasSessionCookie(r)
+}
+
+// setSessionCookies кладёт токены в cookie и выдаёт новый CSRF-токен
+func (h *Handler) setSessionCookies(w http.ResponseWriter, tokens *TokenPair) (string, error) {
+	policy := h.service.CookiePolicy()
+
+	csrfToken, err := newID()
+	if err != nil {
+		return "", err
+	}
+
+	http.SetCookie(w, sessionCookie(policy, accessTokenCookie, tokens.AccessToken, "/", tokens.ExpiresIn, true))
+	// Refresh-токен нужен только эндпоинтам /auth
+	http.SetCookie(w, sessionCookie(policy, refreshTokenCookie, tokens.RefreshToken, "/auth", int(policy.RefreshTTL.Seconds()), true))
+	http.SetCookie(w, sessionCookie(policy, csrfCookie, csrfToken, "/", int(policy.RefreshTTL.Seconds()), false))
+	return csrfToken, nil
+}
+
+// writeCookieTokenResponse - ответ на вход в режиме cookie: токенов в теле нет
+func (h *Handler) writeCookieTokenResponse(w http.ResponseWriter, user *User, tokens *TokenPair) {
+	csrfToken, err := h.setSessionCookies(w, tokens)
+	if err != nil {
+		http.Error(w, `{"error": "Failed to issue CSRF token"}`, http.StatusInternalServerError)
+		return
+	}
+
+	response := map[string]interface{}{
+		"csrf_token": csrfToken,
+		"expires_in": tokens.ExpiresIn,
+		"email":      user.Email,
+		"id":         user.ID,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		return
+	}
+}
+
+// clearSessionCookies удаляет cookie при выходе и при недействительном refresh-токене
+func (h *Handler) clearSessionCookies(w http.ResponseWriter) {
+	policy := h.service.CookiePolicy()
+	http.SetCookie(w, sessionCookie(policy, accessTokenCookie, "", "/", -1, true))
+	http.SetCookie(w, sessionCookie(policy, refreshTokenCookie, "", "/auth", -1, true))
+	http.SetCookie(w, sessionCookie(policy, csrfCookie, "", "/", -1, false))
+}
+
+func sessionCookie(policy CookiePolicy, name, value, path string, maxAge int, httpOnly bool) *http.Cookie {
+	return &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     path,
+		Domain:   policy.Domain,
+		MaxAge:   maxAge,
+		Secure:   policy.Secure,
+		HttpOnly: httpOnly,
+		SameSite: policy.SameSite,
+	}
+}
+
+// CSRFMiddleware проверяет CSRF-токен у изменяющих запросов, авторизованных cookie.
+// Запросы с Authorization или X-API-Key не проверяются: эти заголовки браузер сам не подставляет
+func (h *Handler) CSRFMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") == "" && r.Header.Get("X-API-Key") == "" &&
+			hasSessionCookie(r) && !h.validCSRF(r) {
+			log.Printf("🛡️ CSRF check failed for %s %s", r.Method, r.URL.Path)
+			http.Error(w, `{"error": "CSRF token missing or invalid"}`, http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// CSRFToken - GET /auth/csrf. Страница на другом домене не может прочитать cookie API,
+// поэтому токен отдаётся и в теле ответа (прочитать его может только разрешённый CORS origin)
+func (h *Handler) CSRFToken(w http.ResponseWriter, r *http.Request) {
+	if !h.service.CookiePolicy().Enabled {
+		http.Error(w, `{"error": "Cookie mode is disabled"}`, http.StatusNotFound)
+		return
+	}
+
+	var csrfToken string
+	if c, err := r.Cookie(csrfCookie); err == nil && c.Value != "" {
+		csrfToken = c.Value
+	} else {
+		csrfToken, err = newID()
+		if err != nil {
+			http.Error(w, `{"error": "Failed to issue CSRF token"}`, http.StatusInternalServerError)
+			return
+		}
+		policy := h.service.CookiePolicy()
+		http.SetCookie(w, sessionCookie(policy, csrfCookie, csrfToken, "/", int(policy.RefreshTTL.Seconds()), false))
+	}
+
+	response := map[string]string{
+		"csrf_token": csrfToken,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	err := json.NewEncoder(w).Encode(response)
+	if err != nil {
+		return
+	}
+}
+
+// validCSRF - безопасные методы не проверяются. У остальных запрос должен прийти
+// с доверенного origin, а заголовок - совпасть с cookie
+func (h *Handler) validCSRF(r *http.Request) bool {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	}
+
+	if !trustedOrigin(r, h.service.CookiePolicy().TrustedOrigins) {
+		return false
+	}
+
+	c, err := r.Cookie(csrfCookie)
+	if err != nil || c.Value == "" {
+		return false
+	}
+	header := r.Header.Get(csrfHeader)
+	return header != "" && subtle.ConstantTimeCompare([]byte(header), []byte(c.Value)) == 1
+}
+
+// trustedOrigin проверяет Origin запроса, а если браузер его не прислал - Referer.
+// Запрос без обоих заголовков отклоняется: cookie подставляет только браузер, а он их отправляет
+func trustedOrigin(r *http.Request, trusted []string) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		referer, err := url.Parse(r.Header.Get("Referer"))
+		if err != nil || referer.Scheme == "" || referer.Host == "" {
+			return false
+		}
+		origin = referer.Scheme + "://" + referer.Host
+	}
+
+	for _, o := range trusted {
+		if strings.EqualFold(o, origin) {
+			return true
+		}
+	}
+	return false
+}
+
+func hasSessionCookie(r *http.Request) bool {
+	for _, name := range []string{accessTokenCookie, refreshTokenCookie} {
+		if c, err := r.Cookie(name); err == nil && c.Value != "" {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,188 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"auth-user-service/internal/notify"
+)
+
+// checkPassword сверяет пароль пользователя. Неверный пароль - ErrInvalidCredentials.
+// Попытки учитываются в той же блокировке аккаунта, что и вход, иначе подтверждение
+// паролем из украденной сессии позволяло бы перебирать пароль без ограничений
+func (s *service) checkPassword(user *User, password string) error {
+	if err := s.checkLockout(user.Email, ""); err != nil {
+		return err
+	}
+
+	match, _, err := s.passwords.Verify(user.PasswordHash, password)
+	if err != nil {
+		return err
+	}
+	if !match {
+		s.registerLoginFailure(user.Email, "")
+		return ErrInvalidCredentials
+	}
+	s.resetLoginFailures(user.Email)
+	return nil
+}
+
+// VerifyPassword подтверждает паролем опасное действие вошедшего пользователя (удаление аккаунта).
+// Аккаунт без пароля подтверждает удаление ссылкой из письма, см. SendDeletionConfirmation
+func (s *service) VerifyPassword(userID int, password string) error {
+	user, err := s.repo.GetUserByID(userID)
+	if err != nil {
+		return err
+	}
+	return s.checkPassword(user, password)
+}
+
+// SendDeletionConfirmation отправляет на email ссылку подтверждения удаления аккаунта.
+// Нужна аккаунтам без пароля (вход по ссылке, через провайдера или по телефону):
+// одной украденной сессии для удаления по-прежнему мало, нужен ещё доступ к почте
+func (s *service) SendDeletionConfirmation(userID int) error {
+	user, err := s.repo.GetUserByID(userID)
+	if err != nil {
+		return err
+	}
+
+	token, tokenHash, err := newOpaqueToken()
+	if err != nil {
+		return err
+	}
+	if err := s.repo.SaveDeletionToken(userID, tokenHash, time.Now().Add(s.cfg.DeletionConfirmTTL)); err != nil {
+		return err
+	}
+
+	return s.notifier.Send(context.Background(), notify.Message{
+		To:      user.Email,
+		Subject: "Подтверждение удаления аккаунта",
+		Body: fmt.Sprintf(
+			"Чтобы удалить аккаунт, перейдите по ссылке: %s/confirm-account-deletion?token=%s\nСсылка действует %s. Если вы не запрашивали удаление, смените пароль: %s/forgot-password",
+			s.cfg.FrontendURL, url.QueryEscape(token), s.cfg.DeletionConfirmTTL, s.cfg.FrontendURL,
+		),
+	})
+}
+
+// ConsumeDeletionConfirmation гасит ссылку из письма SendDeletionConfirmation
+func (s *service) ConsumeDeletionConfirmation(userID int, token string) error {
+	return s.repo.ConsumeDeletionToken(userID, hashToken(token))
+}
+
+// ChangePassword меняет пароль по текущему паролю и завершает все сессии.
+// Чтобы текущий клиент остался в системе, ему выдаются новые токены через IssueTokens
+func (s *service) ChangePassword(userID int, currentPassword, newPassword string) (*User, error) {
+	user, err := s.repo.GetUserByID(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.checkPassword(user, currentPassword); err != nil {
+		return nil, err
+	}
+	if err := s.policy.Validate(newPassword, user.Email); err != nil {
+		return nil, err
+	}
+
+	hashedPassword, err := s.passwords.Hash(newPassword)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.repo.UpdatePassword(userID, hashedPassword); err != nil {
+		return nil, err
+	}
+
+	if err := s.RevokeAllSessions(userID); err != nil {
+		return nil, err
+	}
+
+	s.sendNotification(notify.Message{
+		To:      user.Email,
+		Subject: "Пароль изменён",
+		Body: fmt.Sprintf(
+			"Пароль от вашего аккаунта был изменён, все остальные сеансы завершены. Если это были не вы, восстановите доступ: %s/forgot-password",
+			s.cfg.FrontendURL,
+		),
+	})
+
+	return user, nil
+}
+
+// RequestEmailChange отправляет ссылку подтверждения на новый адрес.
+// Email меняется только после перехода по ссылке, старый адрес получает уведомление
+func (s *service) RequestEmailChange(userID int, currentPassword, newEmail string) error {
+	user, err := s.repo.GetUserByID(userID)
+	if err != nil {
+		return err
+	}
+
+	if err := s.checkPassword(user, currentPassword); err != nil {
+		return err
+	}
+
+	newEmail = strings.TrimSpace(newEmail)
+	if strings.EqualFold(newEmail, user.Email) {
+		return ErrEmailTaken
+	}
+	exists, err := s.repo.UserExists(newEmail)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return ErrEmailTaken
+	}
+
+	token, tokenHash, err := newOpaqueToken()
+	if err != nil {
+		return err
+	}
+	if err := s.repo.SaveEmailChangeRequest(userID, newEmail, tokenHash, time.Now().Add(s.cfg.EmailChangeTTL)); err != nil {
+		return err
+	}
+
+	s.sendNotification(notify.Message{
+		To:      newEmail,
+		Subject: "Подтверждение нового email",
+		Body: fmt.Sprintf(
+			"Подтвердите новый адрес, перейдя по ссылке: %s/confirm-email-change?token=%s\nСсылка действует %s.",
+			s.cfg.FrontendURL, url.QueryEscape(token), s.cfg.EmailChangeTTL,
+		),
+	})
+	s.sendNotification(notify.Message{
+		To:      user.Email,
+		Subject: "Запрошена смена email",
+		Body: fmt.Sprintf(
+			"Запрошена смена email вашего аккаунта на %s. Адрес изменится после подтверждения. Если это были не вы, смените пароль: %s/forgot-password",
+			newEmail, s.cfg.FrontendURL,
+		),
+	})
+
+	return nil
+}
+
+// ConfirmEmailChange меняет email по ссылке из письма и возвращает ID пользователя.
+// Старые access-токены содержат прежний email, поэтому они отзываются
+func (s *service) ConfirmEmailChange(token string) (int, error) {
+	change, err := s.repo.ConfirmEmailChange(hashToken(token))
+	if err != nil {
+		return 0, err
+	}
+
+	if err := s.ExpireAccessTokens(change.UserID); err != nil {
+		return 0, err
+	}
+
+	s.sendNotification(notify.Message{
+		To:      change.OldEmail,
+		Subject: "Email изменён",
+		Body: fmt.Sprintf(
+			"Email вашего аккаунта изменён на %s. Если это были не вы, обратитесь в поддержку.",
+			change.NewEmail,
+		),
+	})
+
+	return change.UserID, nil
+}
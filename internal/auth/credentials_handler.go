@@ -0,0 +1,181 @@
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+
+	"auth-user-service/internal/audit"
+	"auth-user-service/internal/password"
+)
+
+// ProfileCache сбрасывает закэшированный профиль, когда меняются данные аккаунта
+type ProfileCache interface {
+	InvalidateProfile(userID int) error
+}
+
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password"`
+	NewPassword     string `json:"new_password"`
+}
+
+type ChangeEmailRequest struct {
+	CurrentPassword string `json:"current_password"`
+	NewEmail        string `json:"new_email"`
+}
+
+type ConfirmEmailChangeRequest struct {
+	Token string `json:"token"`
+}
+
+// ChangePassword - смена пароля. Остальные сессии завершаются, клиент получает новые токены
+func (h *Handler) ChangePassword(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int)
+	if !ok {
+		http.Error(w, `{"error": "User not authenticated"}`, http.StatusUnauthorized)
+		return
+	}
+
+	var req ChangePasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, `{"error": "Invalid request"}`, http.StatusBadRequest)
+		return
+	}
+
+	if req.CurrentPassword == "" || req.NewPassword == "" {
+		http.Error(w, `{"error": "Current and new password are required"}`, http.StatusBadRequest)
+		return
+	}
+
+	user, err := h.service.ChangePassword(userID, req.CurrentPassword, req.NewPassword)
+	var invalid *password.ValidationError
+	var locked *LockedError
+	switch {
+	case errors.As(err, &locked):
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(locked.RetryAfter.Seconds()))))
+		http.Error(w, `{"error": "Too many failed attempts, try again later"}`, http.StatusTooManyRequests)
+		return
+	case errors.Is(err, ErrInvalidCredentials):
+		http.Error(w, `{"error": "Current password is incorrect"}`, http.StatusForbidden)
+		return
+	case errors.As(err, &invalid):
+		writeValidationError(w, invalid)
+		return
+	case err != nil:
+		log.Printf("❌ Password change failed for user %d: %v", userID, err)
+		http.Error(w, `{"error": "Failed to change password"}`, http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("🔐 User %d changed password, other sessions revoked", userID)
+	h.record(r, audit.PasswordChanged, userID, nil)
+
+	tokens, err := h.service.IssueTokens(user, clientInfo(r))
+	if err != nil {
+		http.Error(w, `{"error": "Failed to generate token"}`, http.StatusInternalServerError)
+		return
+	}
+
+	h.writeTokenResponse(w, r, user, tokens)
+}
+
+// ChangeEmail - запрос смены email. Адрес меняется после перехода по ссылке из письма
+func (h *Handler) ChangeEmail(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int)
+	if !ok {
+		http.Error(w, `{"error": "User not authenticated"}`, http.StatusUnauthorized)
+		return
+	}
+
+	var req ChangeEmailRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, `{"error": "Invalid request"}`, http.StatusBadRequest)
+		return
+	}
+
+	if req.CurrentPassword == "" || req.NewEmail == "" {
+		http.Error(w, `{"error": "Current password and new email are required"}`, http.StatusBadRequest)
+		return
+	}
+
+	err := h.service.RequestEmailChange(userID, req.CurrentPassword, req.NewEmail)
+	var locked *LockedError
+	switch {
+	case errors.As(err, &locked):
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(locked.RetryAfter.Seconds()))))
+		http.Error(w, `{"error": "Too many failed attempts, try again later"}`, http.StatusTooManyRequests)
+		return
+	case errors.Is(err, ErrInvalidCredentials):
+		http.Error(w, `{"error": "Current password is incorrect"}`, http.StatusForbidden)
+		return
+	case errors.Is(err, ErrEmailTaken):
+		http.Error(w, `{"error": "Email already in use"}`, http.StatusConflict)
+		return
+	case err != nil:
+		log.Printf("❌ Email change request failed for user %d: %v", userID, err)
+		http.Error(w, `{"error": "Failed to change email"}`, http.StatusInternalServerError)
+		return
+	}
+	h.record(r, audit.EmailChangeRequested, userID, audit.Metadata{"new_email": req.NewEmail})
+
+	response := map[string]string{
+		"message": "Confirmation link has been sent to the new email",
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		return
+	}
+}
+
+// ConfirmEmailChange - подтверждение нового email. GET для ссылки из письма, POST для фронтенда
+func (h *Handler) ConfirmEmailChange(w http.ResponseWriter, r *http.Request) {
+	token := r.URL.Query().Get("token")
+	if r.Method == http.MethodPost {
+		var req ConfirmEmailChangeRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, `{"error": "Invalid request"}`, http.StatusBadRequest)
+			return
+		}
+		token = req.Token
+	}
+
+	if token == "" {
+		http.Error(w, `{"error": "Token is required"}`, http.StatusBadRequest)
+		return
+	}
+
+	userID, err := h.service.ConfirmEmailChange(token)
+	switch {
+	case errors.Is(err, ErrEmailChangeInvalid):
+		http.Error(w, `{"error": "Invalid or expired confirmation token"}`, http.StatusBadRequest)
+		return
+	case errors.Is(err, ErrEmailTaken):
+		http.Error(w, `{"error": "Email already in use"}`, http.StatusConflict)
+		return
+	case err != nil:
+		log.Printf("❌ Email change confirmation failed: %v", err)
+		http.Error(w, `{"error": "Failed to change email"}`, http.StatusInternalServerError)
+		return
+	}
+
+	h.record(r, audit.EmailChanged, userID, nil)
+	if err := h.profiles.InvalidateProfile(userID); err != nil {
+		log.Printf("⚠️ Failed to invalidate profile cache for user %d: %v", userID, err)
+	}
+
+	response := map[string]string{
+		"message": "Email changed",
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		return
+	}
+}
@@ -3,16 +3,27 @@ package auth
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"io"
 	"log"
+	"math"
+	"net"
 	"net/http"
+	"strconv"
+
+	"auth-user-service/internal/audit"
+	"auth-user-service/internal/password"
+	"auth-user-service/internal/token"
 )
 
 type Handler struct {
-	service Service
+	service  Service
+	profiles ProfileCache
+	events   audit.Service
 }
 
-func NewHandler(service Service) *Handler {
-	return &Handler{service: service}
+func NewHandler(service Service, profiles ProfileCache, events audit.Service) *Handler {
+	return &Handler{service: service, profiles: profiles, events: events}
 }
 
 type RegisterRequest struct {
@@ -27,6 +38,27 @@ type LoginRequest struct {
 	Password string `json:"password"`
 }
 
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+type ForgotPasswordRequest struct {
+	Email string `json:"email"`
+}
+
+type ResetPasswordRequest struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+type VerifyEmailRequest struct {
+	Token string `json:"token"`
+}
+
+type ResendVerificationRequest struct {
+	Email string `json:"email"`
+}
+
 func (h *Handler) Register(w http.ResponseWriter, r *http.Request) {
 	var req RegisterRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -40,88 +72,248 @@ func (h *Handler) Register(w http.ResponseWriter, r *http.Request) {
 	}
 
 	user, err := h.service.Register(req.Email, req.Password, req.FirstName, req.LastName)
-	if err != nil {
-		http.Error(w, `{"error": "`+err.Error()+`"}`, http.StatusBadRequest)
+	var invalid *password.ValidationError
+	switch {
+	case errors.As(err, &invalid):
+		writeValidationError(w, invalid)
+		return
+	case errors.Is(err, ErrUserExists):
+		// Не раскрываем, что адрес уже зарегистрирован: владельцу ушло письмо
+		writeVerificationPending(w)
+		return
+	case err != nil:
+		log.Printf("❌ Registration failed: %v", err)
+		http.Error(w, `{"error": "Failed to register"}`, http.StatusInternalServerError)
+		return
+	}
+
+	h.record(r, audit.UserRegistered, user.ID, nil)
+
+	// Токены при регистрации не выдаются: иначе по ответу было бы видно, что адрес свободен.
+	// Новый пользователь входит через /auth/login (при RequireForLogin - после подтверждения email)
+	writeVerificationPending(w)
+}
+
+func (h *Handler) Login(w http.ResponseWriter, r *http.Request) {
+	var req LoginRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, `{"error": "Invalid request"}`, http.StatusBadRequest)
 		return
 	}
 
-	token, err := h.service.GenerateToken(user.ID, user.Email)
+	user, err := h.service.Login(req.Email, req.Password, clientInfo(r))
+	var locked *LockedError
+	if errors.As(err, &locked) {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(locked.RetryAfter.Seconds()))))
+		http.Error(w, `{"error": "Too many failed login attempts, try again later"}`, http.StatusTooManyRequests)
+		return
+	}
+	if errors.Is(err, ErrEmailNotVerified) {
+		http.Error(w, `{"error": "Email not verified"}`, http.StatusForbidden)
+		return
+	}
+	if errors.Is(err, ErrAccountDisabled) {
+		http.Error(w, `{"error": "Account disabled"}`, http.StatusForbidden)
+		return
+	}
+	if errors.Is(err, ErrPasswordResetRequired) {
+		http.Error(w, `{"error": "Password reset required, check your email"}`, http.StatusForbidden)
+		return
+	}
+	if errors.Is(err, ErrPasswordLoginDisabled) {
+		http.Error(w, `{"error": "Password login is disabled for this account, sign in with a passkey"}`, http.StatusForbidden)
+		return
+	}
 	if err != nil {
-		http.Error(w, `{"error": "Failed to generate token"}`, http.StatusInternalServerError)
+		http.Error(w, `{"error": "Invalid credentials"}`, http.StatusUnauthorized)
 		return
 	}
 
-	response := map[string]interface{}{
-		"token": token,
-		"email": user.Email,
-		"id":    user.ID,
+	if user.TOTPEnabledAt != nil {
+		challenge, err := h.service.CreateMFAChallenge(user)
+		if err != nil {
+			http.Error(w, `{"error": "Failed to generate token"}`, http.StatusInternalServerError)
+			return
+		}
+		writeMFAChallenge(w, challenge)
+		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	err = json.NewEncoder(w).Encode(response)
+	tokens, err := h.service.IssueTokens(user, clientInfo(r))
 	if err != nil {
+		http.Error(w, `{"error": "Failed to generate token"}`, http.StatusInternalServerError)
 		return
 	}
+
+	h.record(r, audit.LoginSucceeded, user.ID, audit.Metadata{"method": "password"})
+	h.writeTokenResponse(w, r, user, tokens)
 }
 
-func (h *Handler) Login(w http.ResponseWriter, r *http.Request) {
-	var req LoginRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+// Refresh - обмен refresh-токена на новую пару токенов (ротация)
+func (h *Handler) Refresh(w http.ResponseWriter, r *http.Request) {
+	var req RefreshRequest
+	// В режиме cookie тело может быть пустым - токен придёт в cookie
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
 		http.Error(w, `{"error": "Invalid request"}`, http.StatusBadRequest)
 		return
 	}
 
-	user, err := h.service.Login(req.Email, req.Password)
-	if err != nil {
-		http.Error(w, `{"error": "Invalid credentials"}`, http.StatusUnauthorized)
+	if req.RefreshToken == "" && h.service.CookiePolicy().Enabled {
+		// CSRF-токен проверяет CSRFMiddleware на маршруте
+		if c, err := r.Cookie(refreshTokenCookie); err == nil {
+			req.RefreshToken = c.Value
+		}
+	}
+
+	if req.RefreshToken == "" {
+		http.Error(w, `{"error": "Refresh token is required"}`, http.StatusBadRequest)
 		return
 	}
 
-	token, err := h.service.GenerateToken(user.ID, user.Email)
+	user, tokens, err := h.service.RefreshTokens(req.RefreshToken, clientInfo(r))
 	if err != nil {
-		http.Error(w, `{"error": "Failed to generate token"}`, http.StatusInternalServerError)
+		// Недействительный refresh-токен из cookie больше не пригодится
+		if h.cookieMode(r) && (errors.Is(err, ErrRefreshTokenReused) || errors.Is(err, ErrRefreshTokenInvalid)) {
+			h.clearSessionCookies(w)
+		}
+		switch {
+		case errors.Is(err, ErrRefreshTokenReused):
+			log.Printf("⚠️ Refresh token reuse detected, token family revoked")
+			http.Error(w, `{"error": "Refresh token reuse detected"}`, http.StatusUnauthorized)
+		case errors.Is(err, ErrRefreshTokenInvalid):
+			http.Error(w, `{"error": "Invalid refresh token"}`, http.StatusUnauthorized)
+		default:
+			http.Error(w, `{"error": "Failed to refresh token"}`, http.StatusInternalServerError)
+		}
 		return
 	}
 
-	response := map[string]interface{}{
-		"token": token,
-		"email": user.Email,
-		"id":    user.ID,
+	h.writeTokenResponse(w, r, user, tokens)
+}
+
+// Logout - выход из системы: отзывает текущий access-токен и refresh-токены этой сессии
+func (h *Handler) Logout(w http.ResponseWriter, r *http.Request) {
+	claims, ok := GetClaimsFromContext(r.Context())
+	if !ok {
+		http.Error(w, `{"error": "User not authenticated"}`, http.StatusUnauthorized)
+		return
+	}
+
+	if err := h.service.Logout(claims); err != nil {
+		log.Printf("❌ Logout failed for user %d: %v", claims.UserID, err)
+		http.Error(w, `{"error": "Failed to logout"}`, http.StatusInternalServerError)
+		return
+	}
+	h.record(r, audit.Logout, claims.UserID, audit.Metadata{"session_id": claims.SessionID})
+	if h.cookieMode(r) {
+		h.clearSessionCookies(w)
+	}
+
+	response := map[string]string{
+		"message": "Logout successful",
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	err = json.NewEncoder(w).Encode(response)
+	err := json.NewEncoder(w).Encode(response)
 	if err != nil {
 		return
 	}
 }
 
-// Refresh - обновление JWT токена
-func (h *Handler) Refresh(w http.ResponseWriter, r *http.Request) {
-	// Используем AuthMiddleware для проверки токена
-	// Затем генерируем новый токен для того же пользователя
+// LogoutAll - выход на всех устройствах
+func (h *Handler) LogoutAll(w http.ResponseWriter, r *http.Request) {
 	userID, ok := r.Context().Value("userID").(int)
 	if !ok {
 		http.Error(w, `{"error": "User not authenticated"}`, http.StatusUnauthorized)
 		return
 	}
 
-	user, err := h.service.GetUserByID(userID)
+	if err := h.service.RevokeAllSessions(userID); err != nil {
+		log.Printf("❌ Logout everywhere failed for user %d: %v", userID, err)
+		http.Error(w, `{"error": "Failed to logout"}`, http.StatusInternalServerError)
+		return
+	}
+	h.record(r, audit.LogoutAll, userID, nil)
+	if h.cookieMode(r) {
+		h.clearSessionCookies(w)
+	}
+
+	response := map[string]string{
+		"message": "Logged out from all devices",
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err := json.NewEncoder(w).Encode(response)
 	if err != nil {
-		http.Error(w, `{"error": "User not found"}`, http.StatusNotFound)
 		return
 	}
+}
+
+// ForgotPassword - запрос ссылки для сброса пароля.
+// Ответ одинаковый независимо от того, существует ли email
+func (h *Handler) ForgotPassword(w http.ResponseWriter, r *http.Request) {
+	var req ForgotPasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, `{"error": "Invalid request"}`, http.StatusBadRequest)
+		return
+	}
+
+	if req.Email == "" {
+		http.Error(w, `{"error": "Email is required"}`, http.StatusBadRequest)
+		return
+	}
+
+	// Отправляем в фоне, чтобы время ответа не выдавало наличие аккаунта
+	go func(email string) {
+		if err := h.service.RequestPasswordReset(email); err != nil {
+			log.Printf("❌ Password reset request failed: %v", err)
+		}
+	}(req.Email)
 
-	newToken, err := h.service.GenerateToken(user.ID, user.Email)
+	response := map[string]string{
+		"message": "If this email is registered, a password reset link has been sent",
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	err := json.NewEncoder(w).Encode(response)
 	if err != nil {
-		http.Error(w, `{"error": "Failed to generate token"}`, http.StatusInternalServerError)
 		return
 	}
+}
 
-	response := map[string]interface{}{
-		"token": newToken,
-		"email": user.Email,
-		"id":    user.ID,
+// ResetPassword - установка нового пароля по токену из письма
+func (h *Handler) ResetPassword(w http.ResponseWriter, r *http.Request) {
+	var req ResetPasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, `{"error": "Invalid request"}`, http.StatusBadRequest)
+		return
+	}
+
+	if req.Token == "" || req.Password == "" {
+		http.Error(w, `{"error": "Token and password are required"}`, http.StatusBadRequest)
+		return
+	}
+
+	userID, err := h.service.ResetPassword(req.Token, req.Password)
+	if errors.Is(err, ErrResetTokenInvalid) {
+		http.Error(w, `{"error": "Invalid or expired reset token"}`, http.StatusBadRequest)
+		return
+	}
+	var invalid *password.ValidationError
+	if errors.As(err, &invalid) {
+		writeValidationError(w, invalid)
+		return
+	}
+	if err != nil {
+		log.Printf("❌ Password reset failed: %v", err)
+		http.Error(w, `{"error": "Failed to reset password"}`, http.StatusInternalServerError)
+		return
+	}
+	h.record(r, audit.PasswordReset, userID, nil)
+
+	response := map[string]string{
+		"message": "Password has been reset",
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -131,29 +323,110 @@ func (h *Handler) Refresh(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-// Logout - выход из системы (базовая реализация)
-func (h *Handler) Logout(w http.ResponseWriter, r *http.Request) {
-	// В будущем можно добавить blacklist токенов в Redis
-	// Сейчас просто возвращаем успешный ответ
+// VerifyEmail - подтверждение email. GET для перехода по ссылке из письма, POST для фронтенда
+func (h *Handler) VerifyEmail(w http.ResponseWriter, r *http.Request) {
+	token := r.URL.Query().Get("token")
+	if r.Method == http.MethodPost {
+		var req VerifyEmailRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, `{"error": "Invalid request"}`, http.StatusBadRequest)
+			return
+		}
+		token = req.Token
+	}
+
+	if token == "" {
+		http.Error(w, `{"error": "Token is required"}`, http.StatusBadRequest)
+		return
+	}
+
+	err := h.service.VerifyEmail(token)
+	if errors.Is(err, ErrVerifyTokenInvalid) {
+		http.Error(w, `{"error": "Invalid or expired verification token"}`, http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		log.Printf("❌ Email verification failed: %v", err)
+		http.Error(w, `{"error": "Failed to verify email"}`, http.StatusInternalServerError)
+		return
+	}
+
 	response := map[string]string{
-		"message": "Logout successful",
+		"message": "Email verified",
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	err := json.NewEncoder(w).Encode(response)
+	err = json.NewEncoder(w).Encode(response)
 	if err != nil {
 		return
 	}
 }
 
+// ResendVerification - повторная отправка письма с подтверждением
+func (h *Handler) ResendVerification(w http.ResponseWriter, r *http.Request) {
+	var req ResendVerificationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, `{"error": "Invalid request"}`, http.StatusBadRequest)
+		return
+	}
+
+	if req.Email == "" {
+		http.Error(w, `{"error": "Email is required"}`, http.StatusBadRequest)
+		return
+	}
+
+	go func(email string) {
+		if err := h.service.ResendVerificationEmail(email); err != nil {
+			log.Printf("❌ Resending verification email failed: %v", err)
+		}
+	}(req.Email)
+
+	writeVerificationPending(w)
+}
+
+// RequireVerifiedEmail пропускает только пользователей с подтверждённым email.
+// Ставится после AuthMiddleware
+func (h *Handler) RequireVerifiedEmail(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := r.Context().Value("userID").(int)
+		if !ok {
+			http.Error(w, `{"error": "User not authenticated"}`, http.StatusUnauthorized)
+			return
+		}
+
+		user, err := h.service.GetUserByID(userID)
+		if err != nil {
+			http.Error(w, `{"error": "User not found"}`, http.StatusUnauthorized)
+			return
+		}
+
+		if user.EmailVerifiedAt == nil {
+			http.Error(w, `{"error": "Email not verified"}`, http.StatusForbidden)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
 func (h *Handler) AuthMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		log.Println("🔐 AuthMiddleware: Checking authorization...")
 
 		tokenString := r.Header.Get("Authorization")
-		log.Printf("🔐 AuthMiddleware: Token header: %s", tokenString)
-
-		if tokenString == "" {
+		apiKey := r.Header.Get("X-API-Key")
+		// Режим cookie: токен берётся из HttpOnly cookie, изменяющие запросы проверяются на CSRF
+		if tokenString == "" && apiKey == "" && h.service.CookiePolicy().Enabled {
+			if c, err := r.Cookie(accessTokenCookie); err == nil && c.Value != "" {
+				if !h.validCSRF(r) {
+					log.Println("🔐 AuthMiddleware: CSRF check failed")
+					http.Error(w, `{"error": "CSRF token missing or invalid"}`, http.StatusForbidden)
+					return
+				}
+				tokenString = c.Value
+			}
+		}
+		if tokenString == "" && apiKey == "" {
 			log.Println("🔐 AuthMiddleware: No Authorization header")
 			http.Error(w, `{"error": "Authorization header required"}`, http.StatusUnauthorized)
 			return
@@ -163,21 +436,121 @@ func (h *Handler) AuthMiddleware(next http.Handler) http.Handler {
 		if len(tokenString) > 7 && tokenString[:7] == "Bearer " {
 			tokenString = tokenString[7:]
 		}
+		// API-ключ сервисного аккаунта принимается и в X-API-Key, и вместо Bearer-токена
+		if apiKey == "" && IsAPIKey(tokenString) {
+			apiKey = tokenString
+		}
 
-		log.Printf("🔐 AuthMiddleware: Validating token: %s...", tokenString[:10])
-
-		userID, email, err := h.service.ValidateToken(tokenString)
+		var claims *token.Claims
+		var err error
+		if apiKey != "" {
+			claims, err = h.service.AuthenticateAPIKey(apiKey)
+		} else {
+			claims, err = h.service.Authenticate(tokenString)
+		}
+		if errors.Is(err, ErrAPIKeyInvalid) {
+			log.Println("🔐 AuthMiddleware: Invalid API key")
+			http.Error(w, `{"error": "Invalid API key"}`, http.StatusUnauthorized)
+			return
+		}
+		if errors.Is(err, ErrTokenRevoked) {
+			log.Println("🔐 AuthMiddleware: Token revoked")
+			http.Error(w, `{"error": "Token revoked"}`, http.StatusUnauthorized)
+			return
+		}
 		if err != nil {
 			log.Printf("🔐 AuthMiddleware: Token validation failed: %v", err)
 			http.Error(w, `{"error": "Invalid token"}`, http.StatusUnauthorized)
 			return
 		}
 
-		log.Printf("🔐 AuthMiddleware: Token valid - UserID: %d, Email: %s", userID, email)
+		// Токены, выданные до появления client_access, несут client_id в обычном access-токене
+		if claims.ClientID != "" {
+			log.Printf("🚫 AuthMiddleware: Token of OAuth client %s rejected", claims.ClientID)
+			http.Error(w, `{"error": "Token issued to a third-party application"}`, http.StatusForbidden)
+			return
+		}
 
 		ctx := r.Context()
-		ctx = context.WithValue(ctx, "userID", userID)
-		ctx = context.WithValue(ctx, "userEmail", email)
+		ctx = context.WithValue(ctx, claimsContextKey, claims)
+
+		// У сервисного аккаунта нет userID, поэтому эндпоинты "от имени пользователя"
+		// ему недоступны - только маршруты, закрытые правами из его scope
+		if claims.IsServiceAccount() {
+			log.Printf("🔐 AuthMiddleware: Service account %d authenticated", claims.ServiceAccountID)
+			ctx = context.WithValue(ctx, principalContextKey, PrincipalServiceAccount)
+			next.ServeHTTP(w, r.WithContext(ctx))
+			return
+		}
+
+		log.Printf("🔐 AuthMiddleware: Token valid - UserID: %d, Email: %s", claims.UserID, claims.Email)
+
+		ctx = context.WithValue(ctx, principalContextKey, PrincipalUser)
+		ctx = context.WithValue(ctx, "userID", claims.UserID)
+		ctx = context.WithValue(ctx, "userEmail", claims.Email)
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
+
+// writeTokenResponse отдаёт пару токенов. Поле token оставлено для старых фронтендов.
+// В режиме cookie токены уходят в HttpOnly cookie, а в теле - только CSRF-токен
+func (h *Handler) writeTokenResponse(w http.ResponseWriter, r *http.Request, user *User, tokens *TokenPair) {
+	if h.cookieMode(r) {
+		h.writeCookieTokenResponse(w, user, tokens)
+		return
+	}
+
+	response := map[string]interface{}{
+		"token":         tokens.AccessToken,
+		"access_token":  tokens.AccessToken,
+		"refresh_token": tokens.RefreshToken,
+		"token_type":    tokens.TokenType,
+		"expires_in":    tokens.ExpiresIn,
+		"email":         user.Email,
+		"id":            user.ID,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err := json.NewEncoder(w).Encode(response)
+	if err != nil {
+		return
+	}
+}
+
+// writeVerificationPending - единый ответ "проверьте почту", не раскрывающий наличие аккаунта
+func writeVerificationPending(w http.ResponseWriter) {
+	response := map[string]string{
+		"message": "Check your email to confirm the address",
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	err := json.NewEncoder(w).Encode(response)
+	if err != nil {
+		return
+	}
+}
+
+// writeValidationError отвечает 400 со списком ошибок по полям
+func writeValidationError(w http.ResponseWriter, invalid *password.ValidationError) {
+	response := map[string]interface{}{
+		"error":  "Password does not meet requirements",
+		"fields": invalid.Violations,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	err := json.NewEncoder(w).Encode(response)
+	if err != nil {
+		return
+	}
+}
+
+// clientIP - адрес клиента. За прокси RemoteAddr уже подменён middleware.RealIP
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
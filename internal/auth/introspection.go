@@ -0,0 +1,194 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"auth-user-service/internal/token"
+)
+
+var ErrUnsupportedTokenType = errors.New("unsupported token type")
+
+// Типы токенов в ответе интроспекции (те же, что в token_type_hint)
+const (
+	TokenTypeAccess  = "access_token"
+	TokenTypeRefresh = "refresh_token"
+	TokenTypeAPIKey  = "api_key"
+)
+
+// Introspection - ответ RFC 7662. У неактивного токена заполнены только Active
+// и Revoked: остальное о нём вызывающему знать незачем
+type Introspection struct {
+	Active    bool     `json:"active"`
+	Revoked   bool     `json:"revoked,omitempty"`
+	TokenType string   `json:"token_type,omitempty"`
+	Scope     string   `json:"scope,omitempty"`
+	ClientID  string   `json:"client_id,omitempty"`
+	Username  string   `json:"username,omitempty"`
+	Subject   string   `json:"sub,omitempty"`
+	Issuer    string   `json:"iss,omitempty"`
+	Audience  []string `json:"aud,omitempty"`
+	ExpiresAt int64    `json:"exp,omitempty"`
+	IssuedAt  int64    `json:"iat,omitempty"`
+	NotBefore int64    `json:"nbf,omitempty"`
+	ID        string   `json:"jti,omitempty"`
+	SessionID string   `json:"sid,omitempty"`
+	Roles     []string `json:"roles,omitempty"`
+}
+
+// IntrospectToken сообщает, действителен ли токен. Access-токены проверяются тем же
+// Authenticate, что и в AuthMiddleware, поэтому ответ совпадает с тем, пустит ли сервис запрос
+func (s *service) IntrospectToken(tokenString string) (*Introspection, error) {
+	switch {
+	case tokenString == "":
+		return &Introspection{}, nil
+	case IsAPIKey(tokenString):
+		return s.introspectAPIKey(tokenString)
+	case strings.Count(tokenString, ".") == 2:
+		return s.introspectAccessToken(tokenString)
+	default:
+		return s.introspectRefreshToken(tokenString)
+	}
+}
+
+func (s *service) introspectAccessToken(tokenString string) (*Introspection, error) {
+	claims, err := s.Authenticate(tokenString)
+	if errors.Is(err, token.ErrWrongTokenType) {
+		claims, err = s.AuthenticateClientAccess(tokenString)
+	}
+	if errors.Is(err, ErrTokenRevoked) {
+		return &Introspection{Revoked: true}, nil
+	}
+	if errors.Is(err, token.ErrInvalidToken) || errors.Is(err, token.ErrWrongTokenType) {
+		return &Introspection{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	result := &Introspection{
+		Active:    true,
+		TokenType: TokenTypeAccess,
+		Scope:     claims.Scope,
+		ClientID:  claims.ClientID,
+		Username:  claims.Email,
+		Subject:   claims.Subject,
+		Issuer:    claims.Issuer,
+		Audience:  claims.Audience,
+		ID:        claims.ID,
+		SessionID: claims.SessionID,
+		Roles:     claims.Roles,
+	}
+	if claims.ExpiresAt != nil {
+		result.ExpiresAt = claims.ExpiresAt.Unix()
+	}
+	if claims.IssuedAt != nil {
+		result.IssuedAt = claims.IssuedAt.Unix()
+	}
+	if claims.NotBefore != nil {
+		result.NotBefore = claims.NotBefore.Unix()
+	}
+	return result, nil
+}
+
+func (s *service) introspectRefreshToken(tokenString string) (*Introspection, error) {
+	rt, err := s.repo.GetRefreshToken(hashToken(tokenString))
+	if errors.Is(err, ErrRefreshTokenInvalid) {
+		return &Introspection{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Использованный токен уже обменян на новый и повторно не примется
+	if rt.RevokedAt != nil || rt.UsedAt != nil || rt.ExpiresAt.Before(time.Now()) {
+		return &Introspection{Revoked: rt.RevokedAt != nil}, nil
+	}
+
+	user, err := s.repo.GetUserByID(rt.UserID)
+	if errors.Is(err, ErrUserNotFound) {
+		return &Introspection{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if user.DisabledAt != nil {
+		return &Introspection{}, nil
+	}
+
+	return &Introspection{
+		Active:    true,
+		TokenType: TokenTypeRefresh,
+		Scope:     rt.Scope,
+		ClientID:  rt.ClientID,
+		Username:  user.Email,
+		Subject:   strconv.Itoa(user.ID),
+		ExpiresAt: rt.ExpiresAt.Unix(),
+		IssuedAt:  rt.CreatedAt.Unix(),
+		SessionID: rt.FamilyID,
+	}, nil
+}
+
+func (s *service) introspectAPIKey(apiKey string) (*Introspection, error) {
+	account, key, err := s.repo.GetServiceAccountByAPIKey(hashToken(apiKey))
+	if errors.Is(err, ErrAPIKeyInvalid) {
+		return &Introspection{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	result := &Introspection{
+		Active:    true,
+		TokenType: TokenTypeAPIKey,
+		Scope:     strings.Join(account.Scopes, " "),
+		ClientID:  strconv.Itoa(account.ID),
+		Subject:   "service-account:" + strconv.Itoa(account.ID),
+		IssuedAt:  key.CreatedAt.Unix(),
+		SessionID: key.ID,
+	}
+	if key.ExpiresAt != nil {
+		result.ExpiresAt = key.ExpiresAt.Unix()
+	}
+	return result, nil
+}
+
+// RevokeToken отзывает токен по RFC 7009. Недействительный или неизвестный токен
+// ошибкой не считается: результат для вызывающего тот же - токен не работает.
+// Отзыв refresh-токена завершает всю его сессию вместе с access-токенами.
+// API-ключи отзываются только через админские эндпоинты
+func (s *service) RevokeToken(tokenString string) error {
+	ctx := context.Background()
+
+	switch {
+	case tokenString == "":
+		return nil
+	case IsAPIKey(tokenString):
+		return ErrUnsupportedTokenType
+	case strings.Count(tokenString, ".") == 2:
+		claims, err := s.tokens.Parse(tokenString, token.TypeAccess)
+		if errors.Is(err, token.ErrWrongTokenType) {
+			claims, err = s.tokens.Parse(tokenString, token.TypeClientAccess)
+		}
+		if err != nil || claims.ID == "" || claims.ExpiresAt == nil {
+			return nil
+		}
+		return s.revocations.RevokeToken(ctx, claims.ID, time.Until(claims.ExpiresAt.Time))
+	}
+
+	rt, err := s.repo.GetRefreshToken(hashToken(tokenString))
+	if errors.Is(err, ErrRefreshTokenInvalid) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := s.repo.RevokeTokenFamily(rt.FamilyID); err != nil {
+		return err
+	}
+	return s.revocations.RevokeSession(ctx, rt.FamilyID, s.tokens.AccessTTL())
+}
@@ -0,0 +1,99 @@
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"auth-user-service/internal/token"
+)
+
+// IntrospectToken - POST /oauth/introspect (RFC 7662) для шлюза и других сервисов.
+// Нужен сервисный аккаунт с правом tokens:introspect
+func (h *Handler) IntrospectToken(w http.ResponseWriter, r *http.Request) {
+	client, ok := h.authenticateMachineClient(w, r, "tokens:introspect")
+	if !ok {
+		return
+	}
+
+	result, err := h.service.IntrospectToken(r.PostForm.Get("token"))
+	if err != nil {
+		log.Printf("❌ Token introspection for service account %d failed: %v", client.ServiceAccountID, err)
+		writeOAuthError(w, http.StatusInternalServerError, "server_error")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	err = json.NewEncoder(w).Encode(result)
+	if err != nil {
+		return
+	}
+}
+
+// RevokeToken - POST /oauth/revoke (RFC 7009). Нужен сервисный аккаунт с правом tokens:revoke.
+// На неизвестный токен тоже отвечает 200
+func (h *Handler) RevokeToken(w http.ResponseWriter, r *http.Request) {
+	client, ok := h.authenticateMachineClient(w, r, "tokens:revoke")
+	if !ok {
+		return
+	}
+
+	err := h.service.RevokeToken(r.PostForm.Get("token"))
+	if errors.Is(err, ErrUnsupportedTokenType) {
+		writeOAuthError(w, http.StatusBadRequest, "unsupported_token_type")
+		return
+	}
+	if err != nil {
+		log.Printf("❌ Token revocation by service account %d failed: %v", client.ServiceAccountID, err)
+		writeOAuthError(w, http.StatusServiceUnavailable, "temporarily_unavailable")
+		return
+	}
+
+	log.Printf("🔐 Service account %d revoked a token", client.ServiceAccountID)
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+}
+
+// authenticateMachineClient проверяет вызывающий сервисный аккаунт: client_id и API-ключ
+// в Basic-авторизации или в форме, либо Bearer-токен (API-ключ или access-токен,
+// полученный через client_credentials). Аккаунту нужно право scope
+func (h *Handler) authenticateMachineClient(w http.ResponseWriter, r *http.Request, scope string) (*token.Claims, bool) {
+	if err := r.ParseForm(); err != nil {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_request")
+		return nil, false
+	}
+
+	var claims *token.Claims
+	var err error
+	if clientID, clientSecret, ok := r.BasicAuth(); ok {
+		clientID, _ = url.QueryUnescape(clientID)
+		clientSecret, _ = url.QueryUnescape(clientSecret)
+		claims, err = h.service.AuthenticateServiceAccount(clientID, clientSecret)
+	} else if clientSecret := r.PostForm.Get("client_secret"); clientSecret != "" {
+		claims, err = h.service.AuthenticateServiceAccount(r.PostForm.Get("client_id"), clientSecret)
+	} else if bearer := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "); bearer != "" && bearer != r.Header.Get("Authorization") {
+		if IsAPIKey(bearer) {
+			claims, err = h.service.AuthenticateAPIKey(bearer)
+		} else {
+			claims, err = h.service.Authenticate(bearer)
+		}
+	} else {
+		err = ErrAPIKeyInvalid
+	}
+
+	if err != nil || !claims.IsServiceAccount() {
+		w.Header().Set("WWW-Authenticate", `Basic realm="oauth"`)
+		writeOAuthError(w, http.StatusUnauthorized, "invalid_client")
+		return nil, false
+	}
+	if !containsScope(strings.Fields(claims.Scope), scope) {
+		log.Printf("🚫 Service account %d denied %s", claims.ServiceAccountID, scope)
+		writeOAuthError(w, http.StatusForbidden, "insufficient_scope")
+		return nil, false
+	}
+	return claims, true
+}
@@ -0,0 +1,199 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"auth-user-service/internal/redis"
+)
+
+// ErrTooManyAttempts - вход временно заблокирован после серии неудачных попыток
+var ErrTooManyAttempts = errors.New("too many failed login attempts")
+
+// LockedError сообщает, через сколько можно повторить попытку входа
+type LockedError struct {
+	RetryAfter time.Duration
+}
+
+func (e *LockedError) Error() string {
+	return fmt.Sprintf("%s, retry after %s", ErrTooManyAttempts, e.RetryAfter)
+}
+
+func (e *LockedError) Unwrap() error {
+	return ErrTooManyAttempts
+}
+
+// LockoutPolicy - ограничения на неудачные попытки входа.
+//
+// После MaxAccountFailures неудач по одному email (или MaxIPFailures с одного IP)
+// за FailureWindow вход блокируется на BaseLockout, каждая следующая неудача
+// удваивает блокировку, но не дольше MaxLockout. Блокировка всегда временная,
+// а сброс пароля по email снимает блокировку аккаунта, поэтому злоумышленник
+// не может навсегда закрыть владельцу доступ. Нулевой порог отключает проверку.
+type LockoutPolicy struct {
+	MaxAccountFailures int
+	MaxIPFailures      int
+	FailureWindow      time.Duration
+	BaseLockout        time.Duration
+	MaxLockout         time.Duration
+}
+
+// lockoutDuration - длительность блокировки после failures неудач при пороге limit
+func (p LockoutPolicy) lockoutDuration(failures, limit int) time.Duration {
+	if limit <= 0 || failures < limit {
+		return 0
+	}
+
+	d := p.BaseLockout
+	for i := limit; i < failures && d < p.MaxLockout; i++ {
+		d *= 2
+	}
+	if d > p.MaxLockout {
+		d = p.MaxLockout
+	}
+	return d
+}
+
+// LoginAttemptStore - счётчики неудачных попыток входа и блокировки.
+// Ключи имеют вид "account:<email>" и "ip:<адрес>"
+type LoginAttemptStore interface {
+	// RegisterFailure увеличивает счётчик неудач и возвращает его новое значение
+	RegisterFailure(ctx context.Context, key string, window time.Duration) (int, error)
+	ResetFailures(ctx context.Context, key string) error
+	Lock(ctx context.Context, key string, duration time.Duration) error
+	// LockedFor возвращает оставшееся время блокировки, 0 если её нет
+	LockedFor(ctx context.Context, key string) (time.Duration, error)
+}
+
+// NewLoginAttemptStore возвращает хранилище в Redis, а если Redis не подключен -
+// в памяти процесса. Без Redis счётчики у каждого инстанса свои и сбрасываются при рестарте
+func NewLoginAttemptStore(redisClient *redis.Client) LoginAttemptStore {
+	if redisClient == nil {
+		log.Println("⚠️ Redis unavailable: login attempt counters are kept in memory of this instance only")
+		return newMemoryLoginAttemptStore()
+	}
+	return &redisLoginAttemptStore{redis: redisClient}
+}
+
+func accountLockoutKey(email string) string {
+	return "account:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+func ipLockoutKey(ip string) string {
+	return "ip:" + ip
+}
+
+type redisLoginAttemptStore struct {
+	redis *redis.Client
+}
+
+func loginFailuresKey(key string) string {
+	return fmt.Sprintf("login_failures:%s", key)
+}
+
+func loginLockKey(key string) string {
+	return fmt.Sprintf("login_lock:%s", key)
+}
+
+func (s *redisLoginAttemptStore) RegisterFailure(ctx context.Context, key string, window time.Duration) (int, error) {
+	n, err := s.redis.Incr(ctx, loginFailuresKey(key), window)
+	return int(n), err
+}
+
+func (s *redisLoginAttemptStore) ResetFailures(ctx context.Context, key string) error {
+	if err := s.redis.Delete(ctx, loginFailuresKey(key)); err != nil {
+		return err
+	}
+	return s.redis.Delete(ctx, loginLockKey(key))
+}
+
+func (s *redisLoginAttemptStore) Lock(ctx context.Context, key string, duration time.Duration) error {
+	return s.redis.Set(ctx, loginLockKey(key), true, duration)
+}
+
+func (s *redisLoginAttemptStore) LockedFor(ctx context.Context, key string) (time.Duration, error) {
+	return s.redis.TTL(ctx, loginLockKey(key))
+}
+
+type memoryLoginAttemptStore struct {
+	mu       sync.Mutex
+	failures map[string]memoryCounter
+	locks    map[string]time.Time
+}
+
+type memoryCounter struct {
+	count     int
+	expiresAt time.Time
+}
+
+func newMemoryLoginAttemptStore() *memoryLoginAttemptStore {
+	return &memoryLoginAttemptStore{
+		failures: make(map[string]memoryCounter),
+		locks:    make(map[string]time.Time),
+	}
+}
+
+func (s *memoryLoginAttemptStore) RegisterFailure(_ context.Context, key string, window time.Duration) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.cleanup()
+	counter, ok := s.failures[key]
+	if !ok {
+		counter.expiresAt = time.Now().Add(window)
+	}
+	counter.count++
+	s.failures[key] = counter
+	return counter.count, nil
+}
+
+func (s *memoryLoginAttemptStore) ResetFailures(_ context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.failures, key)
+	delete(s.locks, key)
+	return nil
+}
+
+func (s *memoryLoginAttemptStore) Lock(_ context.Context, key string, duration time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.locks[key] = time.Now().Add(duration)
+	return nil
+}
+
+func (s *memoryLoginAttemptStore) LockedFor(_ context.Context, key string) (time.Duration, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	until, ok := s.locks[key]
+	if !ok {
+		return 0, nil
+	}
+	if left := time.Until(until); left > 0 {
+		return left, nil
+	}
+	return 0, nil
+}
+
+// cleanup удаляет истёкшие счётчики и блокировки. Вызывается под mu
+func (s *memoryLoginAttemptStore) cleanup() {
+	now := time.Now()
+	for key, counter := range s.failures {
+		if now.After(counter.expiresAt) {
+			delete(s.failures, key)
+		}
+	}
+	for key, until := range s.locks {
+		if now.After(until) {
+			delete(s.locks, key)
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+	"time"
+
+	"auth-user-service/internal/notify"
+)
+
+// RequestMagicLink отправляет одноразовую ссылку для входа без пароля.
+// Для неизвестного email ссылка уходит, только если включена авторегистрация,
+// иначе, как и RequestPasswordReset, молча ничего не делает
+func (s *service) RequestMagicLink(email string) error {
+	email = strings.TrimSpace(email)
+
+	user, err := s.repo.GetUserByEmail(email)
+	switch {
+	case errors.Is(err, ErrUserNotFound) && !s.cfg.MagicLinkAutoRegister:
+		return nil
+	case errors.Is(err, ErrUserNotFound):
+		// Новый адрес: аккаунт создастся при переходе по ссылке
+	case err != nil:
+		return err
+	case user.DisabledAt != nil:
+		return nil
+	}
+
+	token, tokenHash, err := newOpaqueToken()
+	if err != nil {
+		return err
+	}
+
+	if err := s.repo.SaveMagicLinkToken(email, tokenHash, time.Now().Add(s.cfg.MagicLinkTTL)); err != nil {
+		return err
+	}
+
+	subject, intro := "Вход в аккаунт", "Чтобы войти в аккаунт"
+	if user == nil {
+		subject, intro = "Регистрация", "Чтобы завершить регистрацию и войти"
+	}
+
+	return s.notifier.Send(context.Background(), notify.Message{
+		To:      email,
+		Subject: subject,
+		Body: fmt.Sprintf(
+			"%s, перейдите по ссылке: %s/magic-link?token=%s\nСсылка одноразовая и действует %s. Если вы не запрашивали вход, просто проигнорируйте это письмо.",
+			intro, s.cfg.FrontendURL, url.QueryEscape(token), s.cfg.MagicLinkTTL,
+		),
+	})
+}
+
+// ConsumeMagicLink гасит ссылку и возвращает пользователя для выдачи токенов.
+// Переход по ссылке доказывает владение адресом, поэтому email считается подтверждённым
+func (s *service) ConsumeMagicLink(token string) (*User, error) {
+	email, err := s.repo.ConsumeMagicLinkToken(hashToken(token))
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := s.repo.GetUserByEmail(email)
+	if errors.Is(err, ErrUserNotFound) {
+		// Ссылку выслали на неизвестный адрес только при включённой авторегистрации,
+		// но флаг могли выключить, пока письмо шло
+		if !s.cfg.MagicLinkAutoRegister {
+			return nil, ErrMagicLinkInvalid
+		}
+		user, err = s.registerPasswordless(email, "", "")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if user.DisabledAt != nil {
+		return nil, ErrAccountDisabled
+	}
+
+	if user.PasswordResetRequired {
+		return nil, ErrPasswordResetRequired
+	}
+
+	if user.EmailVerifiedAt == nil {
+		if err := s.repo.MarkEmailVerified(user.ID); err != nil {
+			return nil, err
+		}
+		now := time.Now()
+		user.EmailVerifiedAt = &now
+	}
+
+	s.resetLoginFailures(user.Email)
+
+	return user, nil
+}
+
+// registerPasswordless создаёт аккаунт без пароля (вход по ссылке или через провайдера).
+// В password_hash пишется хэш случайного значения, которое никто не знает:
+// задать пароль можно через восстановление
+func (s *service) registerPasswordless(email, firstName, lastName string) (*User, error) {
+	secret, _, err := newOpaqueToken()
+	if err != nil {
+		return nil, err
+	}
+	hashedPassword, err := s.passwords.Hash(secret)
+	if err != nil {
+		return nil, err
+	}
+
+	userID, err := s.repo.CreateUser(email, hashedPassword, firstName, lastName)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("✅ User %d registered without password", userID)
+	return s.repo.GetUserByID(userID)
+}
@@ -0,0 +1,93 @@
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"auth-user-service/internal/audit"
+)
+
+type MagicLinkRequest struct {
+	Email string `json:"email"`
+}
+
+// RequestMagicLink - запрос ссылки для входа без пароля.
+// Ответ одинаковый независимо от того, существует ли email
+func (h *Handler) RequestMagicLink(w http.ResponseWriter, r *http.Request) {
+	var req MagicLinkRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, `{"error": "Invalid request"}`, http.StatusBadRequest)
+		return
+	}
+
+	if req.Email == "" {
+		http.Error(w, `{"error": "Email is required"}`, http.StatusBadRequest)
+		return
+	}
+
+	// Отправляем в фоне, чтобы время ответа не выдавало наличие аккаунта
+	go func(email string) {
+		if err := h.service.RequestMagicLink(email); err != nil {
+			log.Printf("❌ Magic link request failed: %v", err)
+		}
+	}(req.Email)
+
+	response := map[string]string{
+		"message": "If this email can be used to sign in, a login link has been sent",
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	err := json.NewEncoder(w).Encode(response)
+	if err != nil {
+		return
+	}
+}
+
+// ConsumeMagicLink - вход по ссылке из письма. Ответ тот же, что у Login
+func (h *Handler) ConsumeMagicLink(w http.ResponseWriter, r *http.Request) {
+	token := r.URL.Query().Get("token")
+	if token == "" {
+		http.Error(w, `{"error": "Token is required"}`, http.StatusBadRequest)
+		return
+	}
+
+	user, err := h.service.ConsumeMagicLink(token)
+	switch {
+	case errors.Is(err, ErrMagicLinkInvalid):
+		http.Error(w, `{"error": "Invalid or expired login link"}`, http.StatusBadRequest)
+		return
+	case errors.Is(err, ErrAccountDisabled):
+		http.Error(w, `{"error": "Account disabled"}`, http.StatusForbidden)
+		return
+	case errors.Is(err, ErrPasswordResetRequired):
+		http.Error(w, `{"error": "Password reset required, check your email"}`, http.StatusForbidden)
+		return
+	case err != nil:
+		log.Printf("❌ Magic link login failed: %v", err)
+		http.Error(w, `{"error": "Failed to login"}`, http.StatusInternalServerError)
+		return
+	}
+
+	// Ссылка заменяет только пароль, второй фактор по-прежнему нужен
+	if user.TOTPEnabledAt != nil {
+		challenge, err := h.service.CreateMFAChallenge(user)
+		if err != nil {
+			http.Error(w, `{"error": "Failed to generate token"}`, http.StatusInternalServerError)
+			return
+		}
+		writeMFAChallenge(w, challenge)
+		return
+	}
+
+	tokens, err := h.service.IssueTokens(user, clientInfo(r))
+	if err != nil {
+		http.Error(w, `{"error": "Failed to generate token"}`, http.StatusInternalServerError)
+		return
+	}
+
+	h.record(r, audit.LoginSucceeded, user.ID, audit.Metadata{"method": "magic_link"})
+	h.writeTokenResponse(w, r, user, tokens)
+}
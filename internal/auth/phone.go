@@ -0,0 +1,116 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"auth-user-service/internal/sms"
+)
+
+var (
+	ErrPhoneMissing         = errors.New("no phone number in profile")
+	ErrPhoneAlreadyVerified = errors.New("phone already verified")
+)
+
+// Назначения SMS-кодов: код подтверждения номера не подойдёт для входа
+const phoneLoginPurpose = "login"
+
+func phoneVerifyPurpose(userID int) string {
+	return fmt.Sprintf("verify:%d", userID)
+}
+
+// SendPhoneVerification отправляет код на номер из профиля
+func (s *service) SendPhoneVerification(userID int) error {
+	phone, err := s.profilePhone(userID)
+	if err != nil {
+		return err
+	}
+
+	return s.phoneOTP.Send(context.Background(), phoneVerifyPurpose(userID), phone,
+		"Код подтверждения номера: %s. Никому его не сообщайте.")
+}
+
+// ConfirmPhone подтверждает номер из профиля кодом из SMS. После этого по номеру можно входить
+func (s *service) ConfirmPhone(userID int, code string) error {
+	phone, err := s.profilePhone(userID)
+	if err != nil {
+		return err
+	}
+
+	if err := s.phoneOTP.Verify(context.Background(), phoneVerifyPurpose(userID), phone, code); err != nil {
+		return err
+	}
+	return s.repo.MarkPhoneVerified(userID, phone)
+}
+
+// RequestPhoneLogin отправляет код для входа. Для номера, не подтверждённого ни одним
+// аккаунтом, как и RequestMagicLink, молча ничего не делает
+func (s *service) RequestPhoneLogin(phone string) error {
+	phone, err := sms.NormalizePhone(phone)
+	if err != nil {
+		return err
+	}
+
+	user, err := s.repo.GetUserByPhone(phone)
+	if errors.Is(err, ErrUserNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if user.DisabledAt != nil {
+		return nil
+	}
+
+	return s.phoneOTP.Send(context.Background(), phoneLoginPurpose, phone,
+		"Код для входа: %s. Никому его не сообщайте, даже сотрудникам магазина.")
+}
+
+// PhoneLogin - вход по номеру и коду из SMS. Код заменяет пароль, поэтому
+// работает и при входе только по passkey, а второй фактор по-прежнему нужен
+func (s *service) PhoneLogin(phone, code string) (*User, error) {
+	phone, err := sms.NormalizePhone(phone)
+	if err != nil {
+		return nil, sms.ErrCodeInvalid
+	}
+
+	if err := s.phoneOTP.Verify(context.Background(), phoneLoginPurpose, phone, code); err != nil {
+		return nil, err
+	}
+
+	user, err := s.repo.GetUserByPhone(phone)
+	if errors.Is(err, ErrUserNotFound) {
+		// Номер отвязали, пока шла SMS
+		return nil, sms.ErrCodeInvalid
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if user.DisabledAt != nil {
+		return nil, ErrAccountDisabled
+	}
+	if user.PasswordResetRequired {
+		return nil, ErrPasswordResetRequired
+	}
+
+	s.resetLoginFailures(user.Email)
+
+	return user, nil
+}
+
+// profilePhone - нормализованный, ещё не подтверждённый номер из профиля
+func (s *service) profilePhone(userID int) (string, error) {
+	phone, verifiedAt, err := s.repo.GetUserPhone(userID)
+	if err != nil {
+		return "", err
+	}
+	if phone == "" {
+		return "", ErrPhoneMissing
+	}
+	if verifiedAt != nil {
+		return "", ErrPhoneAlreadyVerified
+	}
+	return sms.NormalizePhone(phone)
+}
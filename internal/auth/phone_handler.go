@@ -0,0 +1,203 @@
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+
+	"auth-user-service/internal/audit"
+	"auth-user-service/internal/sms"
+)
+
+type PhoneCodeRequest struct {
+	Code string `json:"code"`
+}
+
+type PhoneLoginCodeRequest struct {
+	Phone string `json:"phone"`
+}
+
+type PhoneLoginRequest struct {
+	Phone string `json:"phone"`
+	Code  string `json:"code"`
+}
+
+// SendPhoneVerification - SMS с кодом на номер из профиля
+func (h *Handler) SendPhoneVerification(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int)
+	if !ok {
+		http.Error(w, `{"error": "User not authenticated"}`, http.StatusUnauthorized)
+		return
+	}
+
+	err := h.service.SendPhoneVerification(userID)
+	var throttled *sms.ThrottledError
+	switch {
+	case errors.As(err, &throttled):
+		writeThrottled(w, throttled)
+		return
+	case errors.Is(err, ErrPhoneMissing):
+		http.Error(w, `{"error": "Add a phone number to your profile first"}`, http.StatusBadRequest)
+		return
+	case errors.Is(err, sms.ErrInvalidPhone):
+		http.Error(w, `{"error": "Invalid phone number in profile"}`, http.StatusBadRequest)
+		return
+	case errors.Is(err, ErrPhoneAlreadyVerified):
+		http.Error(w, `{"error": "Phone already verified"}`, http.StatusConflict)
+		return
+	case err != nil:
+		log.Printf("❌ Failed to send phone verification to user %d: %v", userID, err)
+		http.Error(w, `{"error": "Failed to send code"}`, http.StatusInternalServerError)
+		return
+	}
+
+	response := map[string]string{
+		"message": "Verification code sent",
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		return
+	}
+}
+
+// ConfirmPhone - подтверждение номера кодом из SMS
+func (h *Handler) ConfirmPhone(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int)
+	if !ok {
+		http.Error(w, `{"error": "User not authenticated"}`, http.StatusUnauthorized)
+		return
+	}
+
+	var req PhoneCodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, `{"error": "Invalid request"}`, http.StatusBadRequest)
+		return
+	}
+
+	err := h.service.ConfirmPhone(userID, req.Code)
+	switch {
+	case errors.Is(err, sms.ErrCodeInvalid):
+		http.Error(w, `{"error": "Invalid or expired code"}`, http.StatusBadRequest)
+		return
+	case errors.Is(err, ErrPhoneMissing), errors.Is(err, sms.ErrInvalidPhone):
+		http.Error(w, `{"error": "Add a phone number to your profile first"}`, http.StatusBadRequest)
+		return
+	case errors.Is(err, ErrPhoneAlreadyVerified):
+		http.Error(w, `{"error": "Phone already verified"}`, http.StatusConflict)
+		return
+	case errors.Is(err, ErrPhoneTaken):
+		http.Error(w, `{"error": "Phone is already used by another account"}`, http.StatusConflict)
+		return
+	case err != nil:
+		log.Printf("❌ Failed to confirm phone of user %d: %v", userID, err)
+		http.Error(w, `{"error": "Failed to verify phone"}`, http.StatusInternalServerError)
+		return
+	}
+
+	if err := h.profiles.InvalidateProfile(userID); err != nil {
+		log.Printf("⚠️ Failed to invalidate profile cache for user %d: %v", userID, err)
+	}
+
+	log.Printf("📱 User %d verified phone", userID)
+	h.record(r, audit.PhoneVerified, userID, nil)
+
+	response := map[string]string{
+		"message": "Phone verified",
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		return
+	}
+}
+
+// RequestPhoneLogin - SMS с кодом для входа. Ответ одинаковый независимо от того,
+// подтверждён ли номер каким-либо аккаунтом
+func (h *Handler) RequestPhoneLogin(w http.ResponseWriter, r *http.Request) {
+	var req PhoneLoginCodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, `{"error": "Invalid request"}`, http.StatusBadRequest)
+		return
+	}
+
+	if _, err := sms.NormalizePhone(req.Phone); err != nil {
+		http.Error(w, `{"error": "Invalid phone number"}`, http.StatusBadRequest)
+		return
+	}
+
+	// Отправляем в фоне, чтобы время ответа не выдавало наличие аккаунта
+	go func(phone string) {
+		if err := h.service.RequestPhoneLogin(phone); err != nil {
+			log.Printf("❌ Phone login code request failed: %v", err)
+		}
+	}(req.Phone)
+
+	response := map[string]string{
+		"message": "If this phone can be used to sign in, a code has been sent",
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	err := json.NewEncoder(w).Encode(response)
+	if err != nil {
+		return
+	}
+}
+
+// PhoneLogin - вход по номеру и коду из SMS. Ответ тот же, что у Login
+func (h *Handler) PhoneLogin(w http.ResponseWriter, r *http.Request) {
+	var req PhoneLoginRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, `{"error": "Invalid request"}`, http.StatusBadRequest)
+		return
+	}
+
+	user, err := h.service.PhoneLogin(req.Phone, req.Code)
+	switch {
+	case errors.Is(err, sms.ErrCodeInvalid):
+		http.Error(w, `{"error": "Invalid or expired code"}`, http.StatusUnauthorized)
+		return
+	case errors.Is(err, ErrAccountDisabled):
+		http.Error(w, `{"error": "Account disabled"}`, http.StatusForbidden)
+		return
+	case errors.Is(err, ErrPasswordResetRequired):
+		http.Error(w, `{"error": "Password reset required, check your email"}`, http.StatusForbidden)
+		return
+	case err != nil:
+		log.Printf("❌ Phone login failed: %v", err)
+		http.Error(w, `{"error": "Failed to login"}`, http.StatusInternalServerError)
+		return
+	}
+
+	// Код заменяет только пароль, второй фактор по-прежнему нужен
+	if user.TOTPEnabledAt != nil {
+		challenge, err := h.service.CreateMFAChallenge(user)
+		if err != nil {
+			http.Error(w, `{"error": "Failed to generate token"}`, http.StatusInternalServerError)
+			return
+		}
+		writeMFAChallenge(w, challenge)
+		return
+	}
+
+	tokens, err := h.service.IssueTokens(user, clientInfo(r))
+	if err != nil {
+		http.Error(w, `{"error": "Failed to generate token"}`, http.StatusInternalServerError)
+		return
+	}
+
+	h.record(r, audit.LoginSucceeded, user.ID, audit.Metadata{"method": "phone"})
+	h.writeTokenResponse(w, r, user, tokens)
+}
+
+func writeThrottled(w http.ResponseWriter, throttled *sms.ThrottledError) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(throttled.RetryAfter.Seconds()))))
+	http.Error(w, `{"error": "Too many codes requested, try again later"}`, http.StatusTooManyRequests)
+}
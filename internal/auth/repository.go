@@ -4,6 +4,10 @@ import (
 	"database/sql"
 	"errors"
 	"time"
+
+	"auth-user-service/internal/webauthn"
+
+	"github.com/lib/pq"
 )
 
 // Repository интерфейс - определяем контракт
@@ -12,11 +16,93 @@ type Repository interface {
 	GetUserByEmail(email string) (*User, error)
 	GetUserByID(id int) (*User, error)
 	UserExists(email string) (bool, error)
-	SaveRefreshToken(userID int, token string, expiresAt time.Time) error
-	GetUserByRefreshToken(token string) (*User, error)
-	DeleteRefreshToken(token string) error
+	SaveRefreshToken(userID int, tokenHash, familyID string, expiresAt time.Time) error
+	GetUserByRefreshToken(tokenHash string) (*User, error)
+	RotateRefreshToken(oldHash, newHash, clientID string, expiresAt time.Time) (*RefreshToken, error)
+	GetRefreshToken(tokenHash string) (*RefreshToken, error)
+	RevokeTokenFamily(familyID string) error
+	RevokeUserRefreshTokens(userID int) error
+	CreateSession(session *Session) error
+	TouchSession(sessionID, ipAddress, userAgent string, expiresAt time.Time) error
+	ListSessions(userID int) ([]Session, error)
+	GetSessionHistory(userID int, userAgent string) (hasSessions, hasUserAgent bool, err error)
+	RevokeSession(userID int, sessionID string) error
+	DeleteRefreshToken(tokenHash string) error
+	UpdatePassword(userID int, passwordHash string) error
+	UpdatePasswordHash(userID int, passwordHash string) error
+	SavePasswordResetToken(userID int, tokenHash string, expiresAt time.Time) error
+	GetPasswordResetTokenUser(tokenHash string) (int, error)
+	HasRecentPasswordResetToken(userID int, since time.Time) (bool, error)
+	ConsumePasswordResetToken(tokenHash string) (int, error)
+	SaveEmailVerificationToken(userID int, tokenHash string, expiresAt time.Time) error
+	ConsumeEmailVerificationToken(tokenHash string) (int, error)
+	MarkEmailVerified(userID int) error
+	SaveEmailChangeRequest(userID int, newEmail, tokenHash string, expiresAt time.Time) error
+	ConfirmEmailChange(tokenHash string) (*EmailChange, error)
+	SaveMagicLinkToken(email, tokenHash string, expiresAt time.Time) error
+	ConsumeMagicLinkToken(tokenHash string) (string, error)
+	SaveDeletionToken(userID int, tokenHash string, expiresAt time.Time) error
+	ConsumeDeletionToken(userID int, tokenHash string) error
+	GetUserByIdentity(provider, subject string) (*User, error)
+	LinkIdentity(userID int, provider, subject, email string) error
+	TouchIdentity(provider, subject, email string) error
+	ListIdentities(userID int) ([]LinkedIdentity, error)
+	UnlinkIdentity(userID int, provider string) error
+	GetTOTPSecret(userID int) (secret string, lastStep int64, err error)
+	SetPendingTOTPSecret(userID int, secret string) error
+	EnableTOTP(userID int) error
+	DisableTOTP(userID int) error
+	AdvanceTOTPStep(userID int, step int64) (bool, error)
+	ReplaceRecoveryCodes(userID int, codeHashes []string) error
+	GetUnusedRecoveryCodes(userID int) ([]RecoveryCode, error)
+	UseRecoveryCode(codeID int) (bool, error)
+	SetUserDisabled(userID int, disabled bool) error
+	RequirePasswordReset(userID int) error
+	CreateServiceAccount(account *ServiceAccount) error
+	ListServiceAccounts() ([]ServiceAccount, error)
+	DisableServiceAccount(id int) ([]string, error)
+	ExistingPermissions(names []string) ([]string, error)
+	CreateAPIKey(key *APIKey, keyHash string) error
+	ListAPIKeys(serviceAccountID int) ([]APIKey, error)
+	RevokeAPIKey(serviceAccountID int, keyID string) error
+	GetServiceAccountByAPIKey(keyHash string) (*ServiceAccount, *APIKey, error)
+	TouchAPIKey(keyID string) error
+	SaveWebAuthnCredential(userID int, name string, credential *webauthn.Credential) error
+	ListWebAuthnCredentials(userID int) ([]Passkey, error)
+	GetWebAuthnCredential(credentialID []byte) (*Passkey, error)
+	UpdateWebAuthnCredential(id int, signCount uint32, backedUp bool) error
+	DeleteWebAuthnCredential(userID, id int) error
+	SetPasskeyOnly(userID int, enabled bool) error
+	GetUserPhone(userID int) (phone string, verifiedAt *time.Time, err error)
+	MarkPhoneVerified(userID int, phone string) error
+	GetUserByPhone(phone string) (*User, error)
 }
 
+var (
+	ErrUserNotFound        = errors.New("user not found")
+	ErrRefreshTokenInvalid = errors.New("invalid or expired refresh token")
+	ErrRefreshTokenReused  = errors.New("refresh token reuse detected")
+	ErrResetTokenInvalid   = errors.New("invalid or expired reset token")
+	ErrVerifyTokenInvalid  = errors.New("invalid or expired verification token")
+	ErrEmailChangeInvalid  = errors.New("invalid or expired email change token")
+	ErrEmailTaken          = errors.New("email already in use")
+	ErrSessionNotFound     = errors.New("session not found")
+	ErrMagicLinkInvalid    = errors.New("invalid or expired magic link")
+	ErrIdentityLinked      = errors.New("external account already linked")
+	ErrIdentityNotFound    = errors.New("external account not linked")
+
+	ErrServiceAccountNotFound = errors.New("service account not found")
+	ErrAPIKeyNotFound         = errors.New("api key not found")
+	ErrAPIKeyInvalid          = errors.New("invalid, expired or revoked api key")
+
+	ErrPasskeyNotFound   = errors.New("passkey not found")
+	ErrPasskeyRegistered = errors.New("passkey already registered")
+
+	ErrPhoneTaken = errors.New("phone already verified by another account")
+
+	ErrDeletionTokenInvalid = errors.New("invalid or expired account deletion token")
+)
+
 // PostgreSQL реализация
 type postgresRepository struct {
 	db *sql.DB
@@ -24,13 +110,106 @@ type postgresRepository struct {
 
 // User представляет пользователя системы
 type User struct {
-	ID           int       `json:"id"`
-	Email        string    `json:"email"`
-	PasswordHash string    `json:"-"`
-	FirstName    string    `json:"first_name,omitempty"`
-	LastName     string    `json:"last_name,omitempty"`
-	CreatedAt    time.Time `json:"created_at"`
-	UpdatedAt    time.Time `json:"updated_at"`
+	ID                    int        `json:"id"`
+	Email                 string     `json:"email"`
+	PasswordHash          string     `json:"-"`
+	FirstName             string     `json:"first_name,omitempty"`
+	LastName              string     `json:"last_name,omitempty"`
+	EmailVerifiedAt       *time.Time `json:"email_verified_at,omitempty"`
+	TOTPEnabledAt         *time.Time `json:"-"`
+	DisabledAt            *time.Time `json:"-"`
+	PasswordResetRequired bool       `json:"-"`
+	PasskeyOnly           bool       `json:"passkey_only"`
+	CreatedAt             time.Time  `json:"created_at"`
+	UpdatedAt             time.Time  `json:"updated_at"`
+}
+
+// RefreshToken - запись из auth_tokens. Сам токен не хранится, только его хеш
+type RefreshToken struct {
+	ID        int
+	UserID    int
+	TokenHash string
+	FamilyID  string
+	ExpiresAt time.Time
+	UsedAt    *time.Time
+	RevokedAt *time.Time
+	CreatedAt time.Time
+	// ClientID и Scope - из сессии, к которой относится токен
+	ClientID string
+	Scope    string
+}
+
+// Session - вход с конкретного устройства. ID совпадает с family_id refresh-токенов
+// и с claim sid в access-токенах
+type Session struct {
+	ID         string    `json:"id"`
+	UserID     int       `json:"-"`
+	UserAgent  string    `json:"user_agent"`
+	IPAddress  string    `json:"ip_address"`
+	ClientID   string    `json:"client_id,omitempty"`
+	Scope      string    `json:"-"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+}
+
+// RecoveryCode - одноразовый код восстановления доступа при 2FA
+type RecoveryCode struct {
+	ID       int
+	UserID   int
+	CodeHash string
+}
+
+// EmailChange - подтверждённая смена email
+type EmailChange struct {
+	UserID   int
+	OldEmail string
+	NewEmail string
+}
+
+// LinkedIdentity - аккаунт внешнего провайдера входа, привязанный к пользователю
+type LinkedIdentity struct {
+	Provider    string     `json:"provider"`
+	Subject     string     `json:"-"`
+	Email       string     `json:"email,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	LastLoginAt *time.Time `json:"last_login_at,omitempty"`
+}
+
+// ServiceAccount - учётная запись фоновой задачи или интеграции. Входит по API-ключу,
+// права ограничены Scopes (названия прав из RBAC)
+type ServiceAccount struct {
+	ID         int        `json:"id"`
+	Name       string     `json:"name"`
+	Scopes     []string   `json:"scopes"`
+	CreatedBy  *int       `json:"created_by,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	DisabledAt *time.Time `json:"disabled_at,omitempty"`
+}
+
+// APIKey - ключ сервисного аккаунта. Сам ключ не хранится, Prefix - его начало,
+// по которому ключ можно узнать в списке
+type APIKey struct {
+	ID               string     `json:"id"`
+	ServiceAccountID int        `json:"service_account_id"`
+	Name             string     `json:"name"`
+	Prefix           string     `json:"prefix"`
+	ExpiresAt        *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt       *time.Time `json:"last_used_at,omitempty"`
+	RevokedAt        *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt        time.Time  `json:"created_at"`
+}
+
+// Passkey - ключ WebAuthn пользователя. Credential - то, что нужно для проверки подписи
+type Passkey struct {
+	ID         int        `json:"id"`
+	UserID     int        `json:"-"`
+	Name       string     `json:"name"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	// Synced - ключ синхронизируется между устройствами (iCloud, Google)
+	Synced     bool                `json:"synced"`
+	Credential webauthn.Credential `json:"-"`
 }
 
 func NewRepository(db *sql.DB) Repository {
@@ -52,81 +231,1272 @@ func (r *postgresRepository) CreateUser(email, passwordHash, firstName, lastName
 	return id, nil
 }
 
-func (r *postgresRepository) GetUserByEmail(email string) (*User, error) {
+// userColumns - колонки users в порядке, который ожидает scanUser
+const userColumns = "id, email, password_hash, COALESCE(first_name, ''), COALESCE(last_name, ''), email_verified_at, totp_enabled_at, disabled_at, password_reset_required, passkey_only, created_at, updated_at"
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanUser(row rowScanner) (*User, error) {
 	var user User
+	err := row.Scan(
+		&user.ID, &user.Email, &user.PasswordHash, &user.FirstName, &user.LastName,
+		&user.EmailVerifiedAt, &user.TOTPEnabledAt, &user.DisabledAt, &user.PasswordResetRequired,
+		&user.PasskeyOnly, &user.CreatedAt, &user.UpdatedAt,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+func (r *postgresRepository) GetUserByEmail(email string) (*User, error) {
+	return scanUser(r.db.QueryRow(
+		"SELECT "+userColumns+" FROM users WHERE email = $1",
+		email,
+	))
+}
+
+func (r *postgresRepository) GetUserByID(id int) (*User, error) {
+	return scanUser(r.db.QueryRow(
+		"SELECT "+userColumns+" FROM users WHERE id = $1",
+		id,
+	))
+}
+
+func (r *postgresRepository) UserExists(email string) (bool, error) {
+	var exists bool
 	err := r.db.QueryRow(
-		"SELECT id, email, password_hash, first_name, last_name, created_at, updated_at FROM users WHERE email = $1",
+		"SELECT EXISTS(SELECT 1 FROM users WHERE email = $1)",
 		email,
-	).Scan(&user.ID, &user.Email, &user.PasswordHash, &user.FirstName, &user.LastName, &user.CreatedAt, &user.UpdatedAt)
+	).Scan(&exists)
+	return exists, err
+}
+
+func (r *postgresRepository) SaveRefreshToken(userID int, tokenHash, familyID string, expiresAt time.Time) error {
+	_, err := r.db.Exec(
+		"INSERT INTO auth_tokens (user_id, token_hash, family_id, expires_at) VALUES ($1, $2, $3, $4)",
+		userID, tokenHash, familyID, expiresAt,
+	)
+	return err
+}
+
+func (r *postgresRepository) GetUserByRefreshToken(tokenHash string) (*User, error) {
+	user, err := scanUser(r.db.QueryRow(
+		`SELECT `+userColumns+`
+		 FROM users
+		 WHERE id = (
+		     SELECT user_id FROM auth_tokens
+		     WHERE token_hash = $1 AND expires_at > $2 AND used_at IS NULL AND revoked_at IS NULL
+		 )`,
+		tokenHash, time.Now(),
+	))
+	if errors.Is(err, ErrUserNotFound) {
+		return nil, ErrRefreshTokenInvalid
+	}
+	return user, err
+}
+
+// GetRefreshToken возвращает запись refresh-токена в любом состоянии (использован,
+// отозван, истёк) вместе с клиентом и scope его сессии
+func (r *postgresRepository) GetRefreshToken(tokenHash string) (*RefreshToken, error) {
+	var rt RefreshToken
+	err := r.db.QueryRow(
+		`SELECT t.id, t.user_id, t.token_hash, t.family_id, t.expires_at, t.used_at, t.revoked_at, t.created_at,
+		        COALESCE(s.client_id, ''), COALESCE(s.scope, '')
+		 FROM auth_tokens t
+		 LEFT JOIN user_sessions s ON s.id = t.family_id
+		 WHERE t.token_hash = $1`,
+		tokenHash,
+	).Scan(
+		&rt.ID, &rt.UserID, &rt.TokenHash, &rt.FamilyID, &rt.ExpiresAt, &rt.UsedAt, &rt.RevokedAt, &rt.CreatedAt,
+		&rt.ClientID, &rt.Scope,
+	)
 
 	if errors.Is(err, sql.ErrNoRows) {
-		return nil, errors.New("user not found")
+		return nil, ErrRefreshTokenInvalid
 	}
 	if err != nil {
 		return nil, err
 	}
+	return &rt, nil
+}
 
-	return &user, nil
+// RotateRefreshToken атомарно помечает старый токен использованным и сохраняет новый
+// в том же семействе. Повторное предъявление уже использованного токена означает,
+// что он утёк: в этом случае отзывается всё семейство и возвращается ErrRefreshTokenReused
+// вместе с предъявленным токеном, чтобы было известно, чей аккаунт атакуют.
+// Токен принимается только от того OAuth-клиента, которому выдан (clientID пуст для своего фронтенда)
+func (r *postgresRepository) RotateRefreshToken(oldHash, newHash, clientID string, expiresAt time.Time) (*RefreshToken, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer func(tx *sql.Tx) {
+		_ = tx.Rollback()
+	}(tx)
+
+	var old RefreshToken
+	err = tx.QueryRow(
+		`SELECT t.id, t.user_id, t.token_hash, t.family_id, t.expires_at, t.used_at, t.revoked_at, t.created_at,
+		        COALESCE(s.client_id, ''), COALESCE(s.scope, '')
+		 FROM auth_tokens t
+		 LEFT JOIN user_sessions s ON s.id = t.family_id
+		 WHERE t.token_hash = $1
+		 FOR UPDATE OF t`,
+		oldHash,
+	).Scan(
+		&old.ID, &old.UserID, &old.TokenHash, &old.FamilyID, &old.ExpiresAt, &old.UsedAt, &old.RevokedAt, &old.CreatedAt,
+		&old.ClientID, &old.Scope,
+	)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrRefreshTokenInvalid
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if old.RevokedAt != nil || old.ExpiresAt.Before(time.Now()) || old.ClientID != clientID {
+		return nil, ErrRefreshTokenInvalid
+	}
+
+	if old.UsedAt != nil {
+		// Токен уже был обменян - кто-то использует украденную копию
+		if _, err := tx.Exec(
+			"UPDATE auth_tokens SET revoked_at = NOW() WHERE family_id = $1 AND revoked_at IS NULL",
+			old.FamilyID,
+		); err != nil {
+			return nil, err
+		}
+		if _, err := tx.Exec(
+			"UPDATE user_sessions SET revoked_at = NOW() WHERE id = $1 AND revoked_at IS NULL",
+			old.FamilyID,
+		); err != nil {
+			return nil, err
+		}
+		if err := tx.Commit(); err != nil {
+			return nil, err
+		}
+		return &old, ErrRefreshTokenReused
+	}
+
+	if _, err := tx.Exec("UPDATE auth_tokens SET used_at = NOW() WHERE id = $1", old.ID); err != nil {
+		return nil, err
+	}
+
+	next := RefreshToken{
+		UserID:    old.UserID,
+		TokenHash: newHash,
+		FamilyID:  old.FamilyID,
+		ExpiresAt: expiresAt,
+		ClientID:  old.ClientID,
+		Scope:     old.Scope,
+	}
+	err = tx.QueryRow(
+		"INSERT INTO auth_tokens (user_id, token_hash, family_id, expires_at) VALUES ($1, $2, $3, $4) RETURNING id, created_at",
+		next.UserID, next.TokenHash, next.FamilyID, next.ExpiresAt,
+	).Scan(&next.ID, &next.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return &next, nil
 }
 
-func (r *postgresRepository) GetUserByID(id int) (*User, error) {
-	var user User
+func (r *postgresRepository) RevokeTokenFamily(familyID string) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func(tx *sql.Tx) {
+		_ = tx.Rollback()
+	}(tx)
+
+	if err := revokeFamily(tx, familyID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func revokeFamily(tx *sql.Tx, familyID string) error {
+	if _, err := tx.Exec(
+		"UPDATE auth_tokens SET revoked_at = NOW() WHERE family_id = $1 AND revoked_at IS NULL",
+		familyID,
+	); err != nil {
+		return err
+	}
+	_, err := tx.Exec(
+		"UPDATE user_sessions SET revoked_at = NOW() WHERE id = $1 AND revoked_at IS NULL",
+		familyID,
+	)
+	return err
+}
+
+func (r *postgresRepository) RevokeUserRefreshTokens(userID int) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func(tx *sql.Tx) {
+		_ = tx.Rollback()
+	}(tx)
+
+	if _, err := tx.Exec(
+		"UPDATE auth_tokens SET revoked_at = NOW() WHERE user_id = $1 AND revoked_at IS NULL",
+		userID,
+	); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(
+		"UPDATE user_sessions SET revoked_at = NOW() WHERE user_id = $1 AND revoked_at IS NULL",
+		userID,
+	); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (r *postgresRepository) CreateSession(session *Session) error {
+	return r.db.QueryRow(
+		`INSERT INTO user_sessions (id, user_id, user_agent, ip_address, client_id, scope, expires_at)
+		 VALUES ($1, $2, $3, $4, NULLIF($5, ''), $6, $7)
+		 RETURNING created_at, last_used_at`,
+		session.ID, session.UserID, session.UserAgent, session.IPAddress, session.ClientID, session.Scope, session.ExpiresAt,
+	).Scan(&session.CreatedAt, &session.LastUsedAt)
+}
+
+// TouchSession отмечает использование сессии при обмене refresh-токена
+func (r *postgresRepository) TouchSession(sessionID, ipAddress, userAgent string, expiresAt time.Time) error {
+	_, err := r.db.Exec(
+		`UPDATE user_sessions
+		 SET last_used_at = NOW(), ip_address = $2, user_agent = COALESCE(NULLIF($3, ''), user_agent), expires_at = $4
+		 WHERE id = $1`,
+		sessionID, ipAddress, userAgent, expiresAt,
+	)
+	return err
+}
+
+// ListSessions возвращает активные сессии, последние использованные первыми
+func (r *postgresRepository) ListSessions(userID int) ([]Session, error) {
+	rows, err := r.db.Query(
+		`SELECT id, user_id, user_agent, ip_address, COALESCE(client_id, ''), created_at, last_used_at, expires_at
+		 FROM user_sessions
+		 WHERE user_id = $1 AND revoked_at IS NULL AND expires_at > NOW()
+		 ORDER BY last_used_at DESC`,
+		userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer func(rows *sql.Rows) {
+		_ = rows.Close()
+	}(rows)
+
+	sessions := []Session{}
+	for rows.Next() {
+		var session Session
+		if err := rows.Scan(
+			&session.ID, &session.UserID, &session.UserAgent, &session.IPAddress, &session.ClientID,
+			&session.CreatedAt, &session.LastUsedAt, &session.ExpiresAt,
+		); err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, session)
+	}
+	return sessions, rows.Err()
+}
+
+// GetSessionHistory сообщает, входил ли пользователь раньше вообще и с таким User-Agent.
+// Учитываются и завершённые сессии
+func (r *postgresRepository) GetSessionHistory(userID int, userAgent string) (bool, bool, error) {
+	var hasSessions, hasUserAgent bool
 	err := r.db.QueryRow(
-		"SELECT id, email, password_hash, first_name, last_name, created_at, updated_at FROM users WHERE id = $1",
-		id,
-	).Scan(&user.ID, &user.Email, &user.PasswordHash, &user.FirstName, &user.LastName, &user.CreatedAt, &user.UpdatedAt)
+		`SELECT EXISTS(SELECT 1 FROM user_sessions WHERE user_id = $1),
+		        EXISTS(SELECT 1 FROM user_sessions WHERE user_id = $1 AND user_agent = $2)`,
+		userID, userAgent,
+	).Scan(&hasSessions, &hasUserAgent)
+	return hasSessions, hasUserAgent, err
+}
+
+// RevokeSession завершает сессию пользователя вместе с её refresh-токенами
+func (r *postgresRepository) RevokeSession(userID int, sessionID string) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func(tx *sql.Tx) {
+		_ = tx.Rollback()
+	}(tx)
+
+	var exists bool
+	err = tx.QueryRow(
+		"SELECT EXISTS(SELECT 1 FROM user_sessions WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL)",
+		sessionID, userID,
+	).Scan(&exists)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return ErrSessionNotFound
+	}
+
+	if err := revokeFamily(tx, sessionID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (r *postgresRepository) DeleteRefreshToken(tokenHash string) error {
+	_, err := r.db.Exec(
+		"DELETE FROM auth_tokens WHERE token_hash = $1",
+		tokenHash,
+	)
+	return err
+}
+
+func (r *postgresRepository) UpdatePassword(userID int, passwordHash string) error {
+	_, err := r.db.Exec(
+		"UPDATE users SET password_hash = $1, password_reset_required = FALSE, updated_at = NOW() WHERE id = $2",
+		passwordHash, userID,
+	)
+	return err
+}
+
+// UpdatePasswordHash заменяет хэш того же пароля (перехэширование), не трогая флаги аккаунта
+func (r *postgresRepository) UpdatePasswordHash(userID int, passwordHash string) error {
+	_, err := r.db.Exec("UPDATE users SET password_hash = $1 WHERE id = $2", passwordHash, userID)
+	return err
+}
+
+func (r *postgresRepository) SavePasswordResetToken(userID int, tokenHash string, expiresAt time.Time) error {
+	_, err := r.db.Exec(
+		"INSERT INTO password_reset_tokens (user_id, token_hash, expires_at) VALUES ($1, $2, $3)",
+		userID, tokenHash, expiresAt,
+	)
+	return err
+}
+
+// ConsumePasswordResetToken помечает токен использованным и возвращает владельца.
+// Остальные неиспользованные токены пользователя тоже гасятся
+func (r *postgresRepository) ConsumePasswordResetToken(tokenHash string) (int, error) {
+	var userID int
+	err := r.db.QueryRow(
+		`UPDATE password_reset_tokens
+		 SET used_at = NOW()
+		 WHERE token_hash = $1 AND used_at IS NULL AND expires_at > NOW()
+		 RETURNING user_id`,
+		tokenHash,
+	).Scan(&userID)
 
 	if errors.Is(err, sql.ErrNoRows) {
-		return nil, errors.New("user not found")
+		return 0, ErrResetTokenInvalid
 	}
 	if err != nil {
-		return nil, err
+		return 0, err
 	}
 
-	return &user, nil
+	_, err = r.db.Exec(
+		"UPDATE password_reset_tokens SET used_at = NOW() WHERE user_id = $1 AND used_at IS NULL",
+		userID,
+	)
+	return userID, err
 }
 
-func (r *postgresRepository) UserExists(email string) (bool, error) {
+// GetPasswordResetTokenUser возвращает владельца действующего токена, не погашая токен
+func (r *postgresRepository) GetPasswordResetTokenUser(tokenHash string) (int, error) {
+	var userID int
+	err := r.db.QueryRow(
+		"SELECT user_id FROM password_reset_tokens WHERE token_hash = $1 AND used_at IS NULL AND expires_at > NOW()",
+		tokenHash,
+	).Scan(&userID)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, ErrResetTokenInvalid
+	}
+	return userID, err
+}
+
+// HasRecentPasswordResetToken - выдавался ли пользователю действующий токен сброса после since
+func (r *postgresRepository) HasRecentPasswordResetToken(userID int, since time.Time) (bool, error) {
 	var exists bool
 	err := r.db.QueryRow(
-		"SELECT EXISTS(SELECT 1 FROM users WHERE email = $1)",
-		email,
+		`SELECT EXISTS(
+		     SELECT 1 FROM password_reset_tokens
+		     WHERE user_id = $1 AND used_at IS NULL AND expires_at > NOW() AND created_at > $2
+		 )`,
+		userID, since,
 	).Scan(&exists)
 	return exists, err
 }
 
-func (r *postgresRepository) SaveRefreshToken(userID int, token string, expiresAt time.Time) error {
+func (r *postgresRepository) SaveEmailVerificationToken(userID int, tokenHash string, expiresAt time.Time) error {
 	_, err := r.db.Exec(
-		"INSERT INTO auth_tokens (user_id, token, expires_at) VALUES ($1, $2, $3)",
-		userID, token, expiresAt,
+		"INSERT INTO email_verification_tokens (user_id, token_hash, expires_at) VALUES ($1, $2, $3)",
+		userID, tokenHash, expiresAt,
 	)
 	return err
 }
 
-func (r *postgresRepository) GetUserByRefreshToken(token string) (*User, error) {
-	var user User
+func (r *postgresRepository) ConsumeEmailVerificationToken(tokenHash string) (int, error) {
+	var userID int
 	err := r.db.QueryRow(
-		`SELECT u.id, u.email, u.password_hash, u.first_name, u.last_name, u.created_at, u.updated_at 
-		 FROM users u 
-		 JOIN auth_tokens t ON u.id = t.user_id 
-		 WHERE t.token = $1 AND t.expires_at > $2`,
-		token, time.Now(),
-	).Scan(&user.ID, &user.Email, &user.PasswordHash, &user.FirstName, &user.LastName, &user.CreatedAt, &user.UpdatedAt)
+		`UPDATE email_verification_tokens
+		 SET used_at = NOW()
+		 WHERE token_hash = $1 AND used_at IS NULL AND expires_at > NOW()
+		 RETURNING user_id`,
+		tokenHash,
+	).Scan(&userID)
 
 	if errors.Is(err, sql.ErrNoRows) {
-		return nil, errors.New("invalid or expired refresh token")
+		return 0, ErrVerifyTokenInvalid
 	}
+	return userID, err
+}
+
+func (r *postgresRepository) MarkEmailVerified(userID int) error {
+	_, err := r.db.Exec(
+		"UPDATE users SET email_verified_at = COALESCE(email_verified_at, NOW()), updated_at = NOW() WHERE id = $1",
+		userID,
+	)
+	return err
+}
+
+// SaveEmailChangeRequest сохраняет запрос на смену email. Прежние неподтверждённые
+// запросы пользователя отменяются: действует только последняя ссылка
+func (r *postgresRepository) SaveEmailChangeRequest(userID int, newEmail, tokenHash string, expiresAt time.Time) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func(tx *sql.Tx) {
+		_ = tx.Rollback()
+	}(tx)
+
+	if _, err := tx.Exec(
+		"UPDATE email_change_requests SET used_at = NOW() WHERE user_id = $1 AND used_at IS NULL",
+		userID,
+	); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(
+		"INSERT INTO email_change_requests (user_id, new_email, token_hash, expires_at) VALUES ($1, $2, $3, $4)",
+		userID, newEmail, tokenHash, expiresAt,
+	); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// ConfirmEmailChange гасит токен и меняет email пользователя. Новый адрес считается
+// подтверждённым: письмо со ссылкой пришло именно на него
+func (r *postgresRepository) ConfirmEmailChange(tokenHash string) (*EmailChange, error) {
+	tx, err := r.db.Begin()
 	if err != nil {
 		return nil, err
 	}
+	defer func(tx *sql.Tx) {
+		_ = tx.Rollback()
+	}(tx)
 
-	return &user, nil
+	var change EmailChange
+	err = tx.QueryRow(
+		`UPDATE email_change_requests
+		 SET used_at = NOW()
+		 WHERE token_hash = $1 AND used_at IS NULL AND expires_at > NOW()
+		 RETURNING user_id, new_email`,
+		tokenHash,
+	).Scan(&change.UserID, &change.NewEmail)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrEmailChangeInvalid
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.QueryRow("SELECT email FROM users WHERE id = $1 FOR UPDATE", change.UserID).Scan(&change.OldEmail)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = tx.Exec(
+		"UPDATE users SET email = $1, email_verified_at = NOW(), updated_at = NOW() WHERE id = $2",
+		change.NewEmail, change.UserID,
+	)
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+		// Адрес успели занять, пока письмо шло
+		return nil, ErrEmailTaken
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Ссылки для сброса пароля и входа, отправленные на прежний адрес, больше не действуют:
+	// иначе владелец старого ящика сохранил бы доступ к аккаунту
+	_, err = tx.Exec(
+		"UPDATE password_reset_tokens SET used_at = NOW() WHERE user_id = $1 AND used_at IS NULL",
+		change.UserID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	_, err = tx.Exec(
+		"UPDATE magic_link_tokens SET used_at = NOW() WHERE email = $1 AND used_at IS NULL",
+		change.OldEmail,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return &change, nil
 }
 
-func (r *postgresRepository) DeleteRefreshToken(token string) error {
+func (r *postgresRepository) SaveMagicLinkToken(email, tokenHash string, expiresAt time.Time) error {
 	_, err := r.db.Exec(
-		"DELETE FROM auth_tokens WHERE token = $1",
-		token,
+		"INSERT INTO magic_link_tokens (email, token_hash, expires_at) VALUES ($1, $2, $3)",
+		email, tokenHash, expiresAt,
 	)
 	return err
 }
+
+// ConsumeMagicLinkToken гасит ссылку и возвращает email, на который она была выслана.
+// Остальные неиспользованные ссылки на этот адрес тоже гасятся
+func (r *postgresRepository) ConsumeMagicLinkToken(tokenHash string) (string, error) {
+	var email string
+	err := r.db.QueryRow(
+		`UPDATE magic_link_tokens
+		 SET used_at = NOW()
+		 WHERE token_hash = $1 AND used_at IS NULL AND expires_at > NOW()
+		 RETURNING email`,
+		tokenHash,
+	).Scan(&email)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", ErrMagicLinkInvalid
+	}
+	if err != nil {
+		return "", err
+	}
+
+	_, err = r.db.Exec(
+		"UPDATE magic_link_tokens SET used_at = NOW() WHERE email = $1 AND used_at IS NULL",
+		email,
+	)
+	return email, err
+}
+
+func (r *postgresRepository) SaveDeletionToken(userID int, tokenHash string, expiresAt time.Time) error {
+	_, err := r.db.Exec(
+		"INSERT INTO account_deletion_tokens (user_id, token_hash, expires_at) VALUES ($1, $2, $3)",
+		userID, tokenHash, expiresAt,
+	)
+	return err
+}
+
+// ConsumeDeletionToken гасит ссылку подтверждения удаления. Ссылка действует только
+// в сессии того же пользователя, остальные его неиспользованные ссылки тоже гасятся
+func (r *postgresRepository) ConsumeDeletionToken(userID int, tokenHash string) error {
+	var id int
+	err := r.db.QueryRow(
+		`UPDATE account_deletion_tokens
+		 SET used_at = NOW()
+		 WHERE token_hash = $1 AND user_id = $2 AND used_at IS NULL AND expires_at > NOW()
+		 RETURNING id`,
+		tokenHash, userID,
+	).Scan(&id)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrDeletionTokenInvalid
+	}
+	if err != nil {
+		return err
+	}
+
+	_, err = r.db.Exec(
+		"UPDATE account_deletion_tokens SET used_at = NOW() WHERE user_id = $1 AND used_at IS NULL",
+		userID,
+	)
+	return err
+}
+
+// GetUserByIdentity ищет пользователя по аккаунту внешнего провайдера
+func (r *postgresRepository) GetUserByIdentity(provider, subject string) (*User, error) {
+	return scanUser(r.db.QueryRow(
+		`SELECT `+userColumns+`
+		 FROM users
+		 WHERE id = (
+		     SELECT user_id FROM user_identities WHERE provider = $1 AND subject = $2
+		 )`,
+		provider, subject,
+	))
+}
+
+// LinkIdentity привязывает аккаунт провайдера. Если он уже привязан к кому-то
+// или у пользователя уже есть аккаунт этого провайдера - ErrIdentityLinked
+func (r *postgresRepository) LinkIdentity(userID int, provider, subject, email string) error {
+	_, err := r.db.Exec(
+		`INSERT INTO user_identities (user_id, provider, subject, email, last_login_at)
+		 VALUES ($1, $2, $3, $4, NOW())`,
+		userID, provider, subject, email,
+	)
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+		return ErrIdentityLinked
+	}
+	return err
+}
+
+// TouchIdentity отмечает вход через провайдера и запоминает актуальный email у провайдера
+func (r *postgresRepository) TouchIdentity(provider, subject, email string) error {
+	_, err := r.db.Exec(
+		"UPDATE user_identities SET last_login_at = NOW(), email = $3 WHERE provider = $1 AND subject = $2",
+		provider, subject, email,
+	)
+	return err
+}
+
+func (r *postgresRepository) ListIdentities(userID int) ([]LinkedIdentity, error) {
+	rows, err := r.db.Query(
+		`SELECT provider, subject, email, created_at, last_login_at
+		 FROM user_identities
+		 WHERE user_id = $1
+		 ORDER BY created_at`,
+		userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer func(rows *sql.Rows) {
+		_ = rows.Close()
+	}(rows)
+
+	identities := []LinkedIdentity{}
+	for rows.Next() {
+		var identity LinkedIdentity
+		if err := rows.Scan(
+			&identity.Provider, &identity.Subject, &identity.Email, &identity.CreatedAt, &identity.LastLoginAt,
+		); err != nil {
+			return nil, err
+		}
+		identities = append(identities, identity)
+	}
+	return identities, rows.Err()
+}
+
+func (r *postgresRepository) UnlinkIdentity(userID int, provider string) error {
+	result, err := r.db.Exec(
+		"DELETE FROM user_identities WHERE user_id = $1 AND provider = $2",
+		userID, provider,
+	)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrIdentityNotFound
+	}
+	return nil
+}
+
+func (r *postgresRepository) GetTOTPSecret(userID int) (string, int64, error) {
+	var secret sql.NullString
+	var lastStep int64
+	err := r.db.QueryRow(
+		"SELECT totp_secret, totp_last_step FROM users WHERE id = $1",
+		userID,
+	).Scan(&secret, &lastStep)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", 0, ErrUserNotFound
+	}
+	return secret.String, lastStep, err
+}
+
+// SetPendingTOTPSecret сохраняет секрет, который ещё не подтверждён кодом.
+// 2FA при этом остаётся выключенной
+func (r *postgresRepository) SetPendingTOTPSecret(userID int, secret string) error {
+	_, err := r.db.Exec(
+		"UPDATE users SET totp_secret = $1, totp_enabled_at = NULL, totp_last_step = 0, updated_at = NOW() WHERE id = $2",
+		secret, userID,
+	)
+	return err
+}
+
+func (r *postgresRepository) EnableTOTP(userID int) error {
+	_, err := r.db.Exec(
+		"UPDATE users SET totp_enabled_at = NOW(), updated_at = NOW() WHERE id = $1 AND totp_secret IS NOT NULL",
+		userID,
+	)
+	return err
+}
+
+func (r *postgresRepository) DisableTOTP(userID int) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func(tx *sql.Tx) {
+		_ = tx.Rollback()
+	}(tx)
+
+	if _, err := tx.Exec(
+		"UPDATE users SET totp_secret = NULL, totp_enabled_at = NULL, totp_last_step = 0, updated_at = NOW() WHERE id = $1",
+		userID,
+	); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM user_recovery_codes WHERE user_id = $1", userID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// AdvanceTOTPStep запоминает последний принятый интервал TOTP.
+// Возвращает false, если этот или более поздний интервал уже был использован
+func (r *postgresRepository) AdvanceTOTPStep(userID int, step int64) (bool, error) {
+	res, err := r.db.Exec(
+		"UPDATE users SET totp_last_step = $1 WHERE id = $2 AND totp_last_step < $1",
+		step, userID,
+	)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+func (r *postgresRepository) ReplaceRecoveryCodes(userID int, codeHashes []string) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func(tx *sql.Tx) {
+		_ = tx.Rollback()
+	}(tx)
+
+	if _, err := tx.Exec("DELETE FROM user_recovery_codes WHERE user_id = $1", userID); err != nil {
+		return err
+	}
+	for _, hash := range codeHashes {
+		if _, err := tx.Exec(
+			"INSERT INTO user_recovery_codes (user_id, code_hash) VALUES ($1, $2)",
+			userID, hash,
+		); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (r *postgresRepository) GetUnusedRecoveryCodes(userID int) ([]RecoveryCode, error) {
+	rows, err := r.db.Query(
+		"SELECT id, user_id, code_hash FROM user_recovery_codes WHERE user_id = $1 AND used_at IS NULL",
+		userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer func(rows *sql.Rows) {
+		_ = rows.Close()
+	}(rows)
+
+	var codes []RecoveryCode
+	for rows.Next() {
+		var code RecoveryCode
+		if err := rows.Scan(&code.ID, &code.UserID, &code.CodeHash); err != nil {
+			return nil, err
+		}
+		codes = append(codes, code)
+	}
+
+	return codes, rows.Err()
+}
+
+func (r *postgresRepository) UseRecoveryCode(codeID int) (bool, error) {
+	res, err := r.db.Exec(
+		"UPDATE user_recovery_codes SET used_at = NOW() WHERE id = $1 AND used_at IS NULL",
+		codeID,
+	)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+func (r *postgresRepository) SetUserDisabled(userID int, disabled bool) error {
+	query := "UPDATE users SET disabled_at = NULL, updated_at = NOW() WHERE id = $1"
+	if disabled {
+		query = "UPDATE users SET disabled_at = COALESCE(disabled_at, NOW()), updated_at = NOW() WHERE id = $1"
+	}
+
+	res, err := r.db.Exec(query, userID)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+func (r *postgresRepository) RequirePasswordReset(userID int) error {
+	res, err := r.db.Exec(
+		"UPDATE users SET password_reset_required = TRUE, updated_at = NOW() WHERE id = $1",
+		userID,
+	)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+func (r *postgresRepository) CreateServiceAccount(account *ServiceAccount) error {
+	return r.db.QueryRow(
+		"INSERT INTO service_accounts (name, scopes, created_by) VALUES ($1, $2, $3) RETURNING id, created_at",
+		account.Name, pq.Array(account.Scopes), account.CreatedBy,
+	).Scan(&account.ID, &account.CreatedAt)
+}
+
+func (r *postgresRepository) ListServiceAccounts() ([]ServiceAccount, error) {
+	rows, err := r.db.Query(
+		"SELECT id, name, scopes, created_by, created_at, disabled_at FROM service_accounts ORDER BY id",
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer func(rows *sql.Rows) {
+		_ = rows.Close()
+	}(rows)
+
+	accounts := []ServiceAccount{}
+	for rows.Next() {
+		var account ServiceAccount
+		if err := rows.Scan(
+			&account.ID, &account.Name, pq.Array(&account.Scopes), &account.CreatedBy, &account.CreatedAt, &account.DisabledAt,
+		); err != nil {
+			return nil, err
+		}
+		accounts = append(accounts, account)
+	}
+	return accounts, rows.Err()
+}
+
+// DisableServiceAccount отключает аккаунт и отзывает его ключи. Возвращает id отозванных
+// ключей, чтобы погасить выданные по ним access-токены
+func (r *postgresRepository) DisableServiceAccount(id int) ([]string, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer func(tx *sql.Tx) {
+		_ = tx.Rollback()
+	}(tx)
+
+	result, err := tx.Exec(
+		"UPDATE service_accounts SET disabled_at = COALESCE(disabled_at, NOW()) WHERE id = $1",
+		id,
+	)
+	if err != nil {
+		return nil, err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+	if affected == 0 {
+		return nil, ErrServiceAccountNotFound
+	}
+
+	rows, err := tx.Query(
+		"UPDATE api_keys SET revoked_at = NOW() WHERE service_account_id = $1 AND revoked_at IS NULL RETURNING id",
+		id,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer func(rows *sql.Rows) {
+		_ = rows.Close()
+	}(rows)
+
+	var keyIDs []string
+	for rows.Next() {
+		var keyID string
+		if err := rows.Scan(&keyID); err != nil {
+			return nil, err
+		}
+		keyIDs = append(keyIDs, keyID)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return keyIDs, tx.Commit()
+}
+
+// ExistingPermissions возвращает те из names, которые есть в таблице permissions
+func (r *postgresRepository) ExistingPermissions(names []string) ([]string, error) {
+	rows, err := r.db.Query("SELECT name FROM permissions WHERE name = ANY($1)", pq.Array(names))
+	if err != nil {
+		return nil, err
+	}
+	defer func(rows *sql.Rows) {
+		_ = rows.Close()
+	}(rows)
+
+	var existing []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		existing = append(existing, name)
+	}
+	return existing, rows.Err()
+}
+
+// CreateAPIKey сохраняет ключ. Отключённому аккаунту ключ не выдаётся
+func (r *postgresRepository) CreateAPIKey(key *APIKey, keyHash string) error {
+	err := r.db.QueryRow(
+		`INSERT INTO api_keys (id, service_account_id, name, prefix, key_hash, expires_at)
+		 SELECT $1, id, $3, $4, $5, $6 FROM service_accounts WHERE id = $2 AND disabled_at IS NULL
+		 RETURNING created_at`,
+		key.ID, key.ServiceAccountID, key.Name, key.Prefix, keyHash, key.ExpiresAt,
+	).Scan(&key.CreatedAt)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrServiceAccountNotFound
+	}
+	return err
+}
+
+func (r *postgresRepository) ListAPIKeys(serviceAccountID int) ([]APIKey, error) {
+	rows, err := r.db.Query(
+		`SELECT id, service_account_id, name, prefix, expires_at, last_used_at, revoked_at, created_at
+		 FROM api_keys
+		 WHERE service_account_id = $1
+		 ORDER BY created_at`,
+		serviceAccountID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer func(rows *sql.Rows) {
+		_ = rows.Close()
+	}(rows)
+
+	keys := []APIKey{}
+	for rows.Next() {
+		var key APIKey
+		if err := rows.Scan(
+			&key.ID, &key.ServiceAccountID, &key.Name, &key.Prefix, &key.ExpiresAt, &key.LastUsedAt, &key.RevokedAt, &key.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+func (r *postgresRepository) RevokeAPIKey(serviceAccountID int, keyID string) error {
+	result, err := r.db.Exec(
+		"UPDATE api_keys SET revoked_at = NOW() WHERE id = $1 AND service_account_id = $2 AND revoked_at IS NULL",
+		keyID, serviceAccountID,
+	)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrAPIKeyNotFound
+	}
+	return nil
+}
+
+// GetServiceAccountByAPIKey находит действующий ключ и его аккаунт. Отозванные, истёкшие
+// ключи и ключи отключённых аккаунтов не отличаются от несуществующих
+func (r *postgresRepository) GetServiceAccountByAPIKey(keyHash string) (*ServiceAccount, *APIKey, error) {
+	var account ServiceAccount
+	var key APIKey
+	err := r.db.QueryRow(
+		`SELECT k.id, k.name, k.prefix, k.expires_at, k.last_used_at, k.created_at,
+		        a.id, a.name, a.scopes, a.created_by, a.created_at
+		 FROM api_keys k JOIN service_accounts a ON a.id = k.service_account_id
+		 WHERE k.key_hash = $1
+		   AND k.revoked_at IS NULL
+		   AND (k.expires_at IS NULL OR k.expires_at > NOW())
+		   AND a.disabled_at IS NULL`,
+		keyHash,
+	).Scan(
+		&key.ID, &key.Name, &key.Prefix, &key.ExpiresAt, &key.LastUsedAt, &key.CreatedAt,
+		&account.ID, &account.Name, pq.Array(&account.Scopes), &account.CreatedBy, &account.CreatedAt,
+	)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil, ErrAPIKeyInvalid
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	key.ServiceAccountID = account.ID
+	return &account, &key, nil
+}
+
+// TouchAPIKey обновляет время последнего использования не чаще раза в минуту,
+// чтобы частые запросы не превращались в запись на каждый вызов
+func (r *postgresRepository) TouchAPIKey(keyID string) error {
+	_, err := r.db.Exec(
+		`UPDATE api_keys SET last_used_at = NOW()
+		 WHERE id = $1 AND (last_used_at IS NULL OR last_used_at < NOW() - INTERVAL '1 minute')`,
+		keyID,
+	)
+	return err
+}
+
+// SaveWebAuthnCredential сохраняет ключ после регистрации. Повторная регистрация того же
+// ключа - ErrPasskeyRegistered
+func (r *postgresRepository) SaveWebAuthnCredential(userID int, name string, credential *webauthn.Credential) error {
+	_, err := r.db.Exec(
+		`INSERT INTO webauthn_credentials
+		     (user_id, credential_id, public_key, sign_count, aaguid, transports, name, backup_eligible, backed_up)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`,
+		userID, credential.ID, credential.PublicKey, int64(credential.SignCount), credential.AAGUID,
+		pq.Array(credential.Transports), name, credential.BackupEligible, credential.BackedUp,
+	)
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+		return ErrPasskeyRegistered
+	}
+	return err
+}
+
+// passkeyColumns - колонки webauthn_credentials в порядке, который ожидает scanPasskey
+const passkeyColumns = "id, user_id, name, credential_id, public_key, sign_count, aaguid, transports, backup_eligible, backed_up, created_at, last_used_at"
+
+func scanPasskey(row rowScanner) (*Passkey, error) {
+	var passkey Passkey
+	var signCount int64
+	err := row.Scan(
+		&passkey.ID, &passkey.UserID, &passkey.Name, &passkey.Credential.ID, &passkey.Credential.PublicKey, &signCount,
+		&passkey.Credential.AAGUID, pq.Array(&passkey.Credential.Transports), &passkey.Credential.BackupEligible,
+		&passkey.Credential.BackedUp,
+		&passkey.CreatedAt, &passkey.LastUsedAt,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrPasskeyNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	passkey.Credential.SignCount = uint32(signCount)
+	passkey.Synced = passkey.Credential.BackedUp
+	return &passkey, nil
+}
+
+func (r *postgresRepository) ListWebAuthnCredentials(userID int) ([]Passkey, error) {
+	rows, err := r.db.Query(
+		"SELECT "+passkeyColumns+" FROM webauthn_credentials WHERE user_id = $1 ORDER BY created_at",
+		userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer func(rows *sql.Rows) {
+		_ = rows.Close()
+	}(rows)
+
+	passkeys := []Passkey{}
+	for rows.Next() {
+		passkey, err := scanPasskey(rows)
+		if err != nil {
+			return nil, err
+		}
+		passkeys = append(passkeys, *passkey)
+	}
+	return passkeys, rows.Err()
+}
+
+// GetWebAuthnCredential ищет ключ по id, который прислал браузер
+func (r *postgresRepository) GetWebAuthnCredential(credentialID []byte) (*Passkey, error) {
+	return scanPasskey(r.db.QueryRow(
+		"SELECT "+passkeyColumns+" FROM webauthn_credentials WHERE credential_id = $1",
+		credentialID,
+	))
+}
+
+// UpdateWebAuthnCredential запоминает счётчик подписей и время входа после успешной проверки
+func (r *postgresRepository) UpdateWebAuthnCredential(id int, signCount uint32, backedUp bool) error {
+	_, err := r.db.Exec(
+		"UPDATE webauthn_credentials SET sign_count = $2, backed_up = $3, last_used_at = NOW() WHERE id = $1",
+		id, int64(signCount), backedUp,
+	)
+	return err
+}
+
+// DeleteWebAuthnCredential удаляет ключ. Вместе с последним ключом снимается и запрет
+// входа по паролю - иначе в аккаунт будет не войти. Строка пользователя блокируется,
+// чтобы параллельное удаление двух последних ключей не оставило запрет без ключей
+func (r *postgresRepository) DeleteWebAuthnCredential(userID, id int) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func(tx *sql.Tx) {
+		_ = tx.Rollback()
+	}(tx)
+
+	if err := lockUser(tx, userID); err != nil {
+		return err
+	}
+
+	result, err := tx.Exec("DELETE FROM webauthn_credentials WHERE id = $1 AND user_id = $2", id, userID)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrPasskeyNotFound
+	}
+
+	_, err = tx.Exec(
+		`UPDATE users SET passkey_only = FALSE, updated_at = NOW()
+		 WHERE id = $1 AND passkey_only
+		   AND NOT EXISTS (SELECT 1 FROM webauthn_credentials WHERE user_id = $1)`,
+		userID,
+	)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// SetPasskeyOnly включает запрет входа по паролю, только если у пользователя есть ключ
+// (иначе ErrNoPasskeys). Проверка идёт под блокировкой пользователя, как и удаление ключей
+func (r *postgresRepository) SetPasskeyOnly(userID int, enabled bool) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func(tx *sql.Tx) {
+		_ = tx.Rollback()
+	}(tx)
+
+	if err := lockUser(tx, userID); err != nil {
+		return err
+	}
+
+	if enabled {
+		var hasPasskeys bool
+		err = tx.QueryRow("SELECT EXISTS (SELECT 1 FROM webauthn_credentials WHERE user_id = $1)", userID).Scan(&hasPasskeys)
+		if err != nil {
+			return err
+		}
+		if !hasPasskeys {
+			return ErrNoPasskeys
+		}
+	}
+
+	_, err = tx.Exec(
+		"UPDATE users SET passkey_only = $2, updated_at = NOW() WHERE id = $1",
+		userID, enabled,
+	)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// lockUser блокирует строку пользователя до конца транзакции
+func lockUser(tx *sql.Tx, userID int) error {
+	var id int
+	err := tx.QueryRow("SELECT id FROM users WHERE id = $1 FOR UPDATE", userID).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrUserNotFound
+	}
+	return err
+}
+
+// GetUserPhone возвращает номер из профиля и время его подтверждения
+func (r *postgresRepository) GetUserPhone(userID int) (string, *time.Time, error) {
+	var phone string
+	var verifiedAt *time.Time
+	err := r.db.QueryRow(
+		"SELECT COALESCE(phone, ''), phone_verified_at FROM user_profiles WHERE id = $1",
+		userID,
+	).Scan(&phone, &verifiedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil, nil
+	}
+	return phone, verifiedAt, err
+}
+
+// MarkPhoneVerified записывает подтверждённый номер в профиль. Номер, уже подтверждённый
+// другим аккаунтом, - ErrPhoneTaken
+func (r *postgresRepository) MarkPhoneVerified(userID int, phone string) error {
+	_, err := r.db.Exec(
+		`INSERT INTO user_profiles (id, phone, phone_verified_at)
+		 VALUES ($1, $2, NOW())
+		 ON CONFLICT (id) DO UPDATE SET phone = $2, phone_verified_at = NOW(), updated_at = NOW()`,
+		userID, phone,
+	)
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+		return ErrPhoneTaken
+	}
+	return err
+}
+
+// GetUserByPhone ищет пользователя по подтверждённому номеру
+func (r *postgresRepository) GetUserByPhone(phone string) (*User, error) {
+	return scanUser(r.db.QueryRow(
+		`SELECT `+userColumns+`
+		 FROM users
+		 WHERE id = (
+		     SELECT id FROM user_profiles WHERE phone = $1 AND phone_verified_at IS NOT NULL
+		 )`,
+		phone,
+	))
+}
@@ -0,0 +1,188 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"auth-user-service/internal/redis"
+)
+
+// RevocationStore - список отозванных access-токенов.
+// Отзываем конкретный токен по jti, все токены одной сессии по sid, либо все
+// токены пользователя, выданные до определённого момента ("водяной знак"). Записи живут не дольше
+// access-токена, после этого токены и так истекают.
+type RevocationStore interface {
+	RevokeToken(ctx context.Context, jti string, ttl time.Duration) error
+	IsTokenRevoked(ctx context.Context, jti string) (bool, error)
+	RevokeSession(ctx context.Context, sid string, ttl time.Duration) error
+	IsSessionRevoked(ctx context.Context, sid string) (bool, error)
+	RevokeUserTokens(ctx context.Context, userID int, issuedBefore time.Time, ttl time.Duration) error
+	UserTokensRevokedBefore(ctx context.Context, userID int) (time.Time, error)
+}
+
+// NewRevocationStore возвращает хранилище в Redis, а если Redis не подключен
+// (redisClient == nil) - хранилище в памяти процесса.
+//
+// Fallback без Redis: отзыв работает только в пределах одного инстанса и
+// теряется при рестарте. Refresh-токены при этом всё равно отзываются в БД,
+// поэтому после рестарта отозванный access-токен проживёт максимум ACCESS_TOKEN_TTL.
+func NewRevocationStore(redisClient *redis.Client) RevocationStore {
+	if redisClient == nil {
+		log.Println("⚠️ Redis unavailable: token revocation list is kept in memory of this instance only")
+		return newMemoryRevocationStore()
+	}
+	return &redisRevocationStore{redis: redisClient}
+}
+
+type redisRevocationStore struct {
+	redis *redis.Client
+}
+
+func revokedTokenKey(jti string) string {
+	return fmt.Sprintf("revoked_token:%s", jti)
+}
+
+func revokedSessionKey(sid string) string {
+	return fmt.Sprintf("revoked_session:%s", sid)
+}
+
+func revokedUserKey(userID int) string {
+	return fmt.Sprintf("revoked_user_tokens:%d", userID)
+}
+
+func (s *redisRevocationStore) RevokeToken(ctx context.Context, jti string, ttl time.Duration) error {
+	if ttl <= 0 {
+		return nil
+	}
+	return s.redis.Set(ctx, revokedTokenKey(jti), true, ttl)
+}
+
+func (s *redisRevocationStore) IsTokenRevoked(ctx context.Context, jti string) (bool, error) {
+	return s.redis.Exists(ctx, revokedTokenKey(jti))
+}
+
+func (s *redisRevocationStore) RevokeSession(ctx context.Context, sid string, ttl time.Duration) error {
+	return s.redis.Set(ctx, revokedSessionKey(sid), true, ttl)
+}
+
+func (s *redisRevocationStore) IsSessionRevoked(ctx context.Context, sid string) (bool, error) {
+	return s.redis.Exists(ctx, revokedSessionKey(sid))
+}
+
+func (s *redisRevocationStore) RevokeUserTokens(ctx context.Context, userID int, issuedBefore time.Time, ttl time.Duration) error {
+	return s.redis.Set(ctx, revokedUserKey(userID), issuedBefore.Unix(), ttl)
+}
+
+func (s *redisRevocationStore) UserTokensRevokedBefore(ctx context.Context, userID int) (time.Time, error) {
+	var unix int64
+	err := s.redis.Get(ctx, revokedUserKey(userID), &unix)
+	if errors.Is(err, redis.ErrNotFound) {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Unix(unix, 0), nil
+}
+
+type memoryRevocationStore struct {
+	mu       sync.Mutex
+	tokens   map[string]time.Time
+	sessions map[string]time.Time
+	users    map[int]memoryWatermark
+}
+
+type memoryWatermark struct {
+	issuedBefore time.Time
+	expiresAt    time.Time
+}
+
+func newMemoryRevocationStore() *memoryRevocationStore {
+	return &memoryRevocationStore{
+		tokens:   make(map[string]time.Time),
+		sessions: make(map[string]time.Time),
+		users:    make(map[int]memoryWatermark),
+	}
+}
+
+func (s *memoryRevocationStore) RevokeToken(_ context.Context, jti string, ttl time.Duration) error {
+	if ttl <= 0 {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.cleanup()
+	s.tokens[jti] = time.Now().Add(ttl)
+	return nil
+}
+
+func (s *memoryRevocationStore) IsTokenRevoked(_ context.Context, jti string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	expiresAt, ok := s.tokens[jti]
+	return ok && time.Now().Before(expiresAt), nil
+}
+
+func (s *memoryRevocationStore) RevokeSession(_ context.Context, sid string, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.cleanup()
+	s.sessions[sid] = time.Now().Add(ttl)
+	return nil
+}
+
+func (s *memoryRevocationStore) IsSessionRevoked(_ context.Context, sid string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	expiresAt, ok := s.sessions[sid]
+	return ok && time.Now().Before(expiresAt), nil
+}
+
+func (s *memoryRevocationStore) RevokeUserTokens(_ context.Context, userID int, issuedBefore time.Time, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.cleanup()
+	s.users[userID] = memoryWatermark{issuedBefore: issuedBefore, expiresAt: time.Now().Add(ttl)}
+	return nil
+}
+
+func (s *memoryRevocationStore) UserTokensRevokedBefore(_ context.Context, userID int) (time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	mark, ok := s.users[userID]
+	if !ok || time.Now().After(mark.expiresAt) {
+		return time.Time{}, nil
+	}
+	return mark.issuedBefore, nil
+}
+
+// cleanup удаляет истёкшие записи, чтобы карта не росла бесконечно. Вызывается под mu
+func (s *memoryRevocationStore) cleanup() {
+	now := time.Now()
+	for jti, expiresAt := range s.tokens {
+		if now.After(expiresAt) {
+			delete(s.tokens, jti)
+		}
+	}
+	for sid, expiresAt := range s.sessions {
+		if now.After(expiresAt) {
+			delete(s.sessions, sid)
+		}
+	}
+	for userID, mark := range s.users {
+		if now.After(mark.expiresAt) {
+			delete(s.users, userID)
+		}
+	}
+}
@@ -1,50 +1,221 @@
 package auth
 
 import (
-	"database/sql"
+	"context"
 	"errors"
 	"fmt"
+	"log"
+	"net/url"
 	"time"
 
-	"github.com/golang-jwt/jwt/v5"
-	"golang.org/x/crypto/bcrypt"
+	"auth-user-service/internal/audit"
+	"auth-user-service/internal/notify"
+	"auth-user-service/internal/password"
+	"auth-user-service/internal/sms"
+	"auth-user-service/internal/social"
+	"auth-user-service/internal/token"
+	"auth-user-service/internal/webauthn"
 )
 
 type Service interface {
 	Register(email, password, firstName, lastName string) (*User, error)
-	Login(email, password string) (*User, error)
-	GenerateToken(userID int, email string) (string, error)
-	ValidateToken(tokenString string) (int, string, error)
+	Login(email, password string, client ClientInfo) (*User, error)
 	GetUserByID(userID int) (*User, error)
+	IssueTokens(user *User, client ClientInfo) (*TokenPair, error)
+	RefreshTokens(refreshToken string, client ClientInfo) (*User, *TokenPair, error)
+	Authenticate(tokenString string) (*token.Claims, error)
+	AuthenticateClientAccess(tokenString string) (*token.Claims, error)
+	Logout(claims *token.Claims) error
+	RevokeAllSessions(userID int) error
+	ExpireAccessTokens(userID int) error
+	DisableUser(userID int) error
+	EnableUser(userID int) error
+	ForcePasswordReset(userID int) error
+	RequestPasswordReset(email string) error
+	ResetPassword(token, newPassword string) (int, error)
+	VerifyEmail(token string) error
+	ResendVerificationEmail(email string) error
+	VerificationPolicy() VerificationPolicy
+	CookiePolicy() CookiePolicy
+	RequestMagicLink(email string) error
+	ConsumeMagicLink(token string) (*User, error)
+	SocialProviders() []string
+	StartSocialLogin(provider string, linkUserID int) (*social.Authorization, error)
+	CompleteSocialLogin(provider, code, state string) (*SocialLogin, error)
+	ListIdentities(userID int) ([]LinkedIdentity, error)
+	UnlinkIdentity(userID int, provider string) error
+	VerifyPassword(userID int, password string) error
+	SendDeletionConfirmation(userID int) error
+	ConsumeDeletionConfirmation(userID int, token string) error
+	ChangePassword(userID int, currentPassword, newPassword string) (*User, error)
+	RequestEmailChange(userID int, currentPassword, newEmail string) error
+	ConfirmEmailChange(token string) (int, error)
+	ListSessions(userID int) ([]Session, error)
+	RevokeSession(userID int, sessionID string) error
+	SetupTOTP(userID int) (*TOTPSetup, error)
+	ConfirmTOTP(userID int, code string) ([]string, error)
+	DisableTOTP(userID int, password, code string) error
+	CreateMFAChallenge(user *User) (*MFAChallenge, error)
+	VerifyMFAChallenge(mfaToken, code string, client ClientInfo) (*User, error)
+	CreateServiceAccount(name string, scopes []string, createdBy int) (*ServiceAccount, error)
+	ListServiceAccounts() ([]ServiceAccount, error)
+	DisableServiceAccount(id int) error
+	CreateAPIKey(serviceAccountID int, name string, ttl time.Duration) (*APIKey, string, error)
+	ListAPIKeys(serviceAccountID int) ([]APIKey, error)
+	RevokeAPIKey(serviceAccountID int, keyID string) error
+	AuthenticateAPIKey(apiKey string) (*token.Claims, error)
+	ClientCredentialsToken(clientID, clientSecret, scope string) (*TokenPair, error)
+	AuthenticateServiceAccount(clientID, clientSecret string) (*token.Claims, error)
+	IntrospectToken(tokenString string) (*Introspection, error)
+	RevokeToken(tokenString string) error
+	BeginPasskeyRegistration(userID int) (string, *webauthn.CreationOptions, error)
+	FinishPasskeyRegistration(userID int, sessionID, name string, resp *webauthn.RegistrationResponse) error
+	BeginPasskeyLogin(email string) (string, *webauthn.RequestOptions, error)
+	FinishPasskeyLogin(sessionID string, resp *webauthn.LoginResponse) (*PasskeyLogin, error)
+	ListPasskeys(userID int) ([]Passkey, error)
+	DeletePasskey(userID, passkeyID int) error
+	SetPasskeyOnly(userID int, enabled bool) error
+	SendPhoneVerification(userID int) error
+	ConfirmPhone(userID int, code string) error
+	RequestPhoneLogin(phone string) error
+	PhoneLogin(phone, code string) (*User, error)
+}
+
+var (
+	ErrTokenRevoked          = errors.New("token revoked")
+	ErrUserExists            = errors.New("user already exists")
+	ErrInvalidCredentials    = errors.New("invalid credentials")
+	ErrEmailNotVerified      = errors.New("email not verified")
+	ErrAccountDisabled       = errors.New("account disabled")
+	ErrPasswordResetRequired = errors.New("password reset required")
+)
+
+// RoleProvider отдаёт роли пользователя, которые встраиваются в access-токен
+type RoleProvider interface {
+	GetUserRoles(userID int) ([]string, error)
+}
+
+// Config - настройки выдачи токенов
+type Config struct {
+	RefreshTokenTTL time.Duration
+
+	PasswordResetTTL     time.Duration
+	EmailVerificationTTL time.Duration
+	EmailChangeTTL       time.Duration
+	MagicLinkTTL         time.Duration
+	// DeletionConfirmTTL - срок ссылки подтверждения удаления аккаунта без пароля
+	DeletionConfirmTTL time.Duration
+	Verification       VerificationPolicy
+	MFAChallengeTTL    time.Duration
+	// MFAMaxAttempts - сколько неверных кодов принимает один challenge, после чего он гасится
+	MFAMaxAttempts int
+	// TOTPIssuer - название сервиса в приложении-аутентификаторе
+	TOTPIssuer string
+	// FrontendURL - адрес сайта, на который ведут ссылки из писем
+	FrontendURL string
+	Lockout     LockoutPolicy
+	// NotifyNewDevice - письмо о входе с устройства, с которого пользователь раньше не входил
+	NotifyNewDevice bool
+	// MagicLinkAutoRegister - создавать аккаунт при входе по ссылке с неизвестного email
+	MagicLinkAutoRegister bool
+	// PasswordResetCooldown - как часто можно повторно выслать ссылку сброса на один аккаунт
+	PasswordResetCooldown time.Duration
+	// Cookies - выдача токенов браузеру в HttpOnly cookie вместо тела ответа
+	Cookies CookiePolicy
+}
+
+// VerificationPolicy - что запрещено пользователям с неподтверждённым email
+type VerificationPolicy struct {
+	RequireForLogin  bool
+	RequireForOrders bool
+}
+
+// TokenPair - короткоживущий access JWT и непрозрачный refresh-токен
+type TokenPair struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"`
+	// Scope - разрешения OAuth-клиента, пусто для собственного фронтенда
+	Scope string `json:"scope,omitempty"`
 }
 
 type service struct {
-	repo      Repository
-	jwtSecret string
+	repo        Repository
+	passwords   password.Hasher
+	policy      *password.Policy
+	tokens      *token.Issuer
+	revocations RevocationStore
+	attempts    LoginAttemptStore
+	roles       RoleProvider
+	social      *social.Client
+	passkeys    *webauthn.RelyingParty
+	phoneOTP    *sms.OTP
+	notifier    notify.Notifier
+	events      audit.Service
+	cfg         Config
+	// dummyHash сверяется при входе с неизвестным email, см. verifyDummyPassword
+	dummyHash string
 }
 
-func NewService(repo Repository, jwtSecret string) Service {
+func NewService(repo Repository, passwords password.Hasher, policy *password.Policy, tokens *token.Issuer, revocations RevocationStore, attempts LoginAttemptStore, roles RoleProvider, socialLogin *social.Client, passkeys *webauthn.RelyingParty, phoneOTP *sms.OTP, notifier notify.Notifier, events audit.Service, cfg Config) Service {
+	// Хэш случайного значения с текущими параметрами хэшера: его проверка занимает столько же,
+	// сколько проверка настоящего пароля
+	var dummyHash string
+	secret, _, err := newOpaqueToken()
+	if err == nil {
+		dummyHash, err = passwords.Hash(secret)
+	}
+	if err != nil {
+		log.Printf("⚠️ Failed to prepare dummy password hash: %v", err)
+	}
+
 	return &service{
-		repo:      repo,
-		jwtSecret: jwtSecret,
+		repo:        repo,
+		passwords:   passwords,
+		policy:      policy,
+		tokens:      tokens,
+		revocations: revocations,
+		attempts:    attempts,
+		roles:       roles,
+		social:      socialLogin,
+		passkeys:    passkeys,
+		phoneOTP:    phoneOTP,
+		notifier:    notifier,
+		events:      events,
+		cfg:         cfg,
+		dummyHash:   dummyHash,
 	}
 }
 
 func (s *service) Register(email, password, firstName, lastName string) (*User, error) {
-	// Проверяем существует ли пользователь через UserExists
-	exists, err := s.repo.UserExists(email)
-	if err != nil {
+	if err := s.policy.Validate(password, email); err != nil {
 		return nil, err
 	}
-	if exists {
-		return nil, errors.New("user already exists")
+
+	// Хэшируем пароль до проверки существования, чтобы время ответа не зависело от наличия аккаунта
+	hashedPassword, err := s.passwords.Hash(password)
+	if err != nil {
+		return nil, err
 	}
 
-	// Хэшируем пароль
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	// Проверяем существует ли пользователь через UserExists
+	exists, err := s.repo.UserExists(email)
 	if err != nil {
 		return nil, err
 	}
+	if exists {
+		// Владелец адреса узнает о попытке из письма, а клиент получит обычный ответ
+		s.sendNotification(notify.Message{
+			To:      email,
+			Subject: "Попытка повторной регистрации",
+			Body: fmt.Sprintf(
+				"Кто-то пытался зарегистрироваться с вашим email. Если это были вы, войдите в аккаунт или восстановите пароль: %s/forgot-password",
+				s.cfg.FrontendURL,
+			),
+		})
+		return nil, ErrUserExists
+	}
 
 	// Создаем пользователя через репозиторий
 	userID, err := s.repo.CreateUser(email, string(hashedPassword), firstName, lastName)
@@ -58,60 +229,539 @@ func (s *service) Register(email, password, firstName, lastName string) (*User,
 		return nil, err
 	}
 
+	if err := s.sendVerificationEmail(user); err != nil {
+		return nil, err
+	}
+
 	return user, nil
 }
 
-func (s *service) Login(email, password string) (*User, error) {
+func (s *service) Login(email, password string, client ClientInfo) (*User, error) {
+	// Во время блокировки пароль даже не проверяем
+	if err := s.checkLockout(email, client.IPAddress); err != nil {
+		s.recordLoginFailure(0, client, "locked", audit.Metadata{"email": email})
+		return nil, err
+	}
+
 	user, err := s.repo.GetUserByEmail(email)
 	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return nil, errors.New("invalid credentials")
+		if errors.Is(err, ErrUserNotFound) {
+			s.verifyDummyPassword(password)
+			s.registerLoginFailure(email, client.IPAddress)
+			s.recordLoginFailure(0, client, "unknown_email", audit.Metadata{"email": email})
+			return nil, ErrInvalidCredentials
 		}
 		return nil, err
 	}
 
 	// Проверяем пароль
-	err = bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password))
+	match, needsRehash, err := s.passwords.Verify(user.PasswordHash, password)
 	if err != nil {
-		return nil, errors.New("invalid credentials")
+		return nil, err
+	}
+	if !match {
+		s.registerLoginFailure(email, client.IPAddress)
+		s.recordLoginFailure(user.ID, client, "invalid_password", nil)
+		return nil, ErrInvalidCredentials
+	}
+
+	if needsRehash {
+		s.rehashPassword(user, password)
+	}
+
+	// Счётчик IP не сбрасываем: иначе атакующий обнулял бы его входом в свой аккаунт
+	s.resetLoginFailures(user.Email)
+
+	if user.DisabledAt != nil {
+		s.recordLoginFailure(user.ID, client, "account_disabled", nil)
+		return nil, ErrAccountDisabled
+	}
+
+	if user.PasswordResetRequired {
+		s.recordLoginFailure(user.ID, client, "password_reset_required", nil)
+		return nil, ErrPasswordResetRequired
+	}
+
+	// Пароль проверен до этого, чтобы ответ не выдавал, кто включил вход только по passkey
+	if user.PasskeyOnly {
+		s.recordLoginFailure(user.ID, client, "password_login_disabled", nil)
+		return nil, ErrPasswordLoginDisabled
+	}
+
+	if s.cfg.Verification.RequireForLogin && user.EmailVerifiedAt == nil {
+		s.recordLoginFailure(user.ID, client, "email_not_verified", nil)
+		return nil, ErrEmailNotVerified
 	}
 
 	return user, nil
 }
 
-func (s *service) GenerateToken(userID int, email string) (string, error) {
-	claims := jwt.MapClaims{
-		"user_id": userID,
-		"email":   email,
-		"exp":     time.Now().Add(time.Hour * 24 * 7).Unix(), // 7 дней
-		"iat":     time.Now().Unix(),
+func (s *service) GetUserByID(userID int) (*User, error) {
+	return s.repo.GetUserByID(userID)
+}
+
+// IssueTokens выдаёт новую пару токенов и открывает новое семейство refresh-токенов
+// (при логине/регистрации). Семейство записывается как сессия устройства client
+func (s *service) IssueTokens(user *User, client ClientInfo) (*TokenPair, error) {
+	familyID, err := newID()
+	if err != nil {
+		return nil, err
+	}
+
+	refreshToken, refreshHash, err := newOpaqueToken()
+	if err != nil {
+		return nil, err
+	}
+
+	expiresAt := time.Now().Add(s.cfg.RefreshTokenTTL)
+	if err := s.repo.SaveRefreshToken(user.ID, refreshHash, familyID, expiresAt); err != nil {
+		return nil, err
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(s.jwtSecret))
+	if err := s.startSession(user, familyID, client, expiresAt); err != nil {
+		return nil, err
+	}
+
+	return s.newTokenPair(user, familyID, refreshToken, client)
 }
 
-func (s *service) ValidateToken(tokenString string) (int, string, error) {
-	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+// RefreshTokens обменивает refresh-токен на новую пару. Старый токен становится
+// недействительным, а его повторное использование отзывает всё семейство.
+// client.ClientID должен совпадать с клиентом, которому выдан токен
+func (s *service) RefreshTokens(refreshToken string, client ClientInfo) (*User, *TokenPair, error) {
+	if refreshToken == "" {
+		return nil, nil, ErrRefreshTokenInvalid
+	}
+
+	newRefreshToken, newHash, err := newOpaqueToken()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	expiresAt := time.Now().Add(s.cfg.RefreshTokenTTL)
+	rotated, err := s.repo.RotateRefreshToken(hashToken(refreshToken), newHash, client.ClientID, expiresAt)
+	if errors.Is(err, ErrRefreshTokenReused) && rotated != nil {
+		s.record(audit.TokenReuseDetected, rotated.UserID, client, audit.Metadata{"session_id": rotated.FamilyID})
+		// Семейство refresh-токенов уже отозвано, но выданные сессии access-токены ещё живы:
+		// их мог получить тот, кто украл refresh-токен
+		if revokeErr := s.revocations.RevokeSession(context.Background(), rotated.FamilyID, s.tokens.AccessTTL()); revokeErr != nil {
+			log.Printf("❌ Failed to revoke access tokens of session %s after refresh token reuse: %v", rotated.FamilyID, revokeErr)
 		}
-		return []byte(s.jwtSecret), nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := s.repo.TouchSession(rotated.FamilyID, client.IPAddress, client.UserAgent, expiresAt); err != nil {
+		log.Printf("⚠️ Failed to update session %s: %v", rotated.FamilyID, err)
+	}
+
+	user, err := s.repo.GetUserByID(rotated.UserID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if user.DisabledAt != nil {
+		return nil, nil, ErrRefreshTokenInvalid
+	}
+
+	client.Scope = rotated.Scope
+	pair, err := s.newTokenPair(user, rotated.FamilyID, newRefreshToken, client)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	s.record(audit.TokenRefreshed, user.ID, client, audit.Metadata{"session_id": rotated.FamilyID})
+
+	return user, pair, nil
+}
+
+func (s *service) newTokenPair(user *User, familyID, refreshToken string, client ClientInfo) (*TokenPair, error) {
+	claims := &token.Claims{
+		UserID:    user.ID,
+		Email:     user.Email,
+		SessionID: familyID,
+		ClientID:  client.ClientID,
+		Scope:     client.Scope,
+	}
+
+	// Стороннее приложение получает только выданный scope: без ролей и с отдельным typ,
+	// чтобы его токен не открывал API сервиса от имени пользователя
+	var accessToken string
+	var err error
+	if client.ClientID != "" {
+		accessToken, err = s.tokens.IssueClientAccess(claims)
+	} else {
+		claims.Roles, err = s.roles.GetUserRoles(user.ID)
+		if err != nil {
+			return nil, err
+		}
+		accessToken, err = s.tokens.IssueAccess(claims)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &TokenPair{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(s.tokens.AccessTTL().Seconds()),
+		Scope:        client.Scope,
+	}, nil
+}
+
+// Authenticate проверяет access-токен и то, что он не отозван
+func (s *service) Authenticate(tokenString string) (*token.Claims, error) {
+	return s.authenticate(tokenString, token.TypeAccess)
+}
+
+// AuthenticateClientAccess проверяет access-токен, выданный стороннему OAuth-приложению
+func (s *service) AuthenticateClientAccess(tokenString string) (*token.Claims, error) {
+	return s.authenticate(tokenString, token.TypeClientAccess)
+}
+
+func (s *service) authenticate(tokenString, tokenType string) (*token.Claims, error) {
+	claims, err := s.tokens.Parse(tokenString, tokenType)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx := context.Background()
+
+	if claims.ID != "" {
+		revoked, err := s.revocations.IsTokenRevoked(ctx, claims.ID)
+		if err != nil {
+			return nil, err
+		}
+		if revoked {
+			return nil, ErrTokenRevoked
+		}
+	}
+
+	if claims.SessionID != "" {
+		revoked, err := s.revocations.IsSessionRevoked(ctx, claims.SessionID)
+		if err != nil {
+			return nil, err
+		}
+		if revoked {
+			return nil, ErrTokenRevoked
+		}
+	}
+
+	// Токены сервисных аккаунтов отзываются по sid (id API-ключа)
+	if claims.IsServiceAccount() {
+		return claims, nil
+	}
+
+	revokedBefore, err := s.revocations.UserTokensRevokedBefore(ctx, claims.UserID)
+	if err != nil {
+		return nil, err
+	}
+	// iat хранится с точностью до секунды, поэтому токены, выданные в секунду отзыва,
+	// остаются действительными: иначе клиент не смог бы сразу получить новый токен
+	if !revokedBefore.IsZero() && (claims.IssuedAt == nil || claims.IssuedAt.Before(revokedBefore)) {
+		return nil, ErrTokenRevoked
+	}
+
+	return claims, nil
+}
+
+// Logout отзывает текущий access-токен, семейство refresh-токенов его сессии и остальные
+// access-токены этой сессии (выданные ранее и ещё не истёкшие)
+func (s *service) Logout(claims *token.Claims) error {
+	if claims.SessionID != "" {
+		if err := s.repo.RevokeTokenFamily(claims.SessionID); err != nil {
+			return err
+		}
+		if err := s.revocations.RevokeSession(context.Background(), claims.SessionID, s.tokens.AccessTTL()); err != nil {
+			return err
+		}
+	}
+
+	if claims.ID == "" || claims.ExpiresAt == nil {
+		return nil
+	}
+	return s.revocations.RevokeToken(context.Background(), claims.ID, time.Until(claims.ExpiresAt.Time))
+}
+
+// RevokeAllSessions - "выйти на всех устройствах": отзывает все refresh-токены
+// пользователя и все access-токены, выданные до текущего момента
+func (s *service) RevokeAllSessions(userID int) error {
+	if err := s.repo.RevokeUserRefreshTokens(userID); err != nil {
+		return err
+	}
+	return s.ExpireAccessTokens(userID)
+}
+
+// ExpireAccessTokens отзывает все выданные access-токены пользователя, не трогая refresh-токены.
+// Клиенты просто обновят токены и получат актуальные роли
+func (s *service) ExpireAccessTokens(userID int) error {
+	return s.revocations.RevokeUserTokens(context.Background(), userID, time.Now(), s.tokens.AccessTTL())
+}
+
+// RequestPasswordReset отправляет ссылку для сброса пароля. Для неизвестного email
+// молча ничего не делает, чтобы не раскрывать, зарегистрирован ли адрес
+func (s *service) RequestPasswordReset(email string) error {
+	user, err := s.repo.GetUserByEmail(email)
+	if err != nil {
+		return nil
+	}
+
+	// Пока недавняя ссылка действует, новую не шлём: иначе запросами можно завалить ящик письмами
+	if s.cfg.PasswordResetCooldown > 0 {
+		recent, err := s.repo.HasRecentPasswordResetToken(user.ID, time.Now().Add(-s.cfg.PasswordResetCooldown))
+		if err != nil {
+			return err
+		}
+		if recent {
+			log.Printf("⚠️ Password reset for user %d throttled: link already sent", user.ID)
+			return nil
+		}
+	}
+
+	return s.sendPasswordReset(user)
+}
+
+func (s *service) sendPasswordReset(user *User) error {
+	token, tokenHash, err := newOpaqueToken()
+	if err != nil {
+		return err
+	}
+
+	if err := s.repo.SavePasswordResetToken(user.ID, tokenHash, time.Now().Add(s.cfg.PasswordResetTTL)); err != nil {
+		return err
+	}
+
+	return s.notifier.Send(context.Background(), notify.Message{
+		To:      user.Email,
+		Subject: "Восстановление пароля",
+		Body: fmt.Sprintf(
+			"Чтобы задать новый пароль, перейдите по ссылке: %s/reset-password?token=%s\nСсылка действует %s. Если вы не запрашивали сброс, просто проигнорируйте это письмо.",
+			s.cfg.FrontendURL, url.QueryEscape(token), s.cfg.PasswordResetTTL,
+		),
 	})
+}
+
+// ResetPassword задаёт новый пароль по одноразовому токену и завершает все сессии пользователя
+func (s *service) ResetPassword(token, newPassword string) (int, error) {
+	// Проверяем пароль до погашения токена, чтобы после ошибки можно было попробовать другой
+	userID, err := s.repo.GetPasswordResetTokenUser(hashToken(token))
+	if err != nil {
+		return 0, err
+	}
+	user, err := s.repo.GetUserByID(userID)
+	if err != nil {
+		return 0, err
+	}
+	if err := s.policy.Validate(newPassword, user.Email); err != nil {
+		return 0, err
+	}
+
+	userID, err = s.repo.ConsumePasswordResetToken(hashToken(token))
+	if err != nil {
+		return 0, err
+	}
+
+	hashedPassword, err := s.passwords.Hash(newPassword)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := s.repo.UpdatePassword(userID, string(hashedPassword)); err != nil {
+		return 0, err
+	}
+
+	// Владелец подтвердил доступ к почте - снимаем блокировку входа. Новый пароль
+	// должен работать, поэтому и вход только по passkey выключается (ключи могли потерять)
+	s.resetLoginFailures(user.Email)
+	if user.PasskeyOnly {
+		if err := s.repo.SetPasskeyOnly(userID, false); err != nil {
+			return 0, err
+		}
+	}
+
+	return userID, s.RevokeAllSessions(userID)
+}
 
+// VerifyEmail подтверждает email по токену из письма
+func (s *service) VerifyEmail(token string) error {
+	userID, err := s.repo.ConsumeEmailVerificationToken(hashToken(token))
 	if err != nil {
-		return 0, "", err
+		return err
 	}
+	return s.repo.MarkEmailVerified(userID)
+}
 
-	if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
-		userID := int(claims["user_id"].(float64))
-		email := claims["email"].(string)
-		return userID, email, nil
+// ResendVerificationEmail повторно отправляет письмо с подтверждением.
+// Для неизвестных и уже подтверждённых адресов ничего не делает
+func (s *service) ResendVerificationEmail(email string) error {
+	user, err := s.repo.GetUserByEmail(email)
+	if err != nil || user.EmailVerifiedAt != nil {
+		return nil
 	}
+	return s.sendVerificationEmail(user)
+}
 
-	return 0, "", errors.New("invalid token")
+func (s *service) VerificationPolicy() VerificationPolicy {
+	return s.cfg.Verification
 }
 
-func (s *service) GetUserByID(userID int) (*User, error) {
-	return s.repo.GetUserByID(userID)
+func (s *service) CookiePolicy() CookiePolicy {
+	policy := s.cfg.Cookies
+	policy.RefreshTTL = s.cfg.RefreshTokenTTL
+	return policy
+}
+
+func (s *service) sendVerificationEmail(user *User) error {
+	token, tokenHash, err := newOpaqueToken()
+	if err != nil {
+		return err
+	}
+
+	if err := s.repo.SaveEmailVerificationToken(user.ID, tokenHash, time.Now().Add(s.cfg.EmailVerificationTTL)); err != nil {
+		return err
+	}
+
+	s.sendNotification(notify.Message{
+		To:      user.Email,
+		Subject: "Подтверждение email",
+		Body: fmt.Sprintf(
+			"Подтвердите адрес, перейдя по ссылке: %s/verify-email?token=%s\nСсылка действует %s.",
+			s.cfg.FrontendURL, url.QueryEscape(token), s.cfg.EmailVerificationTTL,
+		),
+	})
+	return nil
+}
+
+// sendNotification отправляет уведомление, не прерывая основную операцию при ошибке доставки
+func (s *service) sendNotification(msg notify.Message) {
+	if err := s.notifier.Send(context.Background(), msg); err != nil {
+		log.Printf("❌ Failed to send %q to %s: %v", msg.Subject, msg.To, err)
+	}
+}
+
+// DisableUser блокирует аккаунт и завершает все его сессии
+func (s *service) DisableUser(userID int) error {
+	if err := s.repo.SetUserDisabled(userID, true); err != nil {
+		return err
+	}
+	return s.RevokeAllSessions(userID)
+}
+
+func (s *service) EnableUser(userID int) error {
+	return s.repo.SetUserDisabled(userID, false)
+}
+
+// ForcePasswordReset запрещает вход по старому паролю, завершает сессии
+// и отправляет пользователю ссылку для установки нового пароля
+func (s *service) ForcePasswordReset(userID int) error {
+	user, err := s.repo.GetUserByID(userID)
+	if err != nil {
+		return err
+	}
+
+	if err := s.repo.RequirePasswordReset(userID); err != nil {
+		return err
+	}
+	if err := s.RevokeAllSessions(userID); err != nil {
+		return err
+	}
+
+	return s.sendPasswordReset(user)
+}
+
+// rehashPassword пересчитывает устаревший хэш (другой алгоритм или старые параметры),
+// пока пароль известен в открытом виде. Ошибка не мешает входу - попробуем в следующий раз
+func (s *service) rehashPassword(user *User, plain string) {
+	hash, err := s.passwords.Hash(plain)
+	if err == nil {
+		err = s.repo.UpdatePasswordHash(user.ID, hash)
+	}
+	if err != nil {
+		log.Printf("⚠️ Failed to rehash password for user %d: %v", user.ID, err)
+		return
+	}
+	user.PasswordHash = hash
+	log.Printf("🔐 Password hash upgraded for user %d", user.ID)
+}
+
+// verifyDummyPassword проверяет пароль против заранее посчитанного хэша, чтобы по времени
+// ответа нельзя было отличить неизвестный email от неверного пароля
+func (s *service) verifyDummyPassword(password string) {
+	if s.dummyHash == "" {
+		return
+	}
+	_, _, _ = s.passwords.Verify(s.dummyHash, password)
+}
+
+// checkLockout возвращает *LockedError, если заблокирован вход в аккаунт или с этого IP.
+// Ошибки хранилища не блокируют вход, чтобы сбой Redis не положил авторизацию
+func (s *service) checkLockout(email, clientIP string) error {
+	var retryAfter time.Duration
+	for _, key := range s.lockoutKeys(email, clientIP) {
+		left, err := s.attempts.LockedFor(context.Background(), key)
+		if err != nil {
+			log.Printf("⚠️ Failed to check login lockout for %s: %v", key, err)
+			continue
+		}
+		if left > retryAfter {
+			retryAfter = left
+		}
+	}
+
+	if retryAfter > 0 {
+		return &LockedError{RetryAfter: retryAfter}
+	}
+	return nil
+}
+
+// registerLoginFailure учитывает неудачную попытку и блокирует вход при превышении порога
+func (s *service) registerLoginFailure(email, clientIP string) {
+	policy := s.cfg.Lockout
+	limits := map[string]int{}
+	if policy.MaxAccountFailures > 0 {
+		limits[accountLockoutKey(email)] = policy.MaxAccountFailures
+	}
+	if policy.MaxIPFailures > 0 && clientIP != "" {
+		limits[ipLockoutKey(clientIP)] = policy.MaxIPFailures
+	}
+
+	ctx := context.Background()
+	for key, limit := range limits {
+		failures, err := s.attempts.RegisterFailure(ctx, key, policy.FailureWindow)
+		if err != nil {
+			log.Printf("⚠️ Failed to record login failure for %s: %v", key, err)
+			continue
+		}
+
+		duration := policy.lockoutDuration(failures, limit)
+		if duration <= 0 {
+			continue
+		}
+		if err := s.attempts.Lock(ctx, key, duration); err != nil {
+			log.Printf("⚠️ Failed to lock login for %s: %v", key, err)
+			continue
+		}
+		log.Printf("🔒 Login locked for %s for %s after %d failed attempts", key, duration, failures)
+	}
+}
+
+func (s *service) resetLoginFailures(email string) {
+	if s.cfg.Lockout.MaxAccountFailures <= 0 {
+		return
+	}
+	if err := s.attempts.ResetFailures(context.Background(), accountLockoutKey(email)); err != nil {
+		log.Printf("⚠️ Failed to reset login failures for %s: %v", email, err)
+	}
+}
+
+func (s *service) lockoutKeys(email, clientIP string) []string {
+	var keys []string
+	if s.cfg.Lockout.MaxAccountFailures > 0 {
+		keys = append(keys, accountLockoutKey(email))
+	}
+	if s.cfg.Lockout.MaxIPFailures > 0 && clientIP != "" {
+		keys = append(keys, ipLockoutKey(clientIP))
+	}
+	return keys
 }
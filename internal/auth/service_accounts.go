@@ -0,0 +1,236 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"auth-user-service/internal/token"
+)
+
+// apiKeyPrefix - начало всех API-ключей: по нему AuthMiddleware отличает ключ от JWT,
+// а сканеры секретов находят ключи, случайно попавшие в код
+const apiKeyPrefix = "sk_"
+
+var (
+	ErrUnknownScope = errors.New("unknown scope")
+	ErrInvalidScope = errors.New("requested scope exceeds granted scopes")
+)
+
+// CreateServiceAccount заводит сервисный аккаунт. Scopes - названия прав RBAC,
+// которые аккаунт получает вместо ролей
+func (s *service) CreateServiceAccount(name string, scopes []string, createdBy int) (*ServiceAccount, error) {
+	scopes = uniqueScopes(scopes)
+	if len(scopes) > 0 {
+		existing, err := s.repo.ExistingPermissions(scopes)
+		if err != nil {
+			return nil, err
+		}
+		if len(existing) != len(scopes) {
+			return nil, fmt.Errorf("%w: %s", ErrUnknownScope, strings.Join(missingScopes(scopes, existing), ", "))
+		}
+	}
+
+	account := &ServiceAccount{Name: name, Scopes: scopes}
+	if createdBy != 0 {
+		account.CreatedBy = &createdBy
+	}
+	if err := s.repo.CreateServiceAccount(account); err != nil {
+		return nil, err
+	}
+	return account, nil
+}
+
+func (s *service) ListServiceAccounts() ([]ServiceAccount, error) {
+	return s.repo.ListServiceAccounts()
+}
+
+// DisableServiceAccount отключает аккаунт, отзывает его ключи и выданные по ним access-токены
+func (s *service) DisableServiceAccount(id int) error {
+	keyIDs, err := s.repo.DisableServiceAccount(id)
+	if err != nil {
+		return err
+	}
+	for _, keyID := range keyIDs {
+		if err := s.revocations.RevokeSession(context.Background(), keyID, s.tokens.AccessTTL()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CreateAPIKey выпускает ключ. Ключ возвращается один раз, в БД хранится только хэш.
+// ttl = 0 - бессрочный ключ
+func (s *service) CreateAPIKey(serviceAccountID int, name string, ttl time.Duration) (*APIKey, string, error) {
+	keyID, err := newID()
+	if err != nil {
+		return nil, "", err
+	}
+	secret, _, err := newOpaqueToken()
+	if err != nil {
+		return nil, "", err
+	}
+	apiKey := apiKeyPrefix + secret
+
+	key := &APIKey{
+		ID:               keyID,
+		ServiceAccountID: serviceAccountID,
+		Name:             name,
+		Prefix:           apiKey[:len(apiKeyPrefix)+8],
+	}
+	if ttl > 0 {
+		expiresAt := time.Now().Add(ttl)
+		key.ExpiresAt = &expiresAt
+	}
+
+	if err := s.repo.CreateAPIKey(key, hashToken(apiKey)); err != nil {
+		return nil, "", err
+	}
+	return key, apiKey, nil
+}
+
+func (s *service) ListAPIKeys(serviceAccountID int) ([]APIKey, error) {
+	return s.repo.ListAPIKeys(serviceAccountID)
+}
+
+// RevokeAPIKey отзывает ключ и access-токены, полученные по нему через client_credentials
+func (s *service) RevokeAPIKey(serviceAccountID int, keyID string) error {
+	if err := s.repo.RevokeAPIKey(serviceAccountID, keyID); err != nil {
+		return err
+	}
+	return s.revocations.RevokeSession(context.Background(), keyID, s.tokens.AccessTTL())
+}
+
+// AuthenticateAPIKey проверяет ключ, предъявленный напрямую в запросе, и возвращает
+// claims, как если бы аккаунт предъявил access-токен
+func (s *service) AuthenticateAPIKey(apiKey string) (*token.Claims, error) {
+	account, key, err := s.lookupAPIKey(apiKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return serviceAccountClaims(account, key), nil
+}
+
+// ClientCredentialsToken - grant client_credentials (RFC 6749, 4.4): client_id - id
+// сервисного аккаунта, client_secret - его API-ключ. Refresh-токен не выдаётся,
+// за новым access-токеном аккаунт приходит с тем же ключом
+func (s *service) ClientCredentialsToken(clientID, clientSecret, scope string) (*TokenPair, error) {
+	account, key, err := s.authenticateClient(clientID, clientSecret)
+	if err != nil {
+		return nil, err
+	}
+
+	granted := account.Scopes
+	if requested := strings.Fields(scope); len(requested) > 0 {
+		for _, sc := range requested {
+			if !containsScope(account.Scopes, sc) {
+				return nil, ErrInvalidScope
+			}
+		}
+		granted = uniqueScopes(requested)
+	}
+
+	accessToken, err := s.tokens.IssueAccess(&token.Claims{
+		ServiceAccountID: account.ID,
+		SessionID:        key.ID,
+		Scope:            strings.Join(granted, " "),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &TokenPair{
+		AccessToken: accessToken,
+		TokenType:   "Bearer",
+		ExpiresIn:   int(s.tokens.AccessTTL().Seconds()),
+		Scope:       strings.Join(granted, " "),
+	}, nil
+}
+
+// AuthenticateServiceAccount проверяет учётные данные клиента (id аккаунта и API-ключ)
+// и возвращает claims аккаунта, как AuthenticateAPIKey
+func (s *service) AuthenticateServiceAccount(clientID, clientSecret string) (*token.Claims, error) {
+	account, key, err := s.authenticateClient(clientID, clientSecret)
+	if err != nil {
+		return nil, err
+	}
+
+	return serviceAccountClaims(account, key), nil
+}
+
+func (s *service) authenticateClient(clientID, clientSecret string) (*ServiceAccount, *APIKey, error) {
+	account, key, err := s.lookupAPIKey(clientSecret)
+	if err != nil {
+		return nil, nil, err
+	}
+	if strconv.Itoa(account.ID) != clientID {
+		return nil, nil, ErrAPIKeyInvalid
+	}
+	return account, key, nil
+}
+
+func (s *service) lookupAPIKey(apiKey string) (*ServiceAccount, *APIKey, error) {
+	if !strings.HasPrefix(apiKey, apiKeyPrefix) {
+		return nil, nil, ErrAPIKeyInvalid
+	}
+
+	account, key, err := s.repo.GetServiceAccountByAPIKey(hashToken(apiKey))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := s.repo.TouchAPIKey(key.ID); err != nil {
+		log.Printf("⚠️ Failed to update last use of API key %s: %v", key.ID, err)
+	}
+	return account, key, nil
+}
+
+// serviceAccountClaims - claims запроса, подписанного API-ключом напрямую
+func serviceAccountClaims(account *ServiceAccount, key *APIKey) *token.Claims {
+	return &token.Claims{
+		ServiceAccountID: account.ID,
+		Type:             token.TypeAccess,
+		SessionID:        key.ID,
+		Scope:            strings.Join(account.Scopes, " "),
+	}
+}
+
+// IsAPIKey - строка похожа на API-ключ, а не на JWT
+func IsAPIKey(credential string) bool {
+	return strings.HasPrefix(credential, apiKeyPrefix)
+}
+
+func containsScope(scopes []string, scope string) bool {
+	for _, sc := range scopes {
+		if sc == scope {
+			return true
+		}
+	}
+	return false
+}
+
+func uniqueScopes(scopes []string) []string {
+	result := []string{}
+	for _, sc := range scopes {
+		sc = strings.TrimSpace(sc)
+		if sc != "" && !containsScope(result, sc) {
+			result = append(result, sc)
+		}
+	}
+	return result
+}
+
+func missingScopes(scopes, existing []string) []string {
+	var missing []string
+	for _, sc := range scopes {
+		if !containsScope(existing, sc) {
+			missing = append(missing, sc)
+		}
+	}
+	return missing
+}
@@ -0,0 +1,280 @@
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"auth-user-service/internal/audit"
+
+	"github.com/go-chi/chi/v5"
+)
+
+type CreateServiceAccountRequest struct {
+	Name   string   `json:"name"`
+	Scopes []string `json:"scopes"`
+}
+
+type CreateAPIKeyRequest struct {
+	Name string `json:"name"`
+	// ExpiresInDays - срок действия ключа, 0 - бессрочный
+	ExpiresInDays int `json:"expires_in_days"`
+}
+
+// CreateServiceAccount - админский эндпоинт создания сервисного аккаунта
+func (h *Handler) CreateServiceAccount(w http.ResponseWriter, r *http.Request) {
+	var req CreateServiceAccountRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, `{"error": "Invalid request"}`, http.StatusBadRequest)
+		return
+	}
+
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		http.Error(w, `{"error": "Name is required"}`, http.StatusBadRequest)
+		return
+	}
+
+	adminID, _ := r.Context().Value("userID").(int)
+	account, err := h.service.CreateServiceAccount(req.Name, req.Scopes, adminID)
+	if errors.Is(err, ErrUnknownScope) {
+		http.Error(w, `{"error": "Unknown scope: scopes must be permission names"}`, http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		log.Printf("❌ Failed to create service account: %v", err)
+		http.Error(w, `{"error": "Failed to create service account"}`, http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("🛡️ Admin %d created service account %d (%s) with scopes %v", adminID, account.ID, account.Name, account.Scopes)
+	h.record(r, audit.AdminServiceAccountCreated, 0, audit.Metadata{"service_account_id": account.ID, "name": account.Name, "scopes": account.Scopes})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	err = json.NewEncoder(w).Encode(account)
+	if err != nil {
+		return
+	}
+}
+
+func (h *Handler) ListServiceAccounts(w http.ResponseWriter, r *http.Request) {
+	accounts, err := h.service.ListServiceAccounts()
+	if err != nil {
+		log.Printf("❌ Failed to list service accounts: %v", err)
+		http.Error(w, `{"error": "Failed to list service accounts"}`, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(accounts)
+	if err != nil {
+		return
+	}
+}
+
+// DisableServiceAccount отключает аккаунт вместе со всеми его ключами
+func (h *Handler) DisableServiceAccount(w http.ResponseWriter, r *http.Request) {
+	accountID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, `{"error": "Invalid service account ID"}`, http.StatusBadRequest)
+		return
+	}
+
+	err = h.service.DisableServiceAccount(accountID)
+	if errors.Is(err, ErrServiceAccountNotFound) {
+		http.Error(w, `{"error": "Service account not found"}`, http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("❌ Failed to disable service account %d: %v", accountID, err)
+		http.Error(w, `{"error": "Failed to disable service account"}`, http.StatusInternalServerError)
+		return
+	}
+
+	adminID, _ := r.Context().Value("userID").(int)
+	log.Printf("🛡️ Admin %d disabled service account %d", adminID, accountID)
+	h.record(r, audit.AdminServiceAccountDisabled, 0, audit.Metadata{"service_account_id": accountID})
+
+	response := map[string]string{
+		"message": "Service account disabled",
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		return
+	}
+}
+
+// CreateAPIKey выпускает ключ сервисному аккаунту. Ключ виден только в этом ответе
+func (h *Handler) CreateAPIKey(w http.ResponseWriter, r *http.Request) {
+	accountID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, `{"error": "Invalid service account ID"}`, http.StatusBadRequest)
+		return
+	}
+
+	var req CreateAPIKeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, `{"error": "Invalid request"}`, http.StatusBadRequest)
+		return
+	}
+	if req.ExpiresInDays < 0 {
+		http.Error(w, `{"error": "expires_in_days must not be negative"}`, http.StatusBadRequest)
+		return
+	}
+
+	key, apiKey, err := h.service.CreateAPIKey(accountID, strings.TrimSpace(req.Name), time.Duration(req.ExpiresInDays)*24*time.Hour)
+	if errors.Is(err, ErrServiceAccountNotFound) {
+		http.Error(w, `{"error": "Service account not found or disabled"}`, http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("❌ Failed to create API key for service account %d: %v", accountID, err)
+		http.Error(w, `{"error": "Failed to create API key"}`, http.StatusInternalServerError)
+		return
+	}
+
+	adminID, _ := r.Context().Value("userID").(int)
+	log.Printf("🛡️ Admin %d created API key %s for service account %d", adminID, key.ID, accountID)
+	h.record(r, audit.AdminAPIKeyCreated, 0, audit.Metadata{"service_account_id": accountID, "key_id": key.ID})
+
+	response := map[string]interface{}{
+		"id":                 key.ID,
+		"service_account_id": key.ServiceAccountID,
+		"name":               key.Name,
+		"prefix":             key.Prefix,
+		"expires_at":         key.ExpiresAt,
+		"created_at":         key.CreatedAt,
+		"key":                apiKey,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		return
+	}
+}
+
+func (h *Handler) ListAPIKeys(w http.ResponseWriter, r *http.Request) {
+	accountID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, `{"error": "Invalid service account ID"}`, http.StatusBadRequest)
+		return
+	}
+
+	keys, err := h.service.ListAPIKeys(accountID)
+	if err != nil {
+		log.Printf("❌ Failed to list API keys of service account %d: %v", accountID, err)
+		http.Error(w, `{"error": "Failed to list API keys"}`, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(keys)
+	if err != nil {
+		return
+	}
+}
+
+func (h *Handler) RevokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	accountID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, `{"error": "Invalid service account ID"}`, http.StatusBadRequest)
+		return
+	}
+
+	keyID := chi.URLParam(r, "keyID")
+	err = h.service.RevokeAPIKey(accountID, keyID)
+	if errors.Is(err, ErrAPIKeyNotFound) {
+		http.Error(w, `{"error": "API key not found"}`, http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("❌ Failed to revoke API key %s: %v", keyID, err)
+		http.Error(w, `{"error": "Failed to revoke API key"}`, http.StatusInternalServerError)
+		return
+	}
+
+	adminID, _ := r.Context().Value("userID").(int)
+	log.Printf("🛡️ Admin %d revoked API key %s of service account %d", adminID, keyID, accountID)
+	h.record(r, audit.AdminAPIKeyRevoked, 0, audit.Metadata{"service_account_id": accountID, "key_id": keyID})
+
+	response := map[string]string{
+		"message": "API key revoked",
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		return
+	}
+}
+
+// ClientCredentialsToken - POST /oauth/token для сервисных аккаунтов (grant_type=client_credentials).
+// Учётные данные принимаются в Basic-авторизации или в теле формы
+func (h *Handler) ClientCredentialsToken(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_request")
+		return
+	}
+	if r.PostForm.Get("grant_type") != "client_credentials" {
+		writeOAuthError(w, http.StatusBadRequest, "unsupported_grant_type")
+		return
+	}
+
+	clientID, clientSecret, ok := r.BasicAuth()
+	if ok {
+		clientID, _ = url.QueryUnescape(clientID)
+		clientSecret, _ = url.QueryUnescape(clientSecret)
+	} else {
+		clientID, clientSecret = r.PostForm.Get("client_id"), r.PostForm.Get("client_secret")
+	}
+
+	tokens, err := h.service.ClientCredentialsToken(clientID, clientSecret, r.PostForm.Get("scope"))
+	switch {
+	case errors.Is(err, ErrAPIKeyInvalid):
+		w.Header().Set("WWW-Authenticate", `Basic realm="token"`)
+		writeOAuthError(w, http.StatusUnauthorized, "invalid_client")
+		return
+	case errors.Is(err, ErrInvalidScope):
+		writeOAuthError(w, http.StatusBadRequest, "invalid_scope")
+		return
+	case err != nil:
+		log.Printf("❌ Failed to issue token for service account %s: %v", clientID, err)
+		writeOAuthError(w, http.StatusInternalServerError, "server_error")
+		return
+	}
+
+	response := map[string]interface{}{
+		"access_token": tokens.AccessToken,
+		"token_type":   tokens.TokenType,
+		"expires_in":   tokens.ExpiresIn,
+		"scope":        tokens.Scope,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		return
+	}
+}
+
+// writeOAuthError - ошибка в формате RFC 6749, 5.2
+func writeOAuthError(w http.ResponseWriter, status int, code string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	err := json.NewEncoder(w).Encode(map[string]string{"error": code})
+	if err != nil {
+		return
+	}
+}
@@ -0,0 +1,86 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"auth-user-service/internal/notify"
+)
+
+// ClientInfo - устройство, с которого выполняется вход
+type ClientInfo struct {
+	UserAgent string
+	IPAddress string
+	// ClientID - OAuth-клиент (наше другое приложение), которому выдаются токены.
+	// Пусто для собственного фронтенда
+	ClientID string
+	// Scope - разрешения, выданные клиенту
+	Scope string
+	// RequestID - идентификатор запроса для журнала безопасности
+	RequestID string
+}
+
+// maxUserAgentLength - длиннее User-Agent не бывает у настоящих браузеров
+const maxUserAgentLength = 512
+
+// startSession записывает новую сессию и, если включено, предупреждает
+// пользователя о входе с незнакомого устройства
+func (s *service) startSession(user *User, sessionID string, client ClientInfo, expiresAt time.Time) error {
+	if len(client.UserAgent) > maxUserAgentLength {
+		client.UserAgent = client.UserAgent[:maxUserAgentLength]
+	}
+
+	newDevice := false
+	if s.cfg.NotifyNewDevice {
+		hasSessions, hasUserAgent, err := s.repo.GetSessionHistory(user.ID, client.UserAgent)
+		if err != nil {
+			log.Printf("⚠️ Failed to check session history for user %d: %v", user.ID, err)
+		}
+		// Первый вход после регистрации новым устройством не считаем
+		newDevice = err == nil && hasSessions && !hasUserAgent
+	}
+
+	session := &Session{
+		ID:        sessionID,
+		UserID:    user.ID,
+		UserAgent: client.UserAgent,
+		IPAddress: client.IPAddress,
+		ClientID:  client.ClientID,
+		Scope:     client.Scope,
+		ExpiresAt: expiresAt,
+	}
+	if err := s.repo.CreateSession(session); err != nil {
+		return err
+	}
+
+	if newDevice {
+		log.Printf("🔐 User %d logged in from a new device (%s)", user.ID, client.IPAddress)
+		s.sendNotification(notify.Message{
+			To:      user.Email,
+			Subject: "Вход с нового устройства",
+			Body: fmt.Sprintf(
+				"В ваш аккаунт выполнен вход с нового устройства.\nУстройство: %s\nIP-адрес: %s\nВремя: %s\n"+
+					"Если это были не вы, завершите сеанс в настройках аккаунта и смените пароль: %s/forgot-password",
+				client.UserAgent, client.IPAddress, session.CreatedAt.Format("02.01.2006 15:04 MST"), s.cfg.FrontendURL,
+			),
+		})
+	}
+
+	return nil
+}
+
+// ListSessions - активные сессии пользователя
+func (s *service) ListSessions(userID int) ([]Session, error) {
+	return s.repo.ListSessions(userID)
+}
+
+// RevokeSession завершает сессию: её refresh-токены отзываются в БД,
+// а access-токены с этим sid - в списке отзыва до истечения их срока
+func (s *service) RevokeSession(userID int, sessionID string) error {
+	if err := s.repo.RevokeSession(userID, sessionID); err != nil {
+		return err
+	}
+	return s.revocations.RevokeSession(context.Background(), sessionID, s.tokens.AccessTTL())
+}
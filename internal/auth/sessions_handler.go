@@ -0,0 +1,92 @@
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"auth-user-service/internal/audit"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+// SessionResponse - сессия в списке устройств
+type SessionResponse struct {
+	Session
+	Current bool `json:"current"`
+}
+
+// ListSessions - устройства, на которых выполнен вход. Текущее помечено current
+func (h *Handler) ListSessions(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int)
+	if !ok {
+		http.Error(w, `{"error": "User not authenticated"}`, http.StatusUnauthorized)
+		return
+	}
+
+	sessions, err := h.service.ListSessions(userID)
+	if err != nil {
+		log.Printf("❌ Failed to list sessions for user %d: %v", userID, err)
+		http.Error(w, `{"error": "Failed to get sessions"}`, http.StatusInternalServerError)
+		return
+	}
+
+	var currentID string
+	if claims, ok := GetClaimsFromContext(r.Context()); ok {
+		currentID = claims.SessionID
+	}
+
+	response := make([]SessionResponse, len(sessions))
+	for i, session := range sessions {
+		response[i] = SessionResponse{Session: session, Current: session.ID == currentID}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		return
+	}
+}
+
+// RevokeSession - выход на выбранном устройстве
+func (h *Handler) RevokeSession(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int)
+	if !ok {
+		http.Error(w, `{"error": "User not authenticated"}`, http.StatusUnauthorized)
+		return
+	}
+
+	sessionID := chi.URLParam(r, "id")
+	err := h.service.RevokeSession(userID, sessionID)
+	if errors.Is(err, ErrSessionNotFound) {
+		http.Error(w, `{"error": "Session not found"}`, http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("❌ Failed to revoke session %s of user %d: %v", sessionID, userID, err)
+		http.Error(w, `{"error": "Failed to revoke session"}`, http.StatusInternalServerError)
+		return
+	}
+	h.record(r, audit.SessionRevoked, userID, audit.Metadata{"session_id": sessionID})
+
+	response := map[string]string{
+		"message": "Session revoked",
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		return
+	}
+}
+
+// clientInfo - устройство клиента для записи сессии
+func clientInfo(r *http.Request) ClientInfo {
+	return ClientInfo{
+		UserAgent: r.UserAgent(),
+		IPAddress: clientIP(r),
+		RequestID: middleware.GetReqID(r.Context()),
+	}
+}
@@ -0,0 +1,158 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"auth-user-service/internal/notify"
+	"auth-user-service/internal/social"
+)
+
+var (
+	ErrSocialEmailMissing  = errors.New("login provider did not return an email")
+	ErrSocialEmailConflict = errors.New("email is registered, sign in and link the provider in settings")
+)
+
+// SocialLogin - результат возврата от внешнего провайдера
+type SocialLogin struct {
+	User *User
+	// Linked - аккаунт провайдера привязан к уже вошедшему пользователю, новые токены не нужны
+	Linked bool
+}
+
+// SocialProviders - провайдеры, через которые можно войти
+func (s *service) SocialProviders() []string {
+	return s.social.Providers()
+}
+
+// StartSocialLogin возвращает адрес страницы входа провайдера и state для cookie браузера.
+// linkUserID != 0 - привязка провайдера к аккаунту вошедшего пользователя
+func (s *service) StartSocialLogin(provider string, linkUserID int) (*social.Authorization, error) {
+	return s.social.AuthURL(context.Background(), provider, linkUserID)
+}
+
+// CompleteSocialLogin обрабатывает возврат от провайдера: привязывает аккаунт провайдера
+// либо находит (или создаёт) пользователя для входа
+func (s *service) CompleteSocialLogin(provider, code, state string) (*SocialLogin, error) {
+	login, err := s.social.Complete(context.Background(), provider, code, state)
+	if err != nil {
+		return nil, err
+	}
+	identity := login.Identity
+
+	if login.LinkUserID != 0 {
+		user, err := s.repo.GetUserByID(login.LinkUserID)
+		if err != nil {
+			return nil, err
+		}
+		if err := s.linkIdentity(user, identity.Provider, identity.Subject, identity.Email); err != nil {
+			return nil, err
+		}
+		return &SocialLogin{User: user, Linked: true}, nil
+	}
+
+	user, err := s.repo.GetUserByIdentity(identity.Provider, identity.Subject)
+	switch {
+	case err == nil:
+		if err := s.repo.TouchIdentity(identity.Provider, identity.Subject, identity.Email); err != nil {
+			log.Printf("⚠️ Failed to update %s identity of user %d: %v", identity.Provider, user.ID, err)
+		}
+	case errors.Is(err, ErrUserNotFound):
+		user, err = s.findOrRegisterSocial(identity.Provider, identity.Subject, identity.Email, identity.EmailVerified, identity.FirstName, identity.LastName)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, err
+	}
+
+	if user.DisabledAt != nil {
+		return nil, ErrAccountDisabled
+	}
+
+	if user.PasswordResetRequired {
+		return nil, ErrPasswordResetRequired
+	}
+
+	if s.cfg.Verification.RequireForLogin && user.EmailVerifiedAt == nil {
+		return nil, ErrEmailNotVerified
+	}
+
+	return &SocialLogin{User: user}, nil
+}
+
+// findOrRegisterSocial - первый вход через провайдера. Если адрес уже зарегистрирован,
+// аккаунт провайдера привязывается к нему, но только когда провайдер подтвердил email:
+// иначе любой мог бы войти в чужой аккаунт, указав у провайдера его адрес.
+// Неподтверждённый локальный аккаунт тоже не привязывается: его мог заранее завести
+// злоумышленник с чужим адресом и паролем, который остался бы у него после привязки
+func (s *service) findOrRegisterSocial(provider, subject, email string, emailVerified bool, firstName, lastName string) (*User, error) {
+	if email == "" {
+		return nil, ErrSocialEmailMissing
+	}
+
+	user, err := s.repo.GetUserByEmail(email)
+	switch {
+	case err == nil:
+		if !emailVerified || user.EmailVerifiedAt == nil {
+			return nil, ErrSocialEmailConflict
+		}
+		if err := s.linkIdentity(user, provider, subject, email); err != nil {
+			return nil, err
+		}
+	case errors.Is(err, ErrUserNotFound):
+		user, err = s.registerPasswordless(email, firstName, lastName)
+		if err != nil {
+			return nil, err
+		}
+		if err := s.repo.LinkIdentity(user.ID, provider, subject, email); err != nil {
+			return nil, err
+		}
+		if !emailVerified {
+			if err := s.sendVerificationEmail(user); err != nil {
+				return nil, err
+			}
+			return user, nil
+		}
+	default:
+		return nil, err
+	}
+
+	if emailVerified && user.EmailVerifiedAt == nil {
+		if err := s.repo.MarkEmailVerified(user.ID); err != nil {
+			return nil, err
+		}
+		now := time.Now()
+		user.EmailVerifiedAt = &now
+	}
+	return user, nil
+}
+
+// linkIdentity привязывает аккаунт провайдера и сообщает об этом владельцу
+func (s *service) linkIdentity(user *User, provider, subject, email string) error {
+	if err := s.repo.LinkIdentity(user.ID, provider, subject, email); err != nil {
+		return err
+	}
+
+	log.Printf("🔐 User %d linked %s account", user.ID, provider)
+	s.sendNotification(notify.Message{
+		To:      user.Email,
+		Subject: "Привязан вход через " + provider,
+		Body: fmt.Sprintf(
+			"К вашему аккаунту привязан вход через %s. Если это были не вы, отвяжите его в настройках аккаунта и смените пароль: %s/forgot-password",
+			provider, s.cfg.FrontendURL,
+		),
+	})
+	return nil
+}
+
+func (s *service) ListIdentities(userID int) ([]LinkedIdentity, error) {
+	return s.repo.ListIdentities(userID)
+}
+
+func (s *service) UnlinkIdentity(userID int, provider string) error {
+	return s.repo.UnlinkIdentity(userID, provider)
+}
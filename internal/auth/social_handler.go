@@ -0,0 +1,270 @@
+package auth
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"auth-user-service/internal/audit"
+	"auth-user-service/internal/social"
+
+	"github.com/go-chi/chi/v5"
+)
+
+type SocialCallbackRequest struct {
+	Code  string `json:"code"`
+	State string `json:"state"`
+	Error string `json:"error"`
+}
+
+// SocialProviders - список провайдеров для кнопок "Войти через ..."
+func (h *Handler) SocialProviders(w http.ResponseWriter, r *http.Request) {
+	response := map[string]interface{}{
+		"providers": h.service.SocialProviders(),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err := json.NewEncoder(w).Encode(response)
+	if err != nil {
+		return
+	}
+}
+
+// StartSocialLogin перенаправляет браузер на страницу входа провайдера
+func (h *Handler) StartSocialLogin(w http.ResponseWriter, r *http.Request) {
+	provider := chi.URLParam(r, "provider")
+
+	authorization, err := h.service.StartSocialLogin(provider, 0)
+	if errors.Is(err, social.ErrUnknownProvider) {
+		http.Error(w, `{"error": "Unknown login provider"}`, http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("❌ Failed to start %s login: %v", provider, err)
+		http.Error(w, `{"error": "Login provider unavailable"}`, http.StatusBadGateway)
+		return
+	}
+
+	h.setOAuthStateCookie(w, authorization)
+	http.Redirect(w, r, authorization.URL, http.StatusFound)
+}
+
+// SocialCallback - возврат от провайдера. Страница фронтенда, на которую провайдер
+// вернул браузер, передаёт code и state (POST), либо провайдер ведёт сразу сюда (GET)
+func (h *Handler) SocialCallback(w http.ResponseWriter, r *http.Request) {
+	provider := chi.URLParam(r, "provider")
+
+	query := r.URL.Query()
+	req := SocialCallbackRequest{Code: query.Get("code"), State: query.Get("state"), Error: query.Get("error")}
+	if r.Method == http.MethodPost {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, `{"error": "Invalid request"}`, http.StatusBadRequest)
+			return
+		}
+	}
+
+	if req.Error != "" {
+		h.clearOAuthStateCookie(w)
+		http.Error(w, `{"error": "Login was cancelled at the provider"}`, http.StatusBadRequest)
+		return
+	}
+
+	// state должен прийти из того же браузера, который начал вход: иначе злоумышленник
+	// мог бы подсунуть жертве свой callback и войти ей в свой аккаунт или привязать его к её
+	if !validOAuthState(r, req.State) {
+		log.Printf("🛡️ %s callback state does not match browser cookie", provider)
+		http.Error(w, `{"error": "Invalid or expired login attempt, start again"}`, http.StatusBadRequest)
+		return
+	}
+	h.clearOAuthStateCookie(w)
+
+	result, err := h.service.CompleteSocialLogin(provider, req.Code, req.State)
+	switch {
+	case errors.Is(err, social.ErrUnknownProvider):
+		http.Error(w, `{"error": "Unknown login provider"}`, http.StatusNotFound)
+		return
+	case errors.Is(err, social.ErrInvalidState):
+		http.Error(w, `{"error": "Invalid or expired login attempt, start again"}`, http.StatusBadRequest)
+		return
+	case errors.Is(err, ErrSocialEmailMissing):
+		http.Error(w, `{"error": "Provider did not share an email address"}`, http.StatusBadRequest)
+		return
+	case errors.Is(err, ErrSocialEmailConflict):
+		http.Error(w, `{"error": "Email already registered, sign in and link the provider in account settings"}`, http.StatusConflict)
+		return
+	case errors.Is(err, ErrIdentityLinked):
+		http.Error(w, `{"error": "This provider account is already linked"}`, http.StatusConflict)
+		return
+	case errors.Is(err, ErrEmailNotVerified):
+		http.Error(w, `{"error": "Email not verified"}`, http.StatusForbidden)
+		return
+	case errors.Is(err, ErrAccountDisabled):
+		http.Error(w, `{"error": "Account disabled"}`, http.StatusForbidden)
+		return
+	case errors.Is(err, ErrPasswordResetRequired):
+		http.Error(w, `{"error": "Password reset required, check your email"}`, http.StatusForbidden)
+		return
+	case err != nil:
+		log.Printf("❌ %s login failed: %v", provider, err)
+		http.Error(w, `{"error": "Failed to login with provider"}`, http.StatusInternalServerError)
+		return
+	}
+
+	user := result.User
+	if result.Linked {
+		h.record(r, audit.IdentityLinked, user.ID, audit.Metadata{"provider": provider})
+
+		response := map[string]string{
+			"message":  "Account linked",
+			"provider": provider,
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		err = json.NewEncoder(w).Encode(response)
+		if err != nil {
+			return
+		}
+		return
+	}
+
+	if user.TOTPEnabledAt != nil {
+		challenge, err := h.service.CreateMFAChallenge(user)
+		if err != nil {
+			http.Error(w, `{"error": "Failed to generate token"}`, http.StatusInternalServerError)
+			return
+		}
+		writeMFAChallenge(w, challenge)
+		return
+	}
+
+	tokens, err := h.service.IssueTokens(user, clientInfo(r))
+	if err != nil {
+		http.Error(w, `{"error": "Failed to generate token"}`, http.StatusInternalServerError)
+		return
+	}
+
+	h.record(r, audit.LoginSucceeded, user.ID, audit.Metadata{"method": "social", "provider": provider})
+	h.writeTokenResponse(w, r, user, tokens)
+}
+
+// LinkIdentity - начало привязки провайдера к аккаунту. Фронтенд отправляет браузер
+// по authorization_url, привязка завершается тем же callback, что и вход
+func (h *Handler) LinkIdentity(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int)
+	if !ok {
+		http.Error(w, `{"error": "User not authenticated"}`, http.StatusUnauthorized)
+		return
+	}
+
+	provider := chi.URLParam(r, "provider")
+	authorization, err := h.service.StartSocialLogin(provider, userID)
+	if errors.Is(err, social.ErrUnknownProvider) {
+		http.Error(w, `{"error": "Unknown login provider"}`, http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("❌ Failed to start %s linking for user %d: %v", provider, userID, err)
+		http.Error(w, `{"error": "Login provider unavailable"}`, http.StatusBadGateway)
+		return
+	}
+
+	h.setOAuthStateCookie(w, authorization)
+
+	response := map[string]string{
+		"authorization_url": authorization.URL,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		return
+	}
+}
+
+// ListIdentities - привязанные аккаунты провайдеров
+func (h *Handler) ListIdentities(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int)
+	if !ok {
+		http.Error(w, `{"error": "User not authenticated"}`, http.StatusUnauthorized)
+		return
+	}
+
+	identities, err := h.service.ListIdentities(userID)
+	if err != nil {
+		log.Printf("❌ Failed to list identities for user %d: %v", userID, err)
+		http.Error(w, `{"error": "Failed to get linked accounts"}`, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(identities)
+	if err != nil {
+		return
+	}
+}
+
+// UnlinkIdentity - отвязка провайдера. Войти по паролю или ссылке из письма можно и после неё
+func (h *Handler) UnlinkIdentity(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int)
+	if !ok {
+		http.Error(w, `{"error": "User not authenticated"}`, http.StatusUnauthorized)
+		return
+	}
+
+	provider := chi.URLParam(r, "provider")
+	err := h.service.UnlinkIdentity(userID, provider)
+	if errors.Is(err, ErrIdentityNotFound) {
+		http.Error(w, `{"error": "Provider is not linked"}`, http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("❌ Failed to unlink %s for user %d: %v", provider, userID, err)
+		http.Error(w, `{"error": "Failed to unlink provider"}`, http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("🔐 User %d unlinked %s account", userID, provider)
+	h.record(r, audit.IdentityUnlinked, userID, audit.Metadata{"provider": provider})
+
+	response := map[string]string{
+		"message": "Provider unlinked",
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		return
+	}
+}
+
+// oauthStateCookie - state начатого входа через провайдера. Нужен только callback,
+// поэтому ограничен путём /auth/oauth. Фронтенд, передающий callback через POST,
+// отправляет запрос с credentials, чтобы браузер приложил cookie
+const (
+	oauthStateCookie = "oauth_state"
+	oauthStatePath   = "/auth/oauth"
+)
+
+func (h *Handler) setOAuthStateCookie(w http.ResponseWriter, authorization *social.Authorization) {
+	policy := h.service.CookiePolicy()
+	// Провайдер возвращает браузер переходом с чужого сайта: cookie со Strict он не приложит
+	if policy.SameSite == http.SameSiteStrictMode {
+		policy.SameSite = http.SameSiteLaxMode
+	}
+	http.SetCookie(w, sessionCookie(policy, oauthStateCookie, authorization.State, oauthStatePath, int(authorization.ExpiresIn.Seconds()), true))
+}
+
+func (h *Handler) clearOAuthStateCookie(w http.ResponseWriter) {
+	http.SetCookie(w, sessionCookie(h.service.CookiePolicy(), oauthStateCookie, "", oauthStatePath, -1, true))
+}
+
+// validOAuthState сравнивает state из callback со значением cookie браузера
+func validOAuthState(r *http.Request, state string) bool {
+	c, err := r.Cookie(oauthStateCookie)
+	if err != nil || c.Value == "" || state == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(c.Value), []byte(state)) == 1
+}
@@ -0,0 +1,280 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"auth-user-service/internal/token"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+const recoveryCodesCount = 10
+
+var (
+	ErrTOTPAlreadyEnabled = errors.New("two-factor authentication already enabled")
+	ErrTOTPNotEnabled     = errors.New("two-factor authentication not enabled")
+	ErrTOTPSetupMissing   = errors.New("two-factor setup not started")
+	ErrInvalidMFACode     = errors.New("invalid two-factor code")
+	ErrMFATokenInvalid    = errors.New("invalid or expired mfa token")
+)
+
+// TOTPSetup - данные для добавления аккаунта в приложение-аутентификатор
+type TOTPSetup struct {
+	Secret     string `json:"secret"`
+	OTPAuthURL string `json:"otpauth_url"`
+}
+
+// MFAChallenge - ответ на логин, когда требуется второй фактор
+type MFAChallenge struct {
+	MFARequired bool   `json:"mfa_required"`
+	MFAToken    string `json:"mfa_token"`
+	ExpiresIn   int    `json:"expires_in"`
+}
+
+// SetupTOTP генерирует новый секрет. 2FA включится только после ConfirmTOTP
+func (s *service) SetupTOTP(userID int) (*TOTPSetup, error) {
+	user, err := s.repo.GetUserByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	if user.TOTPEnabledAt != nil {
+		return nil, ErrTOTPAlreadyEnabled
+	}
+
+	secret, err := generateTOTPSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.repo.SetPendingTOTPSecret(userID, secret); err != nil {
+		return nil, err
+	}
+
+	return &TOTPSetup{
+		Secret:     secret,
+		OTPAuthURL: totpURI(s.cfg.TOTPIssuer, user.Email, secret),
+	}, nil
+}
+
+// ConfirmTOTP включает 2FA после проверки первого кода и возвращает коды восстановления.
+// Коды показываются пользователю один раз, в БД хранятся только хеши
+func (s *service) ConfirmTOTP(userID int, code string) ([]string, error) {
+	user, err := s.repo.GetUserByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	if user.TOTPEnabledAt != nil {
+		return nil, ErrTOTPAlreadyEnabled
+	}
+
+	secret, lastStep, err := s.repo.GetTOTPSecret(userID)
+	if err != nil {
+		return nil, err
+	}
+	if secret == "" {
+		return nil, ErrTOTPSetupMissing
+	}
+
+	step, ok := validateTOTP(secret, code, time.Now(), lastStep)
+	if !ok {
+		return nil, ErrInvalidMFACode
+	}
+	if _, err := s.repo.AdvanceTOTPStep(userID, step); err != nil {
+		return nil, err
+	}
+
+	codes, err := generateRecoveryCodes(recoveryCodesCount)
+	if err != nil {
+		return nil, err
+	}
+
+	hashes := make([]string, 0, len(codes))
+	for _, c := range codes {
+		hash, err := bcrypt.GenerateFromPassword([]byte(c), bcrypt.DefaultCost)
+		if err != nil {
+			return nil, err
+		}
+		hashes = append(hashes, string(hash))
+	}
+
+	if err := s.repo.ReplaceRecoveryCodes(userID, hashes); err != nil {
+		return nil, err
+	}
+	if err := s.repo.EnableTOTP(userID); err != nil {
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+// DisableTOTP выключает 2FA. Требует пароль и действующий код (TOTP или код восстановления)
+func (s *service) DisableTOTP(userID int, password, code string) error {
+	user, err := s.repo.GetUserByID(userID)
+	if err != nil {
+		return err
+	}
+	if user.TOTPEnabledAt == nil {
+		return ErrTOTPNotEnabled
+	}
+
+	if err := s.checkPassword(user, password); err != nil {
+		return err
+	}
+
+	if err := s.verifySecondFactor(user, code); err != nil {
+		return err
+	}
+
+	return s.repo.DisableTOTP(userID)
+}
+
+// CreateMFAChallenge выдаёт короткоживущий токен "mfa_pending" после проверки пароля.
+// Он не даёт доступа к API и обменивается на обычные токены через VerifyMFAChallenge
+func (s *service) CreateMFAChallenge(user *User) (*MFAChallenge, error) {
+	mfaToken, err := s.tokens.Issue(&token.Claims{
+		UserID: user.ID,
+		Type:   token.TypeMFAPending,
+	}, s.cfg.MFAChallengeTTL)
+	if err != nil {
+		return nil, err
+	}
+
+	return &MFAChallenge{
+		MFARequired: true,
+		MFAToken:    mfaToken,
+		ExpiresIn:   int(s.cfg.MFAChallengeTTL.Seconds()),
+	}, nil
+}
+
+// VerifyMFAChallenge проверяет второй фактор и гасит challenge-токен
+func (s *service) VerifyMFAChallenge(mfaToken, code string, client ClientInfo) (*User, error) {
+	claims, err := s.tokens.Parse(mfaToken, token.TypeMFAPending)
+	if err != nil || claims.ID == "" {
+		return nil, ErrMFATokenInvalid
+	}
+
+	ctx := context.Background()
+	revoked, err := s.revocations.IsTokenRevoked(ctx, claims.ID)
+	if err != nil {
+		return nil, err
+	}
+	if revoked {
+		return nil, ErrMFATokenInvalid
+	}
+
+	user, err := s.repo.GetUserByID(claims.UserID)
+	if err != nil {
+		return nil, ErrMFATokenInvalid
+	}
+	if user.TOTPEnabledAt == nil {
+		return nil, ErrTOTPNotEnabled
+	}
+
+	// Неверные коды учитываются в блокировке входа, поэтому перебор через новые
+	// challenge упирается в ту же блокировку аккаунта и IP
+	if err := s.checkLockout(user.Email, client.IPAddress); err != nil {
+		s.recordLoginFailure(user.ID, client, "locked", nil)
+		return nil, err
+	}
+
+	if err := s.verifySecondFactor(user, code); err != nil {
+		if errors.Is(err, ErrInvalidMFACode) {
+			s.recordLoginFailure(user.ID, client, "invalid_mfa_code", nil)
+			s.registerLoginFailure(user.Email, client.IPAddress)
+			s.registerMFAFailure(claims)
+		}
+		return nil, err
+	}
+
+	s.resetLoginFailures(user.Email)
+
+	// Challenge одноразовый
+	if err := s.revocations.RevokeToken(ctx, claims.ID, time.Until(claims.ExpiresAt.Time)); err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// registerMFAFailure считает неверные коды по challenge и гасит его после MFAMaxAttempts:
+// дальше нужно снова войти по паролю
+func (s *service) registerMFAFailure(claims *token.Claims) {
+	if s.cfg.MFAMaxAttempts <= 0 {
+		return
+	}
+
+	ctx := context.Background()
+	ttl := time.Until(claims.ExpiresAt.Time)
+	failures, err := s.attempts.RegisterFailure(ctx, mfaChallengeKey(claims.ID), ttl)
+	if err != nil {
+		log.Printf("⚠️ Failed to record 2FA failure for user %d: %v", claims.UserID, err)
+		return
+	}
+	if failures < s.cfg.MFAMaxAttempts {
+		return
+	}
+
+	if err := s.revocations.RevokeToken(ctx, claims.ID, ttl); err != nil {
+		log.Printf("⚠️ Failed to revoke 2FA challenge of user %d: %v", claims.UserID, err)
+		return
+	}
+	log.Printf("🔒 2FA challenge of user %d revoked after %d invalid codes", claims.UserID, failures)
+}
+
+func mfaChallengeKey(jti string) string {
+	return "mfa_challenge:" + jti
+}
+
+// verifySecondFactor принимает 6-значный TOTP-код или код восстановления
+func (s *service) verifySecondFactor(user *User, code string) error {
+	if code == "" {
+		return ErrInvalidMFACode
+	}
+
+	if len(code) == totpDigits {
+		secret, lastStep, err := s.repo.GetTOTPSecret(user.ID)
+		if err != nil {
+			return err
+		}
+
+		step, ok := validateTOTP(secret, code, time.Now(), lastStep)
+		if !ok {
+			return ErrInvalidMFACode
+		}
+
+		// Защита от повторного использования кода в том же интервале
+		advanced, err := s.repo.AdvanceTOTPStep(user.ID, step)
+		if err != nil {
+			return err
+		}
+		if !advanced {
+			return ErrInvalidMFACode
+		}
+		return nil
+	}
+
+	codes, err := s.repo.GetUnusedRecoveryCodes(user.ID)
+	if err != nil {
+		return err
+	}
+
+	normalized := normalizeRecoveryCode(code)
+	for _, rc := range codes {
+		if bcrypt.CompareHashAndPassword([]byte(rc.CodeHash), []byte(normalized)) != nil {
+			continue
+		}
+		used, err := s.repo.UseRecoveryCode(rc.ID)
+		if err != nil {
+			return err
+		}
+		if !used {
+			return ErrInvalidMFACode
+		}
+		return nil
+	}
+
+	return ErrInvalidMFACode
+}
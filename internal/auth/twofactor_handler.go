@@ -0,0 +1,200 @@
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+
+	"auth-user-service/internal/audit"
+)
+
+type TOTPCodeRequest struct {
+	Code string `json:"code"`
+}
+
+type DisableTOTPRequest struct {
+	Password string `json:"password"`
+	Code     string `json:"code"`
+}
+
+type VerifyMFARequest struct {
+	MFAToken string `json:"mfa_token"`
+	// Code - 6-значный код из приложения или код восстановления
+	Code string `json:"code"`
+}
+
+// SetupTOTP - начало подключения 2FA: выдаёт секрет и otpauth:// ссылку для QR-кода
+func (h *Handler) SetupTOTP(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int)
+	if !ok {
+		http.Error(w, `{"error": "User not authenticated"}`, http.StatusUnauthorized)
+		return
+	}
+
+	setup, err := h.service.SetupTOTP(userID)
+	if errors.Is(err, ErrTOTPAlreadyEnabled) {
+		http.Error(w, `{"error": "Two-factor authentication already enabled"}`, http.StatusConflict)
+		return
+	}
+	if err != nil {
+		log.Printf("❌ 2FA setup failed for user %d: %v", userID, err)
+		http.Error(w, `{"error": "Failed to setup two-factor authentication"}`, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(setup)
+	if err != nil {
+		return
+	}
+}
+
+// ConfirmTOTP - подтверждение 2FA первым кодом, возвращает коды восстановления
+func (h *Handler) ConfirmTOTP(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int)
+	if !ok {
+		http.Error(w, `{"error": "User not authenticated"}`, http.StatusUnauthorized)
+		return
+	}
+
+	var req TOTPCodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, `{"error": "Invalid request"}`, http.StatusBadRequest)
+		return
+	}
+
+	codes, err := h.service.ConfirmTOTP(userID, req.Code)
+	switch {
+	case errors.Is(err, ErrTOTPAlreadyEnabled):
+		http.Error(w, `{"error": "Two-factor authentication already enabled"}`, http.StatusConflict)
+		return
+	case errors.Is(err, ErrTOTPSetupMissing):
+		http.Error(w, `{"error": "Call /auth/2fa/setup first"}`, http.StatusBadRequest)
+		return
+	case errors.Is(err, ErrInvalidMFACode):
+		http.Error(w, `{"error": "Invalid code"}`, http.StatusBadRequest)
+		return
+	case err != nil:
+		log.Printf("❌ 2FA confirmation failed for user %d: %v", userID, err)
+		http.Error(w, `{"error": "Failed to enable two-factor authentication"}`, http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("🔐 2FA enabled for user %d", userID)
+	h.record(r, audit.TwoFactorEnabled, userID, nil)
+
+	response := map[string]interface{}{
+		"message":        "Two-factor authentication enabled",
+		"recovery_codes": codes,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		return
+	}
+}
+
+// DisableTOTP - отключение 2FA
+func (h *Handler) DisableTOTP(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int)
+	if !ok {
+		http.Error(w, `{"error": "User not authenticated"}`, http.StatusUnauthorized)
+		return
+	}
+
+	var req DisableTOTPRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, `{"error": "Invalid request"}`, http.StatusBadRequest)
+		return
+	}
+
+	err := h.service.DisableTOTP(userID, req.Password, req.Code)
+	var locked *LockedError
+	switch {
+	case errors.As(err, &locked):
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(locked.RetryAfter.Seconds()))))
+		http.Error(w, `{"error": "Too many failed attempts, try again later"}`, http.StatusTooManyRequests)
+		return
+	case errors.Is(err, ErrTOTPNotEnabled):
+		http.Error(w, `{"error": "Two-factor authentication not enabled"}`, http.StatusBadRequest)
+		return
+	case errors.Is(err, ErrInvalidCredentials):
+		http.Error(w, `{"error": "Invalid password"}`, http.StatusUnauthorized)
+		return
+	case errors.Is(err, ErrInvalidMFACode):
+		http.Error(w, `{"error": "Invalid code"}`, http.StatusUnauthorized)
+		return
+	case err != nil:
+		log.Printf("❌ 2FA disable failed for user %d: %v", userID, err)
+		http.Error(w, `{"error": "Failed to disable two-factor authentication"}`, http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("🔐 2FA disabled for user %d", userID)
+	h.record(r, audit.TwoFactorDisabled, userID, nil)
+
+	response := map[string]string{
+		"message": "Two-factor authentication disabled",
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		return
+	}
+}
+
+// VerifyMFA - второй шаг входа: обмен mfa_token и кода на обычную пару токенов
+func (h *Handler) VerifyMFA(w http.ResponseWriter, r *http.Request) {
+	var req VerifyMFARequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, `{"error": "Invalid request"}`, http.StatusBadRequest)
+		return
+	}
+
+	if req.MFAToken == "" || req.Code == "" {
+		http.Error(w, `{"error": "MFA token and code are required"}`, http.StatusBadRequest)
+		return
+	}
+
+	user, err := h.service.VerifyMFAChallenge(req.MFAToken, req.Code, clientInfo(r))
+	var locked *LockedError
+	switch {
+	case errors.As(err, &locked):
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(locked.RetryAfter.Seconds()))))
+		http.Error(w, `{"error": "Too many failed attempts, try again later"}`, http.StatusTooManyRequests)
+		return
+	case errors.Is(err, ErrMFATokenInvalid), errors.Is(err, ErrTOTPNotEnabled):
+		http.Error(w, `{"error": "Invalid or expired MFA token"}`, http.StatusUnauthorized)
+		return
+	case errors.Is(err, ErrInvalidMFACode):
+		http.Error(w, `{"error": "Invalid code"}`, http.StatusUnauthorized)
+		return
+	case err != nil:
+		log.Printf("❌ MFA verification failed: %v", err)
+		http.Error(w, `{"error": "Failed to verify code"}`, http.StatusInternalServerError)
+		return
+	}
+
+	tokens, err := h.service.IssueTokens(user, clientInfo(r))
+	if err != nil {
+		http.Error(w, `{"error": "Failed to generate token"}`, http.StatusInternalServerError)
+		return
+	}
+
+	h.record(r, audit.LoginSucceeded, user.ID, audit.Metadata{"method": "totp"})
+	h.writeTokenResponse(w, r, user, tokens)
+}
+
+// writeMFAChallenge - ответ на логин пользователя с включённой 2FA
+func writeMFAChallenge(w http.ResponseWriter, challenge *MFAChallenge) {
+	w.Header().Set("Content-Type", "application/json")
+	err := json.NewEncoder(w).Encode(challenge)
+	if err != nil {
+		return
+	}
+}
@@ -0,0 +1,173 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log"
+	"strings"
+
+	"auth-user-service/internal/notify"
+	"auth-user-service/internal/webauthn"
+)
+
+var (
+	ErrPasskeyInvalid        = errors.New("invalid passkey")
+	ErrPasswordLoginDisabled = errors.New("password login disabled, use a passkey")
+	ErrNoPasskeys            = errors.New("no passkeys registered")
+)
+
+// PasskeyLogin - результат входа по passkey
+type PasskeyLogin struct {
+	User *User
+	// UserVerified - ключ проверил PIN или биометрию. Без этого passkey - только "что-то,
+	// что есть у пользователя", и включённый TOTP по-прежнему нужен
+	UserVerified bool
+}
+
+// BeginPasskeyRegistration начинает регистрацию ключа для вошедшего пользователя
+func (s *service) BeginPasskeyRegistration(userID int) (string, *webauthn.CreationOptions, error) {
+	user, err := s.repo.GetUserByID(userID)
+	if err != nil {
+		return "", nil, err
+	}
+	passkeys, err := s.repo.ListWebAuthnCredentials(userID)
+	if err != nil {
+		return "", nil, err
+	}
+
+	displayName := strings.TrimSpace(user.FirstName + " " + user.LastName)
+	if displayName == "" {
+		displayName = user.Email
+	}
+
+	return s.passkeys.BeginRegistration(context.Background(), webauthn.User{
+		ID:          user.ID,
+		Name:        user.Email,
+		DisplayName: displayName,
+	}, passkeyCredentials(passkeys))
+}
+
+// FinishPasskeyRegistration проверяет ответ браузера и сохраняет ключ.
+// Церемония должна быть начата тем же пользователем
+func (s *service) FinishPasskeyRegistration(userID int, sessionID, name string, resp *webauthn.RegistrationResponse) error {
+	ownerID, credential, err := s.passkeys.FinishRegistration(context.Background(), sessionID, resp)
+	if err != nil {
+		return err
+	}
+	if ownerID != userID {
+		return webauthn.ErrInvalidSession
+	}
+
+	if err := s.repo.SaveWebAuthnCredential(userID, strings.TrimSpace(name), credential); err != nil {
+		return err
+	}
+
+	user, err := s.repo.GetUserByID(userID)
+	if err != nil {
+		return err
+	}
+	s.sendNotification(notify.Message{
+		To:      user.Email,
+		Subject: "Добавлен ключ входа",
+		Body:    "К вашему аккаунту добавлен новый ключ входа (passkey). Если это были не вы, удалите его в настройках и смените пароль.",
+	})
+
+	return nil
+}
+
+// BeginPasskeyLogin начинает вход. С email браузер получит список ключей пользователя,
+// без него - предложит любой passkey этого сайта. Неизвестный email не отличается
+// от входа без email, чтобы ответ не выдавал наличие аккаунта
+func (s *service) BeginPasskeyLogin(email string) (string, *webauthn.RequestOptions, error) {
+	var userID int
+	var allowed []webauthn.Credential
+
+	if email = strings.TrimSpace(email); email != "" {
+		user, err := s.repo.GetUserByEmail(email)
+		switch {
+		case errors.Is(err, ErrUserNotFound):
+		case err != nil:
+			return "", nil, err
+		default:
+			passkeys, err := s.repo.ListWebAuthnCredentials(user.ID)
+			if err != nil {
+				return "", nil, err
+			}
+			userID = user.ID
+			allowed = passkeyCredentials(passkeys)
+		}
+	}
+
+	return s.passkeys.BeginLogin(context.Background(), userID, allowed)
+}
+
+// FinishPasskeyLogin проверяет подпись ключа и возвращает его владельца
+func (s *service) FinishPasskeyLogin(sessionID string, resp *webauthn.LoginResponse) (*PasskeyLogin, error) {
+	passkey, err := s.repo.GetWebAuthnCredential(resp.RawID)
+	if errors.Is(err, ErrPasskeyNotFound) {
+		return nil, ErrPasskeyInvalid
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	assertion, err := s.passkeys.FinishLogin(context.Background(), sessionID, resp, &passkey.Credential)
+	if errors.Is(err, webauthn.ErrCloneDetected) {
+		log.Printf("🚫 Passkey %d of user %d: sign counter did not increase, possible cloned authenticator", passkey.ID, passkey.UserID)
+		return nil, ErrPasskeyInvalid
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Вход начинали для конкретного пользователя, а ключ чужой
+	if assertion.UserID != 0 && assertion.UserID != passkey.UserID {
+		return nil, ErrPasskeyInvalid
+	}
+	if len(resp.Response.UserHandle) != 0 && !bytes.Equal(resp.Response.UserHandle, webauthn.UserHandle(passkey.UserID)) {
+		return nil, ErrPasskeyInvalid
+	}
+
+	if err := s.repo.UpdateWebAuthnCredential(passkey.ID, assertion.SignCount, assertion.BackedUp); err != nil {
+		return nil, err
+	}
+
+	user, err := s.repo.GetUserByID(passkey.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if user.DisabledAt != nil {
+		return nil, ErrAccountDisabled
+	}
+	if user.PasswordResetRequired {
+		return nil, ErrPasswordResetRequired
+	}
+
+	s.resetLoginFailures(user.Email)
+
+	return &PasskeyLogin{User: user, UserVerified: assertion.UserVerified}, nil
+}
+
+func (s *service) ListPasskeys(userID int) ([]Passkey, error) {
+	return s.repo.ListWebAuthnCredentials(userID)
+}
+
+func (s *service) DeletePasskey(userID, passkeyID int) error {
+	return s.repo.DeleteWebAuthnCredential(userID, passkeyID)
+}
+
+// SetPasskeyOnly включает или выключает вход только по passkey. Включить можно,
+// лишь когда есть хотя бы один ключ. Вход по ссылке из письма и восстановление пароля
+// остаются - через них пользователь вернёт доступ, потеряв ключи
+func (s *service) SetPasskeyOnly(userID int, enabled bool) error {
+	return s.repo.SetPasskeyOnly(userID, enabled)
+}
+
+func passkeyCredentials(passkeys []Passkey) []webauthn.Credential {
+	credentials := make([]webauthn.Credential, 0, len(passkeys))
+	for _, p := range passkeys {
+		credentials = append(credentials, p.Credential)
+	}
+	return credentials
+}
@@ -0,0 +1,285 @@
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+
+	"auth-user-service/internal/audit"
+	"auth-user-service/internal/webauthn"
+
+	"github.com/go-chi/chi/v5"
+)
+
+type PasskeyRegistrationRequest struct {
+	SessionID string `json:"session_id"`
+	// Name - подпись ключа в списке, например "MacBook"
+	Name       string                         `json:"name"`
+	Credential *webauthn.RegistrationResponse `json:"credential"`
+}
+
+type PasskeyLoginBeginRequest struct {
+	// Email необязателен: без него браузер предложит любой passkey сайта
+	Email string `json:"email"`
+}
+
+type PasskeyLoginRequest struct {
+	SessionID  string                  `json:"session_id"`
+	Credential *webauthn.LoginResponse `json:"credential"`
+}
+
+type PasskeyOnlyRequest struct {
+	Enabled bool `json:"enabled"`
+}
+
+// PasskeyOptions - ответ на начало церемонии. PublicKey передаётся в navigator.credentials
+// (через PublicKeyCredential.parseCreationOptionsFromJSON / parseRequestOptionsFromJSON)
+type PasskeyOptions struct {
+	SessionID string      `json:"session_id"`
+	PublicKey interface{} `json:"public_key"`
+}
+
+// BeginPasskeyRegistration - параметры создания ключа для вошедшего пользователя
+func (h *Handler) BeginPasskeyRegistration(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int)
+	if !ok {
+		http.Error(w, `{"error": "User not authenticated"}`, http.StatusUnauthorized)
+		return
+	}
+
+	sessionID, options, err := h.service.BeginPasskeyRegistration(userID)
+	if err != nil {
+		log.Printf("❌ Passkey registration start failed for user %d: %v", userID, err)
+		http.Error(w, `{"error": "Failed to start passkey registration"}`, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(PasskeyOptions{SessionID: sessionID, PublicKey: options})
+	if err != nil {
+		return
+	}
+}
+
+// FinishPasskeyRegistration - проверка ответа navigator.credentials.create и сохранение ключа
+func (h *Handler) FinishPasskeyRegistration(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int)
+	if !ok {
+		http.Error(w, `{"error": "User not authenticated"}`, http.StatusUnauthorized)
+		return
+	}
+
+	var req PasskeyRegistrationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Credential == nil {
+		http.Error(w, `{"error": "Invalid request"}`, http.StatusBadRequest)
+		return
+	}
+
+	err := h.service.FinishPasskeyRegistration(userID, req.SessionID, req.Name, req.Credential)
+	switch {
+	case errors.Is(err, webauthn.ErrInvalidSession):
+		http.Error(w, `{"error": "Passkey registration expired, start again"}`, http.StatusBadRequest)
+		return
+	case errors.Is(err, webauthn.ErrUnsupportedAttestation), errors.Is(err, webauthn.ErrUnsupportedKey):
+		http.Error(w, `{"error": "This authenticator is not supported"}`, http.StatusBadRequest)
+		return
+	case errors.Is(err, webauthn.ErrVerificationFailed):
+		log.Printf("⚠️ Passkey registration rejected for user %d: %v", userID, err)
+		http.Error(w, `{"error": "Passkey verification failed"}`, http.StatusBadRequest)
+		return
+	case errors.Is(err, ErrPasskeyRegistered):
+		http.Error(w, `{"error": "Passkey already registered"}`, http.StatusConflict)
+		return
+	case err != nil:
+		log.Printf("❌ Passkey registration failed for user %d: %v", userID, err)
+		http.Error(w, `{"error": "Failed to register passkey"}`, http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("🔐 User %d registered a passkey", userID)
+	h.record(r, audit.PasskeyAdded, userID, audit.Metadata{"name": req.Name})
+
+	response := map[string]string{
+		"message": "Passkey registered",
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		return
+	}
+}
+
+// BeginPasskeyLogin - параметры входа по passkey
+func (h *Handler) BeginPasskeyLogin(w http.ResponseWriter, r *http.Request) {
+	var req PasskeyLoginBeginRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		http.Error(w, `{"error": "Invalid request"}`, http.StatusBadRequest)
+		return
+	}
+
+	sessionID, options, err := h.service.BeginPasskeyLogin(req.Email)
+	if err != nil {
+		log.Printf("❌ Passkey login start failed: %v", err)
+		http.Error(w, `{"error": "Failed to start passkey login"}`, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(PasskeyOptions{SessionID: sessionID, PublicKey: options})
+	if err != nil {
+		return
+	}
+}
+
+// FinishPasskeyLogin - вход по ответу navigator.credentials.get. Ответ тот же, что у Login
+func (h *Handler) FinishPasskeyLogin(w http.ResponseWriter, r *http.Request) {
+	var req PasskeyLoginRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Credential == nil {
+		http.Error(w, `{"error": "Invalid request"}`, http.StatusBadRequest)
+		return
+	}
+
+	login, err := h.service.FinishPasskeyLogin(req.SessionID, req.Credential)
+	switch {
+	case errors.Is(err, ErrPasskeyInvalid), errors.Is(err, webauthn.ErrInvalidSession),
+		errors.Is(err, webauthn.ErrVerificationFailed), errors.Is(err, webauthn.ErrUnsupportedKey):
+		http.Error(w, `{"error": "Invalid passkey"}`, http.StatusUnauthorized)
+		return
+	case errors.Is(err, ErrAccountDisabled):
+		http.Error(w, `{"error": "Account disabled"}`, http.StatusForbidden)
+		return
+	case errors.Is(err, ErrPasswordResetRequired):
+		http.Error(w, `{"error": "Password reset required, check your email"}`, http.StatusForbidden)
+		return
+	case err != nil:
+		log.Printf("❌ Passkey login failed: %v", err)
+		http.Error(w, `{"error": "Failed to login"}`, http.StatusInternalServerError)
+		return
+	}
+	user := login.User
+
+	// Ключ с проверкой PIN или биометрии сам по себе два фактора, ключ по одному касанию - нет
+	if user.TOTPEnabledAt != nil && !login.UserVerified {
+		challenge, err := h.service.CreateMFAChallenge(user)
+		if err != nil {
+			http.Error(w, `{"error": "Failed to generate token"}`, http.StatusInternalServerError)
+			return
+		}
+		writeMFAChallenge(w, challenge)
+		return
+	}
+
+	tokens, err := h.service.IssueTokens(user, clientInfo(r))
+	if err != nil {
+		http.Error(w, `{"error": "Failed to generate token"}`, http.StatusInternalServerError)
+		return
+	}
+
+	h.record(r, audit.LoginSucceeded, user.ID, audit.Metadata{"method": "passkey"})
+	h.writeTokenResponse(w, r, user, tokens)
+}
+
+// ListPasskeys - ключи пользователя
+func (h *Handler) ListPasskeys(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int)
+	if !ok {
+		http.Error(w, `{"error": "User not authenticated"}`, http.StatusUnauthorized)
+		return
+	}
+
+	passkeys, err := h.service.ListPasskeys(userID)
+	if err != nil {
+		log.Printf("❌ Failed to list passkeys for user %d: %v", userID, err)
+		http.Error(w, `{"error": "Failed to get passkeys"}`, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(passkeys)
+	if err != nil {
+		return
+	}
+}
+
+// DeletePasskey - удаление ключа. С последним ключом снова разрешается вход по паролю
+func (h *Handler) DeletePasskey(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int)
+	if !ok {
+		http.Error(w, `{"error": "User not authenticated"}`, http.StatusUnauthorized)
+		return
+	}
+
+	passkeyID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, `{"error": "Invalid passkey ID"}`, http.StatusBadRequest)
+		return
+	}
+
+	err = h.service.DeletePasskey(userID, passkeyID)
+	if errors.Is(err, ErrPasskeyNotFound) {
+		http.Error(w, `{"error": "Passkey not found"}`, http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("❌ Failed to delete passkey %d of user %d: %v", passkeyID, userID, err)
+		http.Error(w, `{"error": "Failed to delete passkey"}`, http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("🔐 User %d deleted passkey %d", userID, passkeyID)
+	h.record(r, audit.PasskeyRemoved, userID, audit.Metadata{"passkey_id": passkeyID})
+
+	response := map[string]string{
+		"message": "Passkey deleted",
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		return
+	}
+}
+
+// SetPasskeyOnly - включение и выключение входа только по passkey
+func (h *Handler) SetPasskeyOnly(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int)
+	if !ok {
+		http.Error(w, `{"error": "User not authenticated"}`, http.StatusUnauthorized)
+		return
+	}
+
+	var req PasskeyOnlyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, `{"error": "Invalid request"}`, http.StatusBadRequest)
+		return
+	}
+
+	err := h.service.SetPasskeyOnly(userID, req.Enabled)
+	if errors.Is(err, ErrNoPasskeys) {
+		http.Error(w, `{"error": "Register a passkey first"}`, http.StatusConflict)
+		return
+	}
+	if err != nil {
+		log.Printf("❌ Failed to update passkey-only login for user %d: %v", userID, err)
+		http.Error(w, `{"error": "Failed to update login settings"}`, http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("🔐 User %d set passkey-only login to %t", userID, req.Enabled)
+	h.record(r, audit.PasskeyOnlyChanged, userID, audit.Metadata{"enabled": req.Enabled})
+
+	response := map[string]bool{
+		"passkey_only": req.Enabled,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		return
+	}
+}
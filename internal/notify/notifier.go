@@ -0,0 +1,30 @@
+package notify
+
+import (
+	"context"
+	"log"
+)
+
+// Message - письмо или другое уведомление пользователю
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Notifier доставляет уведомления пользователям (email, мессенджеры и т.п.)
+type Notifier interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// LogNotifier пишет уведомления в лог. Используется, пока не подключен реальный провайдер
+type LogNotifier struct{}
+
+func NewLogNotifier() *LogNotifier {
+	return &LogNotifier{}
+}
+
+func (n *LogNotifier) Send(_ context.Context, msg Message) error {
+	log.Printf("✉️ Notification to %s: %s\n%s", msg.To, msg.Subject, msg.Body)
+	return nil
+}
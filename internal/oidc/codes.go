@@ -0,0 +1,99 @@
+package oidc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"auth-user-service/internal/redis"
+)
+
+// Grant - то, на что выдан код авторизации
+type Grant struct {
+	ClientID      string `json:"client_id"`
+	RedirectURI   string `json:"redirect_uri"`
+	UserID        int    `json:"user_id"`
+	Scope         string `json:"scope"`
+	Nonce         string `json:"nonce,omitempty"`
+	CodeChallenge string `json:"code_challenge"`
+	// AuthTime - когда пользователь ввёл пароль (claim auth_time)
+	AuthTime int64 `json:"auth_time"`
+}
+
+// CodeStore хранит коды авторизации. Take одноразовый: код нельзя обменять дважды
+type CodeStore interface {
+	Save(ctx context.Context, codeHash string, grant *Grant, ttl time.Duration) error
+	Take(ctx context.Context, codeHash string) (*Grant, error)
+}
+
+// NewCodeStore возвращает хранилище в Redis, а без Redis - в памяти процесса
+func NewCodeStore(redisClient *redis.Client) CodeStore {
+	if redisClient == nil {
+		log.Println("⚠️ Redis unavailable: OIDC authorization codes are kept in memory of this instance only")
+		return &memoryCodeStore{grants: make(map[string]memoryGrant)}
+	}
+	return &redisCodeStore{redis: redisClient}
+}
+
+type redisCodeStore struct {
+	redis *redis.Client
+}
+
+func codeKey(codeHash string) string {
+	return fmt.Sprintf("oidc_code:%s", codeHash)
+}
+
+func (s *redisCodeStore) Save(ctx context.Context, codeHash string, grant *Grant, ttl time.Duration) error {
+	return s.redis.Set(ctx, codeKey(codeHash), grant, ttl)
+}
+
+func (s *redisCodeStore) Take(ctx context.Context, codeHash string) (*Grant, error) {
+	var grant Grant
+	err := s.redis.Take(ctx, codeKey(codeHash), &grant)
+	if errors.Is(err, redis.ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &grant, nil
+}
+
+type memoryCodeStore struct {
+	mu     sync.Mutex
+	grants map[string]memoryGrant
+}
+
+type memoryGrant struct {
+	grant     Grant
+	expiresAt time.Time
+}
+
+func (s *memoryCodeStore) Save(_ context.Context, codeHash string, grant *Grant, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for key, g := range s.grants {
+		if now.After(g.expiresAt) {
+			delete(s.grants, key)
+		}
+	}
+	s.grants[codeHash] = memoryGrant{grant: *grant, expiresAt: now.Add(ttl)}
+	return nil
+}
+
+func (s *memoryCodeStore) Take(_ context.Context, codeHash string) (*Grant, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	g, ok := s.grants[codeHash]
+	delete(s.grants, codeHash)
+	if !ok || time.Now().After(g.expiresAt) {
+		return nil, nil
+	}
+	return &g.grant, nil
+}
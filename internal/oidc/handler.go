@@ -0,0 +1,552 @@
+package oidc
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"auth-user-service/internal/audit"
+	"auth-user-service/internal/auth"
+	"auth-user-service/internal/token"
+	"auth-user-service/internal/user"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+// Handler - эндпоинты OpenID Connect провайдера и управление клиентами
+type Handler struct {
+	service Service
+	auth    auth.Service
+	users   user.Service
+	keys    *token.KeyRing
+	events  audit.Service
+}
+
+func NewHandler(service Service, authService auth.Service, users user.Service, keys *token.KeyRing, events audit.Service) *Handler {
+	return &Handler{service: service, auth: authService, users: users, keys: keys, events: events}
+}
+
+// AuthorizeRequest - параметры запроса /authorize
+type AuthorizeRequest struct {
+	ResponseType        string
+	ClientID            string
+	RedirectURI         string
+	Scope               string
+	State               string
+	Nonce               string
+	CodeChallenge       string
+	CodeChallengeMethod string
+	Prompt              string
+}
+
+type RegisterClientRequest struct {
+	Name         string   `json:"name"`
+	RedirectURIs []string `json:"redirect_uris"`
+	// Public - клиент без секрета (SPA, мобильное приложение)
+	Public bool `json:"public"`
+}
+
+// Discovery отдаёт /.well-known/openid-configuration
+func (h *Handler) Discovery(w http.ResponseWriter, r *http.Request) {
+	issuer := h.service.Config().Issuer
+	response := map[string]interface{}{
+		"issuer":                                issuer,
+		"authorization_endpoint":                issuer + "/authorize",
+		"token_endpoint":                        issuer + "/token",
+		"userinfo_endpoint":                     issuer + "/userinfo",
+		"jwks_uri":                              issuer + "/.well-known/jwks.json",
+		"response_types_supported":              []string{"code"},
+		"grant_types_supported":                 []string{"authorization_code", "refresh_token"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{h.keys.SigningKey().Method.Alg()},
+		"scopes_supported":                      SupportedScopes,
+		"token_endpoint_auth_methods_supported": []string{"client_secret_basic", "client_secret_post", "none"},
+		"code_challenge_methods_supported":      []string{"S256"},
+		"claims_supported": []string{
+			"sub", "iss", "aud", "exp", "iat", "auth_time", "nonce",
+			"email", "email_verified", "name", "given_name", "family_name", "phone_number", "updated_at",
+		},
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	err := json.NewEncoder(w).Encode(response)
+	if err != nil {
+		return
+	}
+}
+
+// Authorize - страница входа. GET показывает форму, POST проверяет пароль
+// (и второй фактор, если он включён) и возвращает пользователя в приложение с кодом.
+// Приложения свои, поэтому отдельного экрана согласия нет
+func (h *Handler) Authorize(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+
+	req := &AuthorizeRequest{
+		ResponseType:        r.Form.Get("response_type"),
+		ClientID:            r.Form.Get("client_id"),
+		RedirectURI:         r.Form.Get("redirect_uri"),
+		Scope:               r.Form.Get("scope"),
+		State:               r.Form.Get("state"),
+		Nonce:               r.Form.Get("nonce"),
+		CodeChallenge:       r.Form.Get("code_challenge"),
+		CodeChallengeMethod: r.Form.Get("code_challenge_method"),
+		Prompt:              r.Form.Get("prompt"),
+	}
+
+	// Пока клиент и redirect_uri не проверены, перенаправлять некуда - только страница с ошибкой
+	client, err := h.service.GetClient(req.ClientID)
+	if errors.Is(err, ErrClientNotFound) {
+		http.Error(w, "Unknown client_id", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		log.Printf("❌ Failed to load OAuth client %s: %v", req.ClientID, err)
+		http.Error(w, "Internal error", http.StatusInternalServerError)
+		return
+	}
+	if !client.AllowsRedirect(req.RedirectURI) {
+		http.Error(w, "redirect_uri is not registered for this client", http.StatusBadRequest)
+		return
+	}
+
+	switch {
+	case req.ResponseType != "code":
+		redirectError(w, r, req, "unsupported_response_type", "only response_type=code is supported")
+		return
+	case !HasScope(req.Scope, "openid"):
+		redirectError(w, r, req, "invalid_scope", "openid scope is required")
+		return
+	case req.CodeChallenge == "" || req.CodeChallengeMethod != "S256":
+		redirectError(w, r, req, "invalid_request", "PKCE with code_challenge_method=S256 is required")
+		return
+	case req.Prompt == "none":
+		// Сессии в браузере у провайдера нет, поэтому войти без страницы входа нельзя
+		redirectError(w, r, req, "login_required", "")
+		return
+	}
+	req.Scope = NormalizeScope(req.Scope)
+
+	page := loginPage{ClientName: client.Name, Request: req}
+	if r.Method != http.MethodPost {
+		renderLogin(w, http.StatusOK, page)
+		return
+	}
+
+	var u *auth.User
+	if mfaToken := r.PostForm.Get("mfa_token"); mfaToken != "" {
+		u, err = h.auth.VerifyMFAChallenge(mfaToken, r.PostForm.Get("code"), clientInfo(r))
+		var locked *auth.LockedError
+		switch {
+		case errors.As(err, &locked):
+			page.Error = loginErrorMessage(err)
+			renderLogin(w, http.StatusTooManyRequests, page)
+			return
+		case errors.Is(err, auth.ErrInvalidMFACode):
+			page.MFAToken = mfaToken
+			page.Error = "Неверный код"
+			renderLogin(w, http.StatusUnauthorized, page)
+			return
+		case err != nil:
+			page.Error = "Время на ввод кода истекло, войдите заново"
+			renderLogin(w, http.StatusUnauthorized, page)
+			return
+		}
+	} else {
+		page.Email = r.PostForm.Get("email")
+		u, err = h.auth.Login(page.Email, r.PostForm.Get("password"), clientInfo(r))
+		if err != nil {
+			page.Error = loginErrorMessage(err)
+			renderLogin(w, http.StatusUnauthorized, page)
+			return
+		}
+
+		if u.TOTPEnabledAt != nil {
+			challenge, err := h.auth.CreateMFAChallenge(u)
+			if err != nil {
+				log.Printf("❌ Failed to create MFA challenge for user %d: %v", u.ID, err)
+				http.Error(w, "Internal error", http.StatusInternalServerError)
+				return
+			}
+			page.MFAToken = challenge.MFAToken
+			renderLogin(w, http.StatusOK, page)
+			return
+		}
+	}
+
+	code, err := h.service.CreateCode(&Grant{
+		ClientID:      client.ID,
+		RedirectURI:   req.RedirectURI,
+		UserID:        u.ID,
+		Scope:         req.Scope,
+		Nonce:         req.Nonce,
+		CodeChallenge: req.CodeChallenge,
+		AuthTime:      time.Now().Unix(),
+	})
+	if err != nil {
+		log.Printf("❌ Failed to create authorization code: %v", err)
+		redirectError(w, r, req, "server_error", "")
+		return
+	}
+
+	log.Printf("🔐 User %d signed in to OAuth client %s", u.ID, client.ID)
+	h.events.Record(audit.NewEvent(r, audit.LoginSucceeded, u.ID, audit.Metadata{"method": "oauth", "client_id": client.ID}))
+	redirectWith(w, r, req.RedirectURI, url.Values{"code": {code}, "state": {req.State}})
+}
+
+// Token - обмен кода авторизации или refresh-токена на токены (RFC 6749)
+func (h *Handler) Token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_request", "malformed form body")
+		return
+	}
+
+	clientID, secret, ok := r.BasicAuth()
+	if ok {
+		// client_secret_basic: значения закодированы как application/x-www-form-urlencoded
+		clientID, _ = url.QueryUnescape(clientID)
+		secret, _ = url.QueryUnescape(secret)
+	} else {
+		clientID, secret = r.PostForm.Get("client_id"), r.PostForm.Get("client_secret")
+	}
+
+	client, err := h.service.AuthenticateClient(clientID, secret)
+	if errors.Is(err, ErrInvalidClient) {
+		w.Header().Set("WWW-Authenticate", `Basic realm="token"`)
+		writeOAuthError(w, http.StatusUnauthorized, "invalid_client", "")
+		return
+	}
+	if err != nil {
+		log.Printf("❌ OAuth client authentication failed: %v", err)
+		writeOAuthError(w, http.StatusInternalServerError, "server_error", "")
+		return
+	}
+
+	device := clientInfo(r)
+	device.ClientID = client.ID
+
+	var (
+		u        *auth.User
+		tokens   *auth.TokenPair
+		nonce    string
+		authTime int64
+	)
+	switch r.PostForm.Get("grant_type") {
+	case "authorization_code":
+		grant, err := h.service.ExchangeCode(client, r.PostForm.Get("code"), r.PostForm.Get("redirect_uri"), r.PostForm.Get("code_verifier"))
+		if errors.Is(err, ErrInvalidGrant) {
+			writeOAuthError(w, http.StatusBadRequest, "invalid_grant", "")
+			return
+		}
+		if err != nil {
+			log.Printf("❌ Authorization code exchange failed: %v", err)
+			writeOAuthError(w, http.StatusInternalServerError, "server_error", "")
+			return
+		}
+
+		u, err = h.auth.GetUserByID(grant.UserID)
+		if err != nil || u.DisabledAt != nil {
+			writeOAuthError(w, http.StatusBadRequest, "invalid_grant", "")
+			return
+		}
+
+		device.Scope = grant.Scope
+		tokens, err = h.auth.IssueTokens(u, device)
+		if err != nil {
+			log.Printf("❌ Failed to issue tokens for OAuth client %s: %v", client.ID, err)
+			writeOAuthError(w, http.StatusInternalServerError, "server_error", "")
+			return
+		}
+		nonce, authTime = grant.Nonce, grant.AuthTime
+
+	case "refresh_token":
+		u, tokens, err = h.auth.RefreshTokens(r.PostForm.Get("refresh_token"), device)
+		if errors.Is(err, auth.ErrRefreshTokenInvalid) || errors.Is(err, auth.ErrRefreshTokenReused) {
+			writeOAuthError(w, http.StatusBadRequest, "invalid_grant", "")
+			return
+		}
+		if err != nil {
+			log.Printf("❌ Token refresh for OAuth client %s failed: %v", client.ID, err)
+			writeOAuthError(w, http.StatusInternalServerError, "server_error", "")
+			return
+		}
+
+	default:
+		writeOAuthError(w, http.StatusBadRequest, "unsupported_grant_type", "")
+		return
+	}
+
+	response := map[string]interface{}{
+		"access_token":  tokens.AccessToken,
+		"refresh_token": tokens.RefreshToken,
+		"token_type":    tokens.TokenType,
+		"expires_in":    tokens.ExpiresIn,
+		"scope":         tokens.Scope,
+	}
+
+	if HasScope(tokens.Scope, "openid") {
+		profile, err := h.users.GetProfile(u.ID)
+		if err != nil {
+			log.Printf("⚠️ Failed to load profile of user %d for ID token: %v", u.ID, err)
+		}
+		idToken, err := h.service.IDToken(u, profile, client.ID, tokens.Scope, nonce, authTime)
+		if err != nil {
+			log.Printf("❌ Failed to sign ID token: %v", err)
+			writeOAuthError(w, http.StatusInternalServerError, "server_error", "")
+			return
+		}
+		response["id_token"] = idToken
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Pragma", "no-cache")
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		return
+	}
+}
+
+// UserInfo - claims о пользователе по access-токену (в объёме выданных scope)
+func (h *Handler) UserInfo(w http.ResponseWriter, r *http.Request) {
+	tokenString := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if tokenString == "" || tokenString == r.Header.Get("Authorization") {
+		w.Header().Set("WWW-Authenticate", `Bearer`)
+		http.Error(w, `{"error": "invalid_token"}`, http.StatusUnauthorized)
+		return
+	}
+
+	// userinfo принимает токены приложений и токены собственного фронтенда
+	claims, err := h.auth.AuthenticateClientAccess(tokenString)
+	if errors.Is(err, token.ErrWrongTokenType) {
+		claims, err = h.auth.Authenticate(tokenString)
+	}
+	if err != nil {
+		w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+		http.Error(w, `{"error": "invalid_token"}`, http.StatusUnauthorized)
+		return
+	}
+
+	u, err := h.auth.GetUserByID(claims.UserID)
+	if err != nil {
+		w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+		http.Error(w, `{"error": "invalid_token"}`, http.StatusUnauthorized)
+		return
+	}
+	profile, err := h.users.GetProfile(u.ID)
+	if err != nil {
+		log.Printf("⚠️ Failed to load profile of user %d for userinfo: %v", u.ID, err)
+	}
+
+	// Токены собственного фронтенда выданы без scope - им доступны все claims
+	scope := claims.Scope
+	if claims.ClientID == "" {
+		scope = strings.Join(SupportedScopes, " ")
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	err = json.NewEncoder(w).Encode(UserClaims(u, profile, scope))
+	if err != nil {
+		return
+	}
+}
+
+// RegisterClient - регистрация приложения. Секрет возвращается только в этом ответе
+func (h *Handler) RegisterClient(w http.ResponseWriter, r *http.Request) {
+	var req RegisterClientRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, `{"error": "Invalid request"}`, http.StatusBadRequest)
+		return
+	}
+
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" || len(req.RedirectURIs) == 0 {
+		http.Error(w, `{"error": "Name and redirect_uris are required"}`, http.StatusBadRequest)
+		return
+	}
+	for _, uri := range req.RedirectURIs {
+		if !validRedirectURI(uri) {
+			http.Error(w, `{"error": "redirect_uris must be absolute https URLs (http is allowed for localhost) without fragment"}`, http.StatusBadRequest)
+			return
+		}
+	}
+
+	client, secret, err := h.service.RegisterClient(req.Name, req.RedirectURIs, req.Public)
+	if err != nil {
+		log.Printf("❌ Failed to register OAuth client: %v", err)
+		http.Error(w, `{"error": "Failed to register client"}`, http.StatusInternalServerError)
+		return
+	}
+
+	if adminID, ok := r.Context().Value("userID").(int); ok {
+		log.Printf("🛡️ Admin %d registered OAuth client %s (%s)", adminID, client.ID, client.Name)
+	}
+	h.events.Record(audit.NewEvent(r, audit.AdminOAuthClientCreated, 0, audit.Metadata{"client_id": client.ID, "name": client.Name}))
+
+	response := map[string]interface{}{
+		"client_id":     client.ID,
+		"name":          client.Name,
+		"redirect_uris": client.RedirectURIs,
+		"public":        client.Public(),
+		"created_at":    client.CreatedAt,
+	}
+	if secret != "" {
+		response["client_secret"] = secret
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		return
+	}
+}
+
+func (h *Handler) ListClients(w http.ResponseWriter, r *http.Request) {
+	clients, err := h.service.ListClients()
+	if err != nil {
+		log.Printf("❌ Failed to list OAuth clients: %v", err)
+		http.Error(w, `{"error": "Failed to list clients"}`, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(clients)
+	if err != nil {
+		return
+	}
+}
+
+// DeleteClient удаляет приложение и отзывает выданные ему refresh-токены
+func (h *Handler) DeleteClient(w http.ResponseWriter, r *http.Request) {
+	clientID := chi.URLParam(r, "id")
+
+	err := h.service.DeleteClient(clientID)
+	if errors.Is(err, ErrClientNotFound) {
+		http.Error(w, `{"error": "Client not found"}`, http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("❌ Failed to delete OAuth client %s: %v", clientID, err)
+		http.Error(w, `{"error": "Failed to delete client"}`, http.StatusInternalServerError)
+		return
+	}
+
+	if adminID, ok := r.Context().Value("userID").(int); ok {
+		log.Printf("🛡️ Admin %d deleted OAuth client %s", adminID, clientID)
+	}
+	h.events.Record(audit.NewEvent(r, audit.AdminOAuthClientDeleted, 0, audit.Metadata{"client_id": clientID}))
+
+	response := map[string]string{
+		"message": "Client deleted",
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		return
+	}
+}
+
+// loginErrorMessage - текст ошибки входа для страницы. Неизвестный email и неверный
+// пароль не различаются
+func loginErrorMessage(err error) string {
+	var locked *auth.LockedError
+	switch {
+	case errors.As(err, &locked):
+		return "Слишком много неудачных попыток, попробуйте позже"
+	case errors.Is(err, auth.ErrEmailNotVerified):
+		return "Подтвердите email по ссылке из письма"
+	case errors.Is(err, auth.ErrAccountDisabled):
+		return "Аккаунт заблокирован"
+	case errors.Is(err, auth.ErrPasswordResetRequired):
+		return "Нужно задать новый пароль, проверьте почту"
+	}
+	return "Неверный email или пароль"
+}
+
+// redirectError возвращает ошибку в приложение через redirect_uri (RFC 6749, 4.1.2.1)
+func redirectError(w http.ResponseWriter, r *http.Request, req *AuthorizeRequest, code, description string) {
+	params := url.Values{"error": {code}}
+	if description != "" {
+		params.Set("error_description", description)
+	}
+	if req.State != "" {
+		params.Set("state", req.State)
+	}
+	redirectWith(w, r, req.RedirectURI, params)
+}
+
+func redirectWith(w http.ResponseWriter, r *http.Request, redirectURI string, params url.Values) {
+	target, err := url.Parse(redirectURI)
+	if err != nil {
+		http.Error(w, "Invalid redirect_uri", http.StatusBadRequest)
+		return
+	}
+	query := target.Query()
+	for key, values := range params {
+		if values[0] != "" {
+			query.Set(key, values[0])
+		}
+	}
+	target.RawQuery = query.Encode()
+	http.Redirect(w, r, target.String(), http.StatusFound)
+}
+
+// writeOAuthError - ошибка в формате RFC 6749, 5.2
+func writeOAuthError(w http.ResponseWriter, status int, code, description string) {
+	response := map[string]string{
+		"error": code,
+	}
+	if description != "" {
+		response["error_description"] = description
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	err := json.NewEncoder(w).Encode(response)
+	if err != nil {
+		return
+	}
+}
+
+func validRedirectURI(uri string) bool {
+	parsed, err := url.Parse(uri)
+	if err != nil || !parsed.IsAbs() || parsed.Fragment != "" || parsed.Host == "" {
+		return false
+	}
+	if parsed.Scheme == "https" {
+		return true
+	}
+	host := parsed.Hostname()
+	return parsed.Scheme == "http" && (host == "localhost" || host == "127.0.0.1" || host == "::1")
+}
+
+// clientInfo - устройство пользователя для сессии и журнала безопасности
+func clientInfo(r *http.Request) auth.ClientInfo {
+	return auth.ClientInfo{
+		UserAgent: r.UserAgent(),
+		IPAddress: clientIP(r),
+		RequestID: middleware.GetReqID(r.Context()),
+	}
+}
+
+// clientIP - адрес клиента. За прокси RemoteAddr уже подменён middleware.RealIP
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,83 @@
+package oidc
+
+import (
+	"html/template"
+	"log"
+	"net/http"
+)
+
+// loginPage - данные страницы входа /authorize
+type loginPage struct {
+	ClientName string
+	Email      string
+	Error      string
+	// MFAToken - пароль принят, ждём код второго фактора
+	MFAToken string
+	Request  *AuthorizeRequest
+}
+
+var loginTemplate = template.Must(template.New("login").Parse(`<!DOCTYPE html>
+<html lang="ru">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>Вход</title>
+<style>
+body { font-family: -apple-system, "Segoe UI", Roboto, sans-serif; background: #f4f4f5; margin: 0; }
+main { max-width: 360px; margin: 10vh auto; background: #fff; padding: 32px; border-radius: 12px; box-shadow: 0 2px 12px rgba(0,0,0,.08); }
+h1 { font-size: 20px; margin: 0 0 8px; }
+p { color: #52525b; margin: 0 0 24px; }
+label { display: block; font-size: 14px; margin-bottom: 16px; }
+input[type=email], input[type=password], input[type=text] { width: 100%; box-sizing: border-box; padding: 10px; margin-top: 4px; border: 1px solid #d4d4d8; border-radius: 8px; font-size: 16px; }
+button { width: 100%; padding: 12px; border: 0; border-radius: 8px; background: #18181b; color: #fff; font-size: 16px; cursor: pointer; }
+.error { color: #b91c1c; background: #fef2f2; padding: 10px; border-radius: 8px; margin-bottom: 16px; }
+</style>
+</head>
+<body>
+<main>
+<h1>Вход</h1>
+<p>для продолжения в «{{.ClientName}}»</p>
+{{if .Error}}<div class="error">{{.Error}}</div>{{end}}
+<form method="post">
+{{with .Request}}
+<input type="hidden" name="response_type" value="{{.ResponseType}}">
+<input type="hidden" name="client_id" value="{{.ClientID}}">
+<input type="hidden" name="redirect_uri" value="{{.RedirectURI}}">
+<input type="hidden" name="scope" value="{{.Scope}}">
+<input type="hidden" name="state" value="{{.State}}">
+<input type="hidden" name="nonce" value="{{.Nonce}}">
+<input type="hidden" name="code_challenge" value="{{.CodeChallenge}}">
+<input type="hidden" name="code_challenge_method" value="{{.CodeChallengeMethod}}">
+{{end}}
+{{if .MFAToken}}
+<input type="hidden" name="mfa_token" value="{{.MFAToken}}">
+<label>Код из приложения-аутентификатора или код восстановления
+<input type="text" name="code" autocomplete="one-time-code" inputmode="numeric" required autofocus>
+</label>
+{{else}}
+<label>Email
+<input type="email" name="email" value="{{.Email}}" autocomplete="username" required autofocus>
+</label>
+<label>Пароль
+<input type="password" name="password" autocomplete="current-password" required>
+</label>
+{{end}}
+<button type="submit">Войти</button>
+</form>
+</main>
+</body>
+</html>
+`))
+
+// renderLogin отдаёт страницу входа. Встраивать её во фреймы запрещено, чтобы
+// чужой сайт не мог подсунуть её пользователю под видом своей (clickjacking)
+func renderLogin(w http.ResponseWriter, status int, page loginPage) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("X-Frame-Options", "DENY")
+	w.Header().Set("Content-Security-Policy", "default-src 'none'; style-src 'unsafe-inline'; frame-ancestors 'none'")
+	w.WriteHeader(status)
+	if err := loginTemplate.Execute(w, page); err != nil {
+		log.Printf("❌ Failed to render login page: %v", err)
+	}
+}
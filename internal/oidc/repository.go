@@ -0,0 +1,138 @@
+package oidc
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+var ErrClientNotFound = errors.New("oauth client not found")
+
+// Client - приложение, которое входит через этот сервис
+type Client struct {
+	ID   string `json:"client_id"`
+	Name string `json:"name"`
+	// SecretHash - SHA-256 секрета. Пусто у публичных клиентов (SPA, мобильные приложения)
+	SecretHash   string    `json:"-"`
+	RedirectURIs []string  `json:"redirect_uris"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// Public - клиент без секрета, аутентифицируется только через PKCE
+func (c *Client) Public() bool {
+	return c.SecretHash == ""
+}
+
+// AllowsRedirect - redirect_uri сравнивается с зарегистрированными точно, без префиксов
+func (c *Client) AllowsRedirect(redirectURI string) bool {
+	for _, uri := range c.RedirectURIs {
+		if uri == redirectURI {
+			return true
+		}
+	}
+	return false
+}
+
+type Repository interface {
+	CreateClient(client *Client) error
+	GetClient(id string) (*Client, error)
+	ListClients() ([]Client, error)
+	DeleteClient(id string) error
+}
+
+type repository struct {
+	db *sql.DB
+}
+
+func NewRepository(db *sql.DB) Repository {
+	return &repository{db: db}
+}
+
+func (r *repository) CreateClient(client *Client) error {
+	return r.db.QueryRow(
+		`INSERT INTO oauth_clients (id, name, secret_hash, redirect_uris)
+		 VALUES ($1, $2, NULLIF($3, ''), $4)
+		 RETURNING created_at`,
+		client.ID, client.Name, client.SecretHash, pq.Array(client.RedirectURIs),
+	).Scan(&client.CreatedAt)
+}
+
+func (r *repository) GetClient(id string) (*Client, error) {
+	var client Client
+	err := r.db.QueryRow(
+		"SELECT id, name, COALESCE(secret_hash, ''), redirect_uris, created_at FROM oauth_clients WHERE id = $1",
+		id,
+	).Scan(&client.ID, &client.Name, &client.SecretHash, pq.Array(&client.RedirectURIs), &client.CreatedAt)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrClientNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &client, nil
+}
+
+func (r *repository) ListClients() ([]Client, error) {
+	rows, err := r.db.Query(
+		"SELECT id, name, COALESCE(secret_hash, ''), redirect_uris, created_at FROM oauth_clients ORDER BY created_at",
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer func(rows *sql.Rows) {
+		_ = rows.Close()
+	}(rows)
+
+	clients := []Client{}
+	for rows.Next() {
+		var client Client
+		if err := rows.Scan(&client.ID, &client.Name, &client.SecretHash, pq.Array(&client.RedirectURIs), &client.CreatedAt); err != nil {
+			return nil, err
+		}
+		clients = append(clients, client)
+	}
+	return clients, rows.Err()
+}
+
+// DeleteClient удаляет клиента и отзывает все выданные ему refresh-токены.
+// Уже выданные access-токены доживают свой короткий срок
+func (r *repository) DeleteClient(id string) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func(tx *sql.Tx) {
+		_ = tx.Rollback()
+	}(tx)
+
+	if _, err := tx.Exec(
+		`UPDATE auth_tokens SET revoked_at = NOW()
+		 WHERE revoked_at IS NULL AND family_id IN (SELECT id FROM user_sessions WHERE client_id = $1)`,
+		id,
+	); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(
+		"UPDATE user_sessions SET revoked_at = NOW() WHERE client_id = $1 AND revoked_at IS NULL",
+		id,
+	); err != nil {
+		return err
+	}
+
+	result, err := tx.Exec("DELETE FROM oauth_clients WHERE id = $1", id)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrClientNotFound
+	}
+
+	return tx.Commit()
+}
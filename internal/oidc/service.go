@@ -0,0 +1,252 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"auth-user-service/internal/auth"
+	"auth-user-service/internal/token"
+	"auth-user-service/internal/user"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var (
+	ErrInvalidClient = errors.New("invalid client credentials")
+	ErrInvalidGrant  = errors.New("invalid or expired authorization code")
+)
+
+// SupportedScopes - scope, которые понимает провайдер. openid обязателен
+var SupportedScopes = []string{"openid", "profile", "email", "phone"}
+
+// Config - настройки OIDC-провайдера
+type Config struct {
+	// Issuer - внешний адрес сервиса, он же iss в ID token
+	Issuer string
+	// CodeTTL - время жизни кода авторизации
+	CodeTTL time.Duration
+	// IDTokenTTL - время жизни ID token
+	IDTokenTTL time.Duration
+}
+
+type Service interface {
+	Config() Config
+	RegisterClient(name string, redirectURIs []string, public bool) (*Client, string, error)
+	GetClient(id string) (*Client, error)
+	ListClients() ([]Client, error)
+	DeleteClient(id string) error
+	AuthenticateClient(id, secret string) (*Client, error)
+	CreateCode(grant *Grant) (string, error)
+	ExchangeCode(client *Client, code, redirectURI, codeVerifier string) (*Grant, error)
+	IDToken(u *auth.User, profile *user.Profile, clientID, scope, nonce string, authTime int64) (string, error)
+}
+
+type service struct {
+	repo  Repository
+	codes CodeStore
+	keys  *token.KeyRing
+	cfg   Config
+}
+
+func NewService(repo Repository, codes CodeStore, keys *token.KeyRing, cfg Config) Service {
+	return &service{repo: repo, codes: codes, keys: keys, cfg: cfg}
+}
+
+func (s *service) Config() Config {
+	return s.cfg
+}
+
+// RegisterClient регистрирует приложение и возвращает его секрет. Секрет показывается
+// один раз, в БД хранится только хэш. Публичным клиентам секрет не выдаётся
+func (s *service) RegisterClient(name string, redirectURIs []string, public bool) (*Client, string, error) {
+	id, err := randomString(16)
+	if err != nil {
+		return nil, "", err
+	}
+
+	client := &Client{ID: id, Name: name, RedirectURIs: redirectURIs}
+
+	var secret string
+	if !public {
+		secret, err = randomString(32)
+		if err != nil {
+			return nil, "", err
+		}
+		client.SecretHash = hashSecret(secret)
+	}
+
+	if err := s.repo.CreateClient(client); err != nil {
+		return nil, "", err
+	}
+	return client, secret, nil
+}
+
+func (s *service) GetClient(id string) (*Client, error) {
+	return s.repo.GetClient(id)
+}
+
+func (s *service) ListClients() ([]Client, error) {
+	return s.repo.ListClients()
+}
+
+func (s *service) DeleteClient(id string) error {
+	return s.repo.DeleteClient(id)
+}
+
+// AuthenticateClient проверяет client_id и секрет. Публичный клиент секрета не предъявляет
+func (s *service) AuthenticateClient(id, secret string) (*Client, error) {
+	client, err := s.repo.GetClient(id)
+	if errors.Is(err, ErrClientNotFound) {
+		return nil, ErrInvalidClient
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if client.Public() {
+		if secret != "" {
+			return nil, ErrInvalidClient
+		}
+		return client, nil
+	}
+	if subtle.ConstantTimeCompare([]byte(hashSecret(secret)), []byte(client.SecretHash)) != 1 {
+		return nil, ErrInvalidClient
+	}
+	return client, nil
+}
+
+// CreateCode выдаёт одноразовый код авторизации. Хранится только его хэш
+func (s *service) CreateCode(grant *Grant) (string, error) {
+	code, err := randomString(32)
+	if err != nil {
+		return "", err
+	}
+	if err := s.codes.Save(context.Background(), hashSecret(code), grant, s.cfg.CodeTTL); err != nil {
+		return "", err
+	}
+	return code, nil
+}
+
+// ExchangeCode гасит код и проверяет, что его предъявил тот же клиент с тем же
+// redirect_uri и верным code_verifier (PKCE S256)
+func (s *service) ExchangeCode(client *Client, code, redirectURI, codeVerifier string) (*Grant, error) {
+	if code == "" {
+		return nil, ErrInvalidGrant
+	}
+
+	grant, err := s.codes.Take(context.Background(), hashSecret(code))
+	if err != nil {
+		return nil, err
+	}
+	if grant == nil || grant.ClientID != client.ID || grant.RedirectURI != redirectURI {
+		return nil, ErrInvalidGrant
+	}
+
+	sum := sha256.Sum256([]byte(codeVerifier))
+	challenge := base64.RawURLEncoding.EncodeToString(sum[:])
+	if codeVerifier == "" || subtle.ConstantTimeCompare([]byte(challenge), []byte(grant.CodeChallenge)) != 1 {
+		return nil, ErrInvalidGrant
+	}
+	return grant, nil
+}
+
+// IDToken выпускает ID token для клиента. Состав claims зависит от scope
+func (s *service) IDToken(u *auth.User, profile *user.Profile, clientID, scope, nonce string, authTime int64) (string, error) {
+	now := time.Now()
+	claims := UserClaims(u, profile, scope)
+	claims["iss"] = s.cfg.Issuer
+	claims["aud"] = clientID
+	claims["iat"] = now.Unix()
+	claims["exp"] = now.Add(s.cfg.IDTokenTTL).Unix()
+	if nonce != "" {
+		claims["nonce"] = nonce
+	}
+	if authTime != 0 {
+		claims["auth_time"] = authTime
+	}
+	return s.keys.Sign(claims)
+}
+
+// UserClaims - стандартные claims OIDC о пользователе (ID token и /userinfo)
+func UserClaims(u *auth.User, profile *user.Profile, scope string) jwt.MapClaims {
+	claims := jwt.MapClaims{"sub": strconv.Itoa(u.ID)}
+
+	for _, sc := range strings.Fields(scope) {
+		switch sc {
+		case "email":
+			claims["email"] = u.Email
+			claims["email_verified"] = u.EmailVerifiedAt != nil
+		case "profile":
+			if name := strings.TrimSpace(u.FirstName + " " + u.LastName); name != "" {
+				claims["name"] = name
+			}
+			if u.FirstName != "" {
+				claims["given_name"] = u.FirstName
+			}
+			if u.LastName != "" {
+				claims["family_name"] = u.LastName
+			}
+			updatedAt := u.UpdatedAt
+			if profile != nil && profile.UpdatedAt.After(updatedAt) {
+				updatedAt = profile.UpdatedAt
+			}
+			claims["updated_at"] = updatedAt.Unix()
+		case "phone":
+			if profile != nil && profile.Phone != "" {
+				claims["phone_number"] = profile.Phone
+			}
+		}
+	}
+	return claims
+}
+
+// NormalizeScope оставляет только поддерживаемые scope без повторов
+func NormalizeScope(scope string) string {
+	var result []string
+	seen := make(map[string]bool)
+	for _, sc := range strings.Fields(scope) {
+		if seen[sc] {
+			continue
+		}
+		for _, supported := range SupportedScopes {
+			if sc == supported {
+				result = append(result, sc)
+				seen[sc] = true
+				break
+			}
+		}
+	}
+	return strings.Join(result, " ")
+}
+
+// HasScope проверяет наличие scope в строке через пробел
+func HasScope(scope, want string) bool {
+	for _, sc := range strings.Fields(scope) {
+		if sc == want {
+			return true
+		}
+	}
+	return false
+}
+
+func randomString(size int) (string, error) {
+	buf := make([]byte, size)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// hashSecret - SHA-256 в hex. Секреты и коды высокоэнтропийные, медленный хэш не нужен
+func hashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
@@ -110,3 +110,28 @@ func (h *Handler) GetUserOrders(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 }
+
+// GetAllOrders - все заказы (для персонала), параметры limit и offset
+func (h *Handler) GetAllOrders(w http.ResponseWriter, r *http.Request) {
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	if limit <= 0 || limit > 100 {
+		limit = 50
+	}
+	offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+	if offset < 0 {
+		offset = 0
+	}
+
+	orders, total, err := h.service.GetAllOrders(limit, offset)
+	if err != nil {
+		http.Error(w, `{"error": "Failed to get orders"}`, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Total-Count", strconv.Itoa(total))
+	err = json.NewEncoder(w).Encode(orders)
+	if err != nil {
+		return
+	}
+}
@@ -9,6 +9,7 @@ type Repository interface {
 	GetOrder(orderID, userID int) (*Order, error)
 	CreateOrder(order *Order) (int, error)
 	GetUserOrders(userID int) ([]Order, error)
+	GetAllOrders(limit, offset int) ([]Order, int, error)
 }
 
 type repository struct {
@@ -97,3 +98,44 @@ func (r *repository) GetUserOrders(userID int) ([]Order, error) {
 
 	return orders, nil
 }
+
+// GetAllOrders - заказы всех пользователей для персонала, с общим количеством для пагинации
+func (r *repository) GetAllOrders(limit, offset int) ([]Order, int, error) {
+	var total int
+	if err := r.db.QueryRow("SELECT COUNT(*) FROM orders").Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	// У заказов удалённых пользователей владельца нет - user_id отдаётся как 0
+	rows, err := r.db.Query(
+		`SELECT id, COALESCE(user_id, 0), title, description, price, status, created_at, updated_at 
+		 FROM orders 
+		 ORDER BY created_at DESC
+		 LIMIT $1 OFFSET $2`,
+		limit, offset,
+	)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer func(rows *sql.Rows) {
+		err := rows.Close()
+		if err != nil {
+
+		}
+	}(rows)
+
+	orders := []Order{}
+	for rows.Next() {
+		var order Order
+		err := rows.Scan(
+			&order.ID, &order.UserID, &order.Title, &order.Description,
+			&order.Price, &order.Status, &order.CreatedAt, &order.UpdatedAt,
+		)
+		if err != nil {
+			return nil, 0, err
+		}
+		orders = append(orders, order)
+	}
+
+	return orders, total, nil
+}
@@ -4,6 +4,7 @@ type Service interface {
 	GetOrder(orderID, userID int) (*Order, error)
 	CreateOrder(userID int, title, description string, price float64) (*Order, error)
 	GetUserOrders(userID int) ([]Order, error)
+	GetAllOrders(limit, offset int) ([]Order, int, error)
 }
 
 type service struct {
@@ -39,3 +40,7 @@ func (s *service) CreateOrder(userID int, title, description string, price float
 func (s *service) GetUserOrders(userID int) ([]Order, error) {
 	return s.repo.GetUserOrders(userID)
 }
+
+func (s *service) GetAllOrders(limit, offset int) ([]Order, int, error) {
+	return s.repo.GetAllOrders(limit, offset)
+}
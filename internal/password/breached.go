@@ -0,0 +1,110 @@
+package password
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// BreachedList - список паролей из утечек
+type BreachedList interface {
+	Contains(password string) (bool, error)
+}
+
+// LoadBreachedList открывает список утечек в формате Have I Been Pwned.
+//
+// Если path - каталог, в нём лежат файлы диапазонов, как их отдаёт HIBP range API
+// и haveibeenpwned-downloader: имя файла - первые 5 символов SHA-1 (например
+// 21BD1.txt), строки - оставшиеся 35 символов и счётчик через двоеточие. Нужный
+// файл читается при каждой проверке, поэтому полная база не держится в памяти.
+//
+// Если path - файл, он целиком загружается в память: строки вида
+// "<SHA-1>" или "<SHA-1>:<счётчик>". Подходит для урезанных списков.
+func LoadBreachedList(path string) (BreachedList, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return &rangeDirectory{dir: path}, nil
+	}
+	return loadHashFile(path)
+}
+
+func sha1Hex(password string) string {
+	sum := sha1.Sum([]byte(password))
+	return strings.ToUpper(hex.EncodeToString(sum[:]))
+}
+
+// rangeDirectory - каталог файлов диапазонов по префиксу SHA-1
+type rangeDirectory struct {
+	dir string
+}
+
+func (d *rangeDirectory) Contains(password string) (bool, error) {
+	hash := sha1Hex(password)
+	prefix, suffix := hash[:5], hash[5:]
+
+	file, err := os.Open(filepath.Join(d.dir, prefix+".txt"))
+	if errors.Is(err, os.ErrNotExist) {
+		file, err = os.Open(filepath.Join(d.dir, prefix))
+	}
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	defer func(file *os.File) {
+		_ = file.Close()
+	}(file)
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line, _, _ := strings.Cut(strings.TrimSpace(scanner.Text()), ":")
+		if strings.EqualFold(line, suffix) {
+			return true, nil
+		}
+	}
+	return false, scanner.Err()
+}
+
+// hashSet - список полных SHA-1 в памяти
+type hashSet map[string]struct{}
+
+func loadHashFile(path string) (hashSet, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func(file *os.File) {
+		_ = file.Close()
+	}(file)
+
+	set := make(hashSet)
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		hash, _, _ := strings.Cut(strings.TrimSpace(scanner.Text()), ":")
+		if hash == "" {
+			continue
+		}
+		if len(hash) != sha1.Size*2 {
+			return nil, fmt.Errorf("%s:%d: expected SHA-1 hex hash", path, line)
+		}
+		set[strings.ToUpper(hash)] = struct{}{}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return set, nil
+}
+
+func (s hashSet) Contains(password string) (bool, error) {
+	_, ok := s[sha1Hex(password)]
+	return ok, nil
+}
@@ -0,0 +1,181 @@
+package password
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Алгоритмы хэширования паролей
+const (
+	AlgorithmArgon2id = "argon2id"
+	AlgorithmBcrypt   = "bcrypt"
+)
+
+var (
+	ErrUnknownAlgorithm = errors.New("unknown password hash algorithm")
+	ErrMalformedHash    = errors.New("malformed password hash")
+)
+
+// Hasher хэширует и проверяет пароли
+type Hasher interface {
+	Hash(password string) (string, error)
+	// Verify сравнивает пароль с хэшем. needsRehash = true, если хэш сделан другим
+	// алгоритмом или с устаревшими параметрами и его стоит пересчитать
+	Verify(encodedHash, password string) (match bool, needsRehash bool, err error)
+}
+
+// Argon2Params - параметры argon2id. Memory - в КиБ
+type Argon2Params struct {
+	Memory      uint32
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+}
+
+// DefaultArgon2Params - рекомендация OWASP: 64 МиБ, 3 прохода
+var DefaultArgon2Params = Argon2Params{
+	Memory:      64 * 1024,
+	Iterations:  3,
+	Parallelism: 2,
+	SaltLength:  16,
+	KeyLength:   32,
+}
+
+// Config - каким алгоритмом хэшировать новые пароли
+type Config struct {
+	Algorithm  string
+	Argon2     Argon2Params
+	BcryptCost int
+}
+
+type hasher struct {
+	cfg Config
+}
+
+// NewHasher создаёт хэшер. Проверять он умеет и argon2id, и bcrypt, независимо от
+// выбранного алгоритма, поэтому смена алгоритма не ломает вход со старыми хэшами
+func NewHasher(cfg Config) (Hasher, error) {
+	switch cfg.Algorithm {
+	case AlgorithmArgon2id:
+		if cfg.Argon2.Memory == 0 || cfg.Argon2.Iterations == 0 || cfg.Argon2.Parallelism == 0 {
+			return nil, errors.New("argon2id memory, iterations and parallelism must be positive")
+		}
+		if cfg.Argon2.SaltLength == 0 {
+			cfg.Argon2.SaltLength = DefaultArgon2Params.SaltLength
+		}
+		if cfg.Argon2.KeyLength == 0 {
+			cfg.Argon2.KeyLength = DefaultArgon2Params.KeyLength
+		}
+	case AlgorithmBcrypt:
+		if cfg.BcryptCost == 0 {
+			cfg.BcryptCost = bcrypt.DefaultCost
+		}
+		if cfg.BcryptCost < bcrypt.MinCost || cfg.BcryptCost > bcrypt.MaxCost {
+			return nil, fmt.Errorf("bcrypt cost must be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost)
+		}
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnknownAlgorithm, cfg.Algorithm)
+	}
+	return &hasher{cfg: cfg}, nil
+}
+
+func (h *hasher) Hash(password string) (string, error) {
+	if h.cfg.Algorithm == AlgorithmBcrypt {
+		hash, err := bcrypt.GenerateFromPassword([]byte(password), h.cfg.BcryptCost)
+		return string(hash), err
+	}
+
+	salt := make([]byte, h.cfg.Argon2.SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	return encodeArgon2(h.cfg.Argon2, salt, argon2Key(h.cfg.Argon2, password, salt)), nil
+}
+
+func (h *hasher) Verify(encodedHash, password string) (bool, bool, error) {
+	switch {
+	case strings.HasPrefix(encodedHash, "$argon2id$"):
+		params, salt, key, err := decodeArgon2(encodedHash)
+		if err != nil {
+			return false, false, err
+		}
+		params.SaltLength = uint32(len(salt))
+		params.KeyLength = uint32(len(key))
+
+		actual := argon2Key(params, password, salt)
+		if subtle.ConstantTimeCompare(actual, key) != 1 {
+			return false, false, nil
+		}
+		return true, h.cfg.Algorithm != AlgorithmArgon2id || params != h.cfg.Argon2, nil
+
+	case strings.HasPrefix(encodedHash, "$2"):
+		err := bcrypt.CompareHashAndPassword([]byte(encodedHash), []byte(password))
+		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			return false, false, nil
+		}
+		if err != nil {
+			return false, false, fmt.Errorf("%w: %v", ErrMalformedHash, err)
+		}
+		if h.cfg.Algorithm != AlgorithmBcrypt {
+			return true, true, nil
+		}
+		cost, err := bcrypt.Cost([]byte(encodedHash))
+		return true, err == nil && cost != h.cfg.BcryptCost, nil
+	}
+
+	return false, false, ErrUnknownAlgorithm
+}
+
+func argon2Key(p Argon2Params, password string, salt []byte) []byte {
+	return argon2.IDKey([]byte(password), salt, p.Iterations, p.Memory, p.Parallelism, p.KeyLength)
+}
+
+// encodeArgon2 записывает хэш в формате PHC:
+// $argon2id$v=19$m=65536,t=3,p=2$<соль>$<хэш>
+func encodeArgon2(p Argon2Params, salt, key []byte) string {
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, p.Memory, p.Iterations, p.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	)
+}
+
+func decodeArgon2(encoded string) (Argon2Params, []byte, []byte, error) {
+	var p Argon2Params
+
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 {
+		return p, nil, nil, ErrMalformedHash
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil {
+		return p, nil, nil, ErrMalformedHash
+	}
+	if version != argon2.Version {
+		return p, nil, nil, fmt.Errorf("%w: unsupported argon2 version %d", ErrMalformedHash, version)
+	}
+
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &p.Memory, &p.Iterations, &p.Parallelism); err != nil {
+		return p, nil, nil, ErrMalformedHash
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return p, nil, nil, ErrMalformedHash
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(key) == 0 {
+		return p, nil, nil, ErrMalformedHash
+	}
+
+	return p, salt, key, nil
+}
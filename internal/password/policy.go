@@ -0,0 +1,107 @@
+package password
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"unicode/utf8"
+)
+
+// Violation - нарушение требований к паролю в виде ошибки поля формы
+type Violation struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// ValidationError - пароль не прошёл политику
+type ValidationError struct {
+	Violations []Violation
+}
+
+func (e *ValidationError) Error() string {
+	messages := make([]string, len(e.Violations))
+	for i, v := range e.Violations {
+		messages[i] = v.Message
+	}
+	return "password policy: " + strings.Join(messages, "; ")
+}
+
+// PolicyConfig - требования к паролю
+type PolicyConfig struct {
+	MinLength int
+	// MaxLength ограничивает длину, чтобы хэширование не стало способом DoS
+	MaxLength int
+	// MinStrength - минимальная оценка Strength от 0 до 4, 0 отключает проверку
+	MinStrength int
+	// ForbidEmail запрещает пароли, содержащие email или его имя до @
+	ForbidEmail bool
+}
+
+// Policy проверяет новые пароли при регистрации, смене и сбросе
+type Policy struct {
+	cfg      PolicyConfig
+	breached BreachedList
+}
+
+// NewPolicy создаёт политику. breached может быть nil - тогда проверка по утечкам отключена
+func NewPolicy(cfg PolicyConfig, breached BreachedList) *Policy {
+	return &Policy{cfg: cfg, breached: breached}
+}
+
+// Validate возвращает *ValidationError со всеми нарушениями или nil.
+// Недоступный список утечек не мешает смене пароля, ошибка только логируется
+func (p *Policy) Validate(password, email string) error {
+	var violations []Violation
+	add := func(code, message string) {
+		violations = append(violations, Violation{Field: "password", Code: code, Message: message})
+	}
+
+	length := utf8.RuneCountInString(password)
+	if length < p.cfg.MinLength {
+		add("too_short", fmt.Sprintf("Password must be at least %d characters long", p.cfg.MinLength))
+	}
+	if p.cfg.MaxLength > 0 && length > p.cfg.MaxLength {
+		add("too_long", fmt.Sprintf("Password must be at most %d characters long", p.cfg.MaxLength))
+		// Дальше не проверяем, чтобы не гонять оценку по мегабайтной строке
+		return &ValidationError{Violations: violations}
+	}
+
+	if p.cfg.ForbidEmail && containsEmail(password, email) {
+		add("contains_email", "Password must not contain your email")
+	}
+
+	if p.cfg.MinStrength > 0 && Strength(password) < p.cfg.MinStrength {
+		add("too_weak", "Password is too easy to guess, add more words or unrelated characters")
+	}
+
+	if p.breached != nil && password != "" {
+		found, err := p.breached.Contains(password)
+		if err != nil {
+			log.Printf("⚠️ Breached password check failed: %v", err)
+		}
+		if found {
+			add("breached", "Password has appeared in a data breach, choose a different one")
+		}
+	}
+
+	if len(violations) > 0 {
+		return &ValidationError{Violations: violations}
+	}
+	return nil
+}
+
+func containsEmail(password, email string) bool {
+	password = strings.ToLower(password)
+	email = strings.ToLower(strings.TrimSpace(email))
+	if email == "" {
+		return false
+	}
+
+	if strings.Contains(password, email) {
+		return true
+	}
+	// Совпадение с короткой частью вроде "ab" ничего не говорит о пароле
+	local, _, _ := strings.Cut(email, "@")
+	return len(local) >= 3 && strings.Contains(password, local)
+}
@@ -0,0 +1,207 @@
+package password
+
+import (
+	"math"
+	"strings"
+	"unicode"
+)
+
+// commonPasswords - самые частые пароли из публичных утечек, по убыванию популярности.
+// Пароль из списка или с таким фрагментом подбирается за минимальное число попыток
+var commonPasswords = []string{
+	"123456", "password", "12345678", "qwerty", "123456789", "12345", "1234", "111111",
+	"1234567", "dragon", "123123", "baseball", "abc123", "football", "monkey", "letmein",
+	"696969", "shadow", "master", "666666", "qwertyuiop", "123321", "mustang", "1234567890",
+	"michael", "654321", "superman", "1qaz2wsx", "7777777", "121212", "000000", "qazwsx",
+	"123qwe", "killer", "trustno1", "jordan", "jennifer", "zxcvbnm", "asdfgh", "hunter",
+	"buster", "soccer", "harley", "batman", "andrew", "tigger", "sunshine", "iloveyou",
+	"charlie", "robert", "thomas", "hockey", "ranger", "daniel", "starwars", "klaster",
+	"112233", "george", "computer", "michelle", "jessica", "pepper", "zxcvbn", "555555",
+	"11111111", "131313", "freedom", "777777", "pass", "maggie", "159753", "aaaaaa",
+	"ginger", "princess", "joshua", "cheese", "amanda", "summer", "love", "ashley",
+	"nicole", "chelsea", "biteme", "matthew", "access", "yankees", "987654321", "dallas",
+	"austin", "thunder", "taylor", "matrix", "admin", "welcome", "login", "passw0rd",
+	"qwerty123", "secret", "parol", "privet", "zaq12wsx", "1q2w3e4r", "1q2w3e", "q1w2e3r4",
+}
+
+var commonRank = func() map[string]int {
+	ranks := make(map[string]int, len(commonPasswords))
+	for i, p := range commonPasswords {
+		ranks[p] = i + 1
+	}
+	return ranks
+}()
+
+// keyboardRows - ряды клавиатуры для поиска шаблонов вроде "asdf" и "7890"
+var keyboardRows = []string{"1234567890", "qwertyuiop", "asdfghjkl", "zxcvbnm"}
+
+var leetReplacer = strings.NewReplacer("4", "a", "@", "a", "3", "e", "1", "i", "!", "i", "0", "o", "$", "s", "5", "s", "7", "t")
+
+// Strength оценивает стойкость пароля по шкале zxcvbn от 0 (угадывается сразу)
+// до 4 (больше 10^10 попыток). Оценка упрощённая: пароль разбирается слева направо
+// на известные шаблоны (частые пароли, повторы, последовательности, ряды клавиатуры,
+// годы), каждый шаблон стоит столько попыток, сколько нужно его перебрать,
+// остальные символы - размер алфавита пароля
+func Strength(password string) int {
+	guesses := math.Log10(estimateGuesses(password))
+	switch {
+	case guesses < 3:
+		return 0
+	case guesses < 6:
+		return 1
+	case guesses < 8:
+		return 2
+	case guesses < 10:
+		return 3
+	}
+	return 4
+}
+
+// estimateGuesses - оценка числа попыток для подбора
+func estimateGuesses(password string) float64 {
+	runes := []rune(strings.ToLower(password))
+	if len(runes) == 0 {
+		return 1
+	}
+
+	charset := float64(charsetSize(password))
+	log10 := 0.0
+	patterns := 0
+
+	for i := 0; i < len(runes); {
+		length, guesses := matchPattern(runes[i:])
+		if length == 0 {
+			log10 += math.Log10(charset)
+			i++
+			continue
+		}
+		log10 += math.Log10(guesses)
+		patterns++
+		i += length
+	}
+
+	// Несколько шаблонов подряд ещё надо догадаться скомбинировать
+	if patterns > 1 {
+		log10 += math.Log10(float64(patterns))
+	}
+	return math.Pow(10, log10)
+}
+
+// matchPattern ищет самый длинный шаблон в начале строки.
+// Возвращает его длину (0 - шаблона нет) и число попыток на перебор
+func matchPattern(runes []rune) (int, float64) {
+	bestLength, bestGuesses := 0, 0.0
+	consider := func(length int, guesses float64) {
+		if length > bestLength || (length == bestLength && guesses < bestGuesses) {
+			bestLength, bestGuesses = length, guesses
+		}
+	}
+
+	// Частые пароли, в том числе в leet-записи ("p@ssw0rd")
+	for end := len(runes); end >= 4; end-- {
+		word := string(runes[:end])
+		if rank, ok := commonRank[word]; ok {
+			consider(end, float64(rank))
+			break
+		}
+		if rank, ok := commonRank[leetReplacer.Replace(word)]; ok {
+			consider(end, float64(rank)*2)
+			break
+		}
+	}
+
+	// Повтор одного символа: "aaaa"
+	n := 1
+	for n < len(runes) && runes[n] == runes[0] {
+		n++
+	}
+	if n >= 3 {
+		consider(n, 10*float64(n))
+	}
+
+	// Последовательность с постоянным шагом ±1: "abcd", "4321"
+	if len(runes) >= 3 {
+		step := runes[1] - runes[0]
+		if step == 1 || step == -1 {
+			n = 2
+			for n < len(runes) && runes[n]-runes[n-1] == step {
+				n++
+			}
+			if n >= 3 {
+				consider(n, 26*float64(n))
+			}
+		}
+	}
+
+	// Ряд клавиатуры: "qwer", "asdf"
+	for _, row := range keyboardRows {
+		start := strings.IndexRune(row, runes[0])
+		if start < 0 {
+			continue
+		}
+		n = 0
+		for n < len(runes) && start+n < len(row) && rune(row[start+n]) == runes[n] {
+			n++
+		}
+		if n >= 4 {
+			consider(n, 40*float64(n))
+		}
+	}
+
+	// Год: 1900-2099
+	if len(runes) >= 4 {
+		year := string(runes[:4])
+		if (strings.HasPrefix(year, "19") || strings.HasPrefix(year, "20")) && isDigits(year) {
+			consider(4, 200)
+		}
+	}
+
+	return bestLength, bestGuesses
+}
+
+// charsetSize - размер алфавита, из которого составлен пароль
+func charsetSize(password string) int {
+	var lower, upper, digit, symbol, other bool
+	for _, r := range password {
+		switch {
+		case r >= 'a' && r <= 'z':
+			lower = true
+		case r >= 'A' && r <= 'Z':
+			upper = true
+		case r >= '0' && r <= '9':
+			digit = true
+		case r < unicode.MaxASCII:
+			symbol = true
+		default:
+			other = true
+		}
+	}
+
+	size := 0
+	if lower {
+		size += 26
+	}
+	if upper {
+		size += 26
+	}
+	if digit {
+		size += 10
+	}
+	if symbol {
+		size += 33
+	}
+	if other {
+		// Кириллица и прочие алфавиты
+		size += 66
+	}
+	return size
+}
+
+func isDigits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
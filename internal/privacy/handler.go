@@ -0,0 +1,244 @@
+package privacy
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"auth-user-service/internal/audit"
+	"auth-user-service/internal/auth"
+	"auth-user-service/internal/user"
+)
+
+type Handler struct {
+	service Service
+	events  audit.Service
+}
+
+func NewHandler(service Service, events audit.Service) *Handler {
+	return &Handler{service: service, events: events}
+}
+
+// ExportData - выгрузка всех данных пользователя. Параметр format: json (по умолчанию)
+// или zip - архив с отдельным файлом на каждый раздел
+func (h *Handler) ExportData(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int)
+	if !ok {
+		http.Error(w, `{"error": "User not authenticated"}`, http.StatusUnauthorized)
+		return
+	}
+
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "json"
+	}
+	if format != "json" && format != "zip" {
+		http.Error(w, `{"error": "format must be json or zip"}`, http.StatusBadRequest)
+		return
+	}
+
+	export, err := h.service.Export(userID)
+	if err != nil {
+		log.Printf("❌ Data export failed for user %d: %v", userID, err)
+		http.Error(w, `{"error": "Failed to export data"}`, http.StatusInternalServerError)
+		return
+	}
+
+	h.events.Record(audit.NewEvent(r, audit.DataExported, userID, audit.Metadata{"format": format}))
+
+	filename := fmt.Sprintf("user-%d-export-%s.%s", userID, export.ExportedAt.Format("20060102"), format)
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+	w.Header().Set("Cache-Control", "no-store")
+
+	if format == "zip" {
+		w.Header().Set("Content-Type", "application/zip")
+		if err := writeZip(w, export); err != nil {
+			log.Printf("❌ Failed to write data export archive for user %d: %v", userID, err)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	err = encoder.Encode(export)
+	if err != nil {
+		return
+	}
+}
+
+// writeZip пишет выгрузку архивом: account.json, profile.json, orders.json, sessions.json
+func writeZip(w http.ResponseWriter, export *Export) error {
+	archive := zip.NewWriter(w)
+
+	files := []struct {
+		name string
+		data interface{}
+	}{
+		{"account.json", export.Account},
+		{"profile.json", export.Profile},
+		{"orders.json", export.Orders},
+		{"sessions.json", export.Sessions},
+	}
+	for _, file := range files {
+		f, err := archive.CreateHeader(&zip.FileHeader{
+			Name:     file.name,
+			Method:   zip.Deflate,
+			Modified: export.ExportedAt,
+		})
+		if err != nil {
+			return err
+		}
+		encoder := json.NewEncoder(f)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(file.data); err != nil {
+			return err
+		}
+	}
+
+	return archive.Close()
+}
+
+type DeletionRequest struct {
+	Password string `json:"password"`
+	// ConfirmationToken - токен из письма SendDeletionConfirmation для аккаунтов без пароля
+	ConfirmationToken string `json:"confirmation_token"`
+}
+
+// RequestDeletion - запрос на удаление аккаунта, подтверждённый паролем или токеном из письма.
+// Аккаунт удаляется по истечении срока, до этого удаление можно отменить
+func (h *Handler) RequestDeletion(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int)
+	if !ok {
+		http.Error(w, `{"error": "User not authenticated"}`, http.StatusUnauthorized)
+		return
+	}
+
+	var req DeletionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, `{"error": "Invalid request"}`, http.StatusBadRequest)
+		return
+	}
+
+	var scheduledAt time.Time
+	var err error
+	switch {
+	case req.ConfirmationToken != "":
+		scheduledAt, err = h.service.ConfirmDeletion(userID, req.ConfirmationToken)
+	case req.Password != "":
+		scheduledAt, err = h.service.RequestDeletion(userID, req.Password)
+	default:
+		http.Error(w, `{"error": "Password or confirmation token is required"}`, http.StatusBadRequest)
+		return
+	}
+
+	var locked *auth.LockedError
+	if errors.As(err, &locked) {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(locked.RetryAfter.Seconds()))))
+		http.Error(w, `{"error": "Too many failed attempts, try again later"}`, http.StatusTooManyRequests)
+		return
+	}
+	if errors.Is(err, auth.ErrInvalidCredentials) {
+		// У аккаунтов, созданных по ссылке, через провайдера или по телефону, пароля нет
+		http.Error(w, `{"error": "Password is incorrect. Accounts without a password can confirm deletion by email via /api/user/deletion/confirmation"}`, http.StatusForbidden)
+		return
+	}
+	if errors.Is(err, auth.ErrDeletionTokenInvalid) {
+		http.Error(w, `{"error": "Invalid or expired confirmation token"}`, http.StatusForbidden)
+		return
+	}
+	if errors.Is(err, user.ErrUserNotFound) || errors.Is(err, auth.ErrUserNotFound) {
+		http.Error(w, `{"error": "User not found"}`, http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("❌ Failed to schedule deletion of account %d: %v", userID, err)
+		http.Error(w, `{"error": "Failed to schedule account deletion"}`, http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("🗑️ User %d requested account deletion, scheduled for %s", userID, scheduledAt.Format(time.RFC3339))
+	h.events.Record(audit.NewEvent(r, audit.AccountDeletionRequested, userID, audit.Metadata{"scheduled_at": scheduledAt}))
+
+	response := map[string]interface{}{
+		"message":               "Account deletion scheduled",
+		"deletion_scheduled_at": scheduledAt,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		return
+	}
+}
+
+// SendDeletionConfirmation - письмо со ссылкой подтверждения удаления для аккаунтов без пароля
+func (h *Handler) SendDeletionConfirmation(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int)
+	if !ok {
+		http.Error(w, `{"error": "User not authenticated"}`, http.StatusUnauthorized)
+		return
+	}
+
+	err := h.service.SendDeletionConfirmation(userID)
+	if errors.Is(err, auth.ErrUserNotFound) {
+		http.Error(w, `{"error": "User not found"}`, http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("❌ Failed to send deletion confirmation to user %d: %v", userID, err)
+		http.Error(w, `{"error": "Failed to send confirmation email"}`, http.StatusInternalServerError)
+		return
+	}
+
+	response := map[string]string{
+		"message": "Confirmation link has been sent to your email",
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		return
+	}
+}
+
+// CancelDeletion - отмена запланированного удаления аккаунта
+func (h *Handler) CancelDeletion(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int)
+	if !ok {
+		http.Error(w, `{"error": "User not authenticated"}`, http.StatusUnauthorized)
+		return
+	}
+
+	err := h.service.CancelDeletion(userID)
+	if errors.Is(err, user.ErrDeletionNotScheduled) {
+		http.Error(w, `{"error": "Account deletion not scheduled"}`, http.StatusConflict)
+		return
+	}
+	if err != nil {
+		log.Printf("❌ Failed to cancel deletion of account %d: %v", userID, err)
+		http.Error(w, `{"error": "Failed to cancel account deletion"}`, http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("🗑️ User %d cancelled account deletion", userID)
+	h.events.Record(audit.NewEvent(r, audit.AccountDeletionCancelled, userID, nil))
+
+	response := map[string]string{
+		"message": "Account deletion cancelled",
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		return
+	}
+}
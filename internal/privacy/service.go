@@ -0,0 +1,186 @@
+package privacy
+
+import (
+	"errors"
+	"log"
+	"time"
+
+	"auth-user-service/internal/audit"
+	"auth-user-service/internal/auth"
+	"auth-user-service/internal/order"
+	"auth-user-service/internal/user"
+)
+
+// AuthService - сессии и пароль пользователя из сервиса авторизации
+type AuthService interface {
+	ListSessions(userID int) ([]auth.Session, error)
+	RevokeAllSessions(userID int) error
+	VerifyPassword(userID int, password string) error
+	SendDeletionConfirmation(userID int) error
+	ConsumeDeletionConfirmation(userID int, token string) error
+}
+
+// Service - выгрузка персональных данных и удаление аккаунта по запросу пользователя
+type Service interface {
+	Export(userID int) (*Export, error)
+	// RequestDeletion требует пароль: украденной сессии не должно хватать для удаления аккаунта
+	RequestDeletion(userID int, password string) (time.Time, error)
+	// SendDeletionConfirmation высылает ссылку подтверждения удаления для аккаунтов без пароля
+	SendDeletionConfirmation(userID int) error
+	// ConfirmDeletion назначает удаление по токену из письма вместо пароля
+	ConfirmDeletion(userID int, token string) (time.Time, error)
+	CancelDeletion(userID int) error
+	// PurgeDueAccounts удаляет аккаунты, у которых истёк срок на отмену удаления
+	PurgeDueAccounts() (int, error)
+}
+
+// Config - настройки удаления аккаунтов
+type Config struct {
+	// GracePeriod - сколько аккаунт ждёт удаления, пока пользователь может передумать
+	GracePeriod time.Duration
+}
+
+// Export - все данные пользователя, которые хранит сервис
+type Export struct {
+	ExportedAt time.Time      `json:"exported_at"`
+	Account    *user.Account  `json:"account"`
+	Profile    *user.Profile  `json:"profile"`
+	Orders     []order.Order  `json:"orders"`
+	Sessions   []auth.Session `json:"sessions"`
+}
+
+type service struct {
+	users  user.Service
+	orders order.Service
+	auth   AuthService
+	events audit.Service
+	cfg    Config
+}
+
+func NewService(users user.Service, orders order.Service, authService AuthService, events audit.Service, cfg Config) Service {
+	return &service{
+		users:  users,
+		orders: orders,
+		auth:   authService,
+		events: events,
+		cfg:    cfg,
+	}
+}
+
+func (s *service) Export(userID int) (*Export, error) {
+	account, err := s.users.GetAccount(userID)
+	if err != nil {
+		return nil, err
+	}
+	if account == nil {
+		return nil, user.ErrUserNotFound
+	}
+
+	profile, err := s.users.GetProfile(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	orders, err := s.orders.GetUserOrders(userID)
+	if err != nil {
+		return nil, err
+	}
+	if orders == nil {
+		orders = []order.Order{}
+	}
+
+	sessions, err := s.auth.ListSessions(userID)
+	if err != nil {
+		return nil, err
+	}
+	if sessions == nil {
+		sessions = []auth.Session{}
+	}
+
+	return &Export{
+		ExportedAt: time.Now().UTC(),
+		Account:    account,
+		Profile:    profile,
+		Orders:     orders,
+		Sessions:   sessions,
+	}, nil
+}
+
+// RequestDeletion проверяет пароль, назначает удаление аккаунта через GracePeriod
+// и возвращает дату удаления
+func (s *service) RequestDeletion(userID int, password string) (time.Time, error) {
+	if err := s.auth.VerifyPassword(userID, password); err != nil {
+		return time.Time{}, err
+	}
+	return s.users.ScheduleDeletion(userID, time.Now().Add(s.cfg.GracePeriod))
+}
+
+func (s *service) SendDeletionConfirmation(userID int) error {
+	return s.auth.SendDeletionConfirmation(userID)
+}
+
+// ConfirmDeletion гасит токен из письма и назначает удаление так же, как RequestDeletion
+func (s *service) ConfirmDeletion(userID int, token string) (time.Time, error) {
+	if err := s.auth.ConsumeDeletionConfirmation(userID, token); err != nil {
+		return time.Time{}, err
+	}
+	return s.users.ScheduleDeletion(userID, time.Now().Add(s.cfg.GracePeriod))
+}
+
+func (s *service) CancelDeletion(userID int) error {
+	return s.users.CancelDeletion(userID)
+}
+
+func (s *service) PurgeDueAccounts() (int, error) {
+	userIDs, err := s.users.ListDueDeletions(time.Now())
+	if err != nil {
+		return 0, err
+	}
+
+	deleted := 0
+	for _, userID := range userIDs {
+		account, err := s.users.GetAccount(userID)
+		if err != nil {
+			log.Printf("❌ Failed to load account %d before deletion: %v", userID, err)
+			continue
+		}
+		if account == nil {
+			continue
+		}
+
+		// Сначала гасим сессии: после удаления строки токены проверить будет не по чему
+		if err := s.auth.RevokeAllSessions(userID); err != nil {
+			log.Printf("❌ Failed to revoke sessions of user %d before deletion: %v", userID, err)
+			continue
+		}
+		// Журнал безопасности хранится дольше аккаунта, но без его IP, User-Agent и адресов.
+		// Если стереть не вышло, аккаунт остаётся до следующего запуска
+		if err := s.events.AnonymizeUser(userID, account.Email); err != nil {
+			log.Printf("❌ Failed to anonymize audit events of user %d: %v", userID, err)
+			continue
+		}
+		if err := s.users.DeleteUser(userID); err != nil && !errors.Is(err, user.ErrUserNotFound) {
+			log.Printf("❌ Failed to delete account %d: %v", userID, err)
+			continue
+		}
+
+		s.events.Record(audit.Event{Type: audit.AccountDeleted, UserID: userID})
+		log.Printf("🗑️ Account %d deleted after grace period, orders and audit events anonymized", userID)
+		deleted++
+	}
+
+	return deleted, nil
+}
+
+// RunPurge раз в interval удаляет аккаунты с истёкшим сроком. Запускается в отдельной горутине
+func RunPurge(s Service, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := s.PurgeDueAccounts(); err != nil {
+			log.Printf("❌ Account deletion run failed: %v", err)
+		}
+		<-ticker.C
+	}
+}
@@ -0,0 +1,147 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"auth-user-service/internal/redis"
+)
+
+// Rate - не больше Limit запросов за Window
+type Rate struct {
+	Limit  int
+	Window time.Duration
+}
+
+// Enabled - нулевой лимит отключает ограничение
+func (r Rate) Enabled() bool {
+	return r.Limit > 0 && r.Window > 0
+}
+
+func (r Rate) String() string {
+	return fmt.Sprintf("%d/%s", r.Limit, r.Window)
+}
+
+// ParseRate разбирает лимит вида "10/1h" или "100/1m". "0" отключает лимит
+func ParseRate(value string) (Rate, error) {
+	value = strings.TrimSpace(value)
+	if value == "0" {
+		return Rate{}, nil
+	}
+
+	limit, window, ok := strings.Cut(value, "/")
+	if !ok {
+		return Rate{}, fmt.Errorf("invalid rate %q, expected <limit>/<window>", value)
+	}
+
+	n, err := strconv.Atoi(limit)
+	if err != nil || n < 0 {
+		return Rate{}, fmt.Errorf("invalid rate limit %q", limit)
+	}
+	d, err := time.ParseDuration(window)
+	if err != nil || d <= 0 {
+		return Rate{}, fmt.Errorf("invalid rate window %q", window)
+	}
+
+	return Rate{Limit: n, Window: d}, nil
+}
+
+// Store считает запросы по ключу в скользящем окне
+type Store interface {
+	Allow(ctx context.Context, key string, rate Rate) (redis.RateLimit, error)
+}
+
+// NewStore возвращает хранилище в Redis, а если Redis не подключен - в памяти процесса.
+// Без Redis лимиты считаются отдельно на каждом инстансе
+func NewStore(redisClient *redis.Client) Store {
+	if redisClient == nil {
+		log.Println("⚠️ Redis unavailable: rate limits are counted in memory of this instance only")
+		return newMemoryStore()
+	}
+	return &redisStore{redis: redisClient}
+}
+
+type redisStore struct {
+	redis *redis.Client
+}
+
+func (s *redisStore) Allow(ctx context.Context, key string, rate Rate) (redis.RateLimit, error) {
+	return s.redis.SlidingWindow(ctx, "rate_limit:"+key, rate.Limit, rate.Window)
+}
+
+// memoryStore - то же скользящее окно на срезах меток времени
+type memoryStore struct {
+	mu      sync.Mutex
+	windows map[string]*memoryWindow
+	// lastCleanup - когда последний раз вычищались неактивные ключи
+	lastCleanup time.Time
+}
+
+type memoryWindow struct {
+	requests []time.Time
+	window   time.Duration
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{windows: make(map[string]*memoryWindow)}
+}
+
+func (s *memoryStore) Allow(_ context.Context, key string, rate Rate) (redis.RateLimit, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	s.cleanup(now)
+
+	w, ok := s.windows[key]
+	if !ok {
+		w = &memoryWindow{}
+		s.windows[key] = w
+	}
+	w.window = rate.Window
+	w.requests = trimWindow(w.requests, now.Add(-rate.Window))
+
+	allowed := len(w.requests) < rate.Limit
+	if allowed {
+		w.requests = append(w.requests, now)
+	}
+
+	resetAfter := rate.Window
+	if len(w.requests) > 0 {
+		resetAfter = w.requests[0].Add(rate.Window).Sub(now)
+	}
+
+	return redis.RateLimit{
+		Allowed:    allowed,
+		Remaining:  rate.Limit - len(w.requests),
+		ResetAfter: resetAfter,
+	}, nil
+}
+
+// trimWindow отбрасывает запросы старше since (срез упорядочен по времени)
+func trimWindow(requests []time.Time, since time.Time) []time.Time {
+	i := 0
+	for i < len(requests) && !requests[i].After(since) {
+		i++
+	}
+	return requests[i:]
+}
+
+// cleanup не чаще раза в минуту удаляет ключи без запросов в их окне. Вызывается под mu
+func (s *memoryStore) cleanup(now time.Time) {
+	if now.Sub(s.lastCleanup) < time.Minute {
+		return
+	}
+	s.lastCleanup = now
+
+	for key, w := range s.windows {
+		if len(w.requests) == 0 || now.Sub(w.requests[len(w.requests)-1]) > w.window {
+			delete(s.windows, key)
+		}
+	}
+}
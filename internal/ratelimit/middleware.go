@@ -0,0 +1,74 @@
+package ratelimit
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+)
+
+// KeyFunc определяет, чьи запросы считаются вместе
+type KeyFunc func(r *http.Request) string
+
+// ByIP - по адресу клиента (за прокси RemoteAddr подменяет middleware.RealIP)
+func ByIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "ip:" + host
+}
+
+// ByUser - по пользователю из токена (нужен AuthMiddleware раньше в цепочке),
+// для анонимных запросов - по IP
+func ByUser(r *http.Request) string {
+	if userID, ok := r.Context().Value("userID").(int); ok {
+		return fmt.Sprintf("user:%d", userID)
+	}
+	return ByIP(r)
+}
+
+type Limiter struct {
+	store Store
+}
+
+func NewLimiter(store Store) *Limiter {
+	return &Limiter{store: store}
+}
+
+// Limit ограничивает маршрут name лимитом rate на каждый ключ из key.
+// Ответы содержат X-RateLimit-Limit, X-RateLimit-Remaining и X-RateLimit-Reset (секунды),
+// при превышении - 429 с Retry-After. Если хранилище недоступно, запрос пропускается
+func (l *Limiter) Limit(name string, rate Rate, key KeyFunc) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if !rate.Enabled() {
+			return next
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			id := key(r)
+			res, err := l.store.Allow(r.Context(), name+":"+id, rate)
+			if err != nil {
+				log.Printf("⚠️ Rate limiter error on %s: %v", name, err)
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			resetSeconds := strconv.Itoa(int(math.Ceil(res.ResetAfter.Seconds())))
+			w.Header().Set("X-RateLimit-Limit", strconv.Itoa(rate.Limit))
+			w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(max(res.Remaining, 0)))
+			w.Header().Set("X-RateLimit-Reset", resetSeconds)
+
+			if !res.Allowed {
+				log.Printf("🚫 Rate limit %s exceeded on %s by %s", rate, name, id)
+				w.Header().Set("Retry-After", resetSeconds)
+				http.Error(w, `{"error": "Too many requests"}`, http.StatusTooManyRequests)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,194 @@
+package rbac
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"auth-user-service/internal/audit"
+	"auth-user-service/internal/auth"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// TokenInvalidator заставляет пользователя обновить access-токены,
+// чтобы изменённые роли сразу попали в новые токены
+type TokenInvalidator interface {
+	ExpireAccessTokens(userID int) error
+}
+
+type Handler struct {
+	service Service
+	tokens  TokenInvalidator
+	events  audit.Service
+}
+
+func NewHandler(service Service, tokens TokenInvalidator, events audit.Service) *Handler {
+	return &Handler{service: service, tokens: tokens, events: events}
+}
+
+type AssignRoleRequest struct {
+	Role string `json:"role"`
+}
+
+// RequirePermission пропускает только пользователей, чьи роли дают право permission,
+// и сервисные аккаунты с этим правом в scope. Роли и scope берутся из access-токена,
+// поэтому middleware ставится после AuthMiddleware
+func (h *Handler) RequirePermission(permission string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims, ok := auth.GetClaimsFromContext(r.Context())
+			if !ok {
+				http.Error(w, `{"error": "User not authenticated"}`, http.StatusUnauthorized)
+				return
+			}
+
+			// Стороннему OAuth-приложению права пользователя не передаются
+			if claims.ClientID != "" {
+				log.Printf("🚫 OAuth client %s denied %s", claims.ClientID, permission)
+				http.Error(w, `{"error": "Forbidden"}`, http.StatusForbidden)
+				return
+			}
+
+			// Сервисному аккаунту права выданы напрямую через scope, ролей у него нет
+			if claims.IsServiceAccount() {
+				if !hasScope(claims.Scope, permission) {
+					log.Printf("🚫 Service account %d denied %s", claims.ServiceAccountID, permission)
+					http.Error(w, `{"error": "Insufficient scope"}`, http.StatusForbidden)
+					return
+				}
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			allowed, err := h.service.HasPermission(claims.Roles, permission)
+			if err != nil {
+				log.Printf("❌ Permission check failed: %v", err)
+				http.Error(w, `{"error": "Failed to check permissions"}`, http.StatusInternalServerError)
+				return
+			}
+			if !allowed {
+				log.Printf("🚫 User %d denied %s", claims.UserID, permission)
+				http.Error(w, `{"error": "Forbidden"}`, http.StatusForbidden)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func (h *Handler) ListRoles(w http.ResponseWriter, r *http.Request) {
+	roles, err := h.service.ListRoles()
+	if err != nil {
+		http.Error(w, `{"error": "Failed to get roles"}`, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(roles)
+	if err != nil {
+		return
+	}
+}
+
+func (h *Handler) GetUserRoles(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, `{"error": "Invalid user ID"}`, http.StatusBadRequest)
+		return
+	}
+
+	h.writeUserRoles(w, userID)
+}
+
+func (h *Handler) AssignRole(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, `{"error": "Invalid user ID"}`, http.StatusBadRequest)
+		return
+	}
+
+	var req AssignRoleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Role == "" {
+		http.Error(w, `{"error": "Role is required"}`, http.StatusBadRequest)
+		return
+	}
+
+	err = h.service.AssignRole(userID, req.Role)
+	switch {
+	case errors.Is(err, ErrRoleNotFound):
+		http.Error(w, `{"error": "Role not found"}`, http.StatusNotFound)
+		return
+	case errors.Is(err, ErrUserNotFound):
+		http.Error(w, `{"error": "User not found"}`, http.StatusNotFound)
+		return
+	case err != nil:
+		http.Error(w, `{"error": "Failed to assign role"}`, http.StatusInternalServerError)
+		return
+	}
+
+	h.logRoleChange(r, "assigned", audit.AdminRoleAssigned, req.Role, userID)
+	h.writeUserRoles(w, userID)
+}
+
+func (h *Handler) RevokeRole(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, `{"error": "Invalid user ID"}`, http.StatusBadRequest)
+		return
+	}
+
+	role := chi.URLParam(r, "role")
+	if err := h.service.RevokeRole(userID, role); err != nil {
+		http.Error(w, `{"error": "Failed to revoke role"}`, http.StatusInternalServerError)
+		return
+	}
+
+	h.logRoleChange(r, "revoked", audit.AdminRoleRevoked, role, userID)
+	h.writeUserRoles(w, userID)
+}
+
+// logRoleChange логирует изменение ролей, пишет его в журнал безопасности
+// и сбрасывает access-токены пользователя
+func (h *Handler) logRoleChange(r *http.Request, action, eventType, role string, userID int) {
+	var adminID int
+	if claims, ok := auth.GetClaimsFromContext(r.Context()); ok {
+		adminID = claims.UserID
+	}
+	log.Printf("🛡️ User %d %s role %q for user %d", adminID, action, role, userID)
+	h.events.Record(audit.NewEvent(r, eventType, userID, audit.Metadata{"role": role}))
+
+	if err := h.tokens.ExpireAccessTokens(userID); err != nil {
+		log.Printf("⚠️ Failed to expire access tokens of user %d: %v", userID, err)
+	}
+}
+
+func (h *Handler) writeUserRoles(w http.ResponseWriter, userID int) {
+	roles, err := h.service.GetUserRoles(userID)
+	if err != nil {
+		http.Error(w, `{"error": "Failed to get roles"}`, http.StatusInternalServerError)
+		return
+	}
+	if roles == nil {
+		roles = []string{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(map[string]interface{}{"user_id": userID, "roles": roles})
+	if err != nil {
+		return
+	}
+}
+
+func hasScope(scope, permission string) bool {
+	for _, sc := range strings.Fields(scope) {
+		if sc == permission {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,164 @@
+package rbac
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+var (
+	ErrRoleNotFound = errors.New("role not found")
+	ErrUserNotFound = errors.New("user not found")
+)
+
+type Repository interface {
+	ListRoles() ([]Role, error)
+	GetUserRoles(userID int) ([]string, error)
+	AssignRole(userID int, role string) error
+	RevokeRole(userID int, role string) error
+	GetRolePermissions() (map[string][]string, error)
+}
+
+type repository struct {
+	db *sql.DB
+}
+
+func NewRepository(db *sql.DB) Repository {
+	return &repository{db: db}
+}
+
+type Role struct {
+	ID          int       `json:"id"`
+	Name        string    `json:"name"`
+	Description string    `json:"description,omitempty"`
+	Permissions []string  `json:"permissions"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+func (r *repository) ListRoles() ([]Role, error) {
+	rows, err := r.db.Query(
+		`SELECT r.id, r.name, COALESCE(r.description, ''), r.created_at,
+		        COALESCE(array_agg(p.name ORDER BY p.name) FILTER (WHERE p.name IS NOT NULL), '{}')
+		 FROM roles r
+		 LEFT JOIN role_permissions rp ON rp.role_id = r.id
+		 LEFT JOIN permissions p ON p.id = rp.permission_id
+		 GROUP BY r.id
+		 ORDER BY r.name`,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer func(rows *sql.Rows) {
+		_ = rows.Close()
+	}(rows)
+
+	roles := []Role{}
+	for rows.Next() {
+		var role Role
+		if err := rows.Scan(&role.ID, &role.Name, &role.Description, &role.CreatedAt, pq.Array(&role.Permissions)); err != nil {
+			return nil, err
+		}
+		roles = append(roles, role)
+	}
+
+	return roles, rows.Err()
+}
+
+func (r *repository) GetUserRoles(userID int) ([]string, error) {
+	rows, err := r.db.Query(
+		`SELECT r.name
+		 FROM user_roles ur
+		 JOIN roles r ON r.id = ur.role_id
+		 WHERE ur.user_id = $1
+		 ORDER BY r.name`,
+		userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer func(rows *sql.Rows) {
+		_ = rows.Close()
+	}(rows)
+
+	var roles []string
+	for rows.Next() {
+		var role string
+		if err := rows.Scan(&role); err != nil {
+			return nil, err
+		}
+		roles = append(roles, role)
+	}
+
+	return roles, rows.Err()
+}
+
+func (r *repository) AssignRole(userID int, role string) error {
+	res, err := r.db.Exec(
+		`INSERT INTO user_roles (user_id, role_id)
+		 SELECT $1, id FROM roles WHERE name = $2
+		 ON CONFLICT DO NOTHING`,
+		userID, role,
+	)
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23503" {
+		return ErrUserNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		// Либо роли нет, либо она уже назначена
+		var exists bool
+		if err := r.db.QueryRow("SELECT EXISTS(SELECT 1 FROM roles WHERE name = $1)", role).Scan(&exists); err != nil {
+			return err
+		}
+		if !exists {
+			return ErrRoleNotFound
+		}
+	}
+
+	return nil
+}
+
+func (r *repository) RevokeRole(userID int, role string) error {
+	_, err := r.db.Exec(
+		`DELETE FROM user_roles
+		 WHERE user_id = $1 AND role_id = (SELECT id FROM roles WHERE name = $2)`,
+		userID, role,
+	)
+	return err
+}
+
+// GetRolePermissions возвращает права всех ролей: роль -> список прав
+func (r *repository) GetRolePermissions() (map[string][]string, error) {
+	rows, err := r.db.Query(
+		`SELECT r.name, p.name
+		 FROM role_permissions rp
+		 JOIN roles r ON r.id = rp.role_id
+		 JOIN permissions p ON p.id = rp.permission_id`,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer func(rows *sql.Rows) {
+		_ = rows.Close()
+	}(rows)
+
+	perms := make(map[string][]string)
+	for rows.Next() {
+		var role, perm string
+		if err := rows.Scan(&role, &perm); err != nil {
+			return nil, err
+		}
+		perms[role] = append(perms[role], perm)
+	}
+
+	return perms, rows.Err()
+}
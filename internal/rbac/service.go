@@ -0,0 +1,91 @@
+package rbac
+
+import (
+	"sync"
+	"time"
+)
+
+// permissionsCacheTTL - как долго держим в памяти соответствие ролей и прав
+const permissionsCacheTTL = time.Minute
+
+type Service interface {
+	ListRoles() ([]Role, error)
+	GetUserRoles(userID int) ([]string, error)
+	AssignRole(userID int, role string) error
+	RevokeRole(userID int, role string) error
+	HasPermission(roles []string, permission string) (bool, error)
+}
+
+type service struct {
+	repo Repository
+
+	mu          sync.Mutex
+	permissions map[string]map[string]bool
+	loadedAt    time.Time
+}
+
+func NewService(repo Repository) Service {
+	return &service{repo: repo}
+}
+
+func (s *service) ListRoles() ([]Role, error) {
+	return s.repo.ListRoles()
+}
+
+func (s *service) GetUserRoles(userID int) ([]string, error) {
+	return s.repo.GetUserRoles(userID)
+}
+
+func (s *service) AssignRole(userID int, role string) error {
+	return s.repo.AssignRole(userID, role)
+}
+
+func (s *service) RevokeRole(userID int, role string) error {
+	return s.repo.RevokeRole(userID, role)
+}
+
+// HasPermission проверяет, даёт ли хотя бы одна из ролей указанное право
+func (s *service) HasPermission(roles []string, permission string) (bool, error) {
+	if len(roles) == 0 {
+		return false, nil
+	}
+
+	perms, err := s.rolePermissions()
+	if err != nil {
+		return false, err
+	}
+
+	for _, role := range roles {
+		if perms[role][permission] {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// rolePermissions возвращает закэшированную карту роль -> права
+func (s *service) rolePermissions() (map[string]map[string]bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.permissions != nil && time.Since(s.loadedAt) < permissionsCacheTTL {
+		return s.permissions, nil
+	}
+
+	raw, err := s.repo.GetRolePermissions()
+	if err != nil {
+		return nil, err
+	}
+
+	perms := make(map[string]map[string]bool, len(raw))
+	for role, list := range raw {
+		perms[role] = make(map[string]bool, len(list))
+		for _, p := range list {
+			perms[role][p] = true
+		}
+	}
+
+	s.permissions = perms
+	s.loadedAt = time.Now()
+	return perms, nil
+}
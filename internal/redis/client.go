@@ -3,12 +3,16 @@ package redis
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"time"
 
 	"github.com/redis/go-redis/v9"
 )
 
+// ErrNotFound возвращается из Get, если ключа нет
+var ErrNotFound = errors.New("redis: key not found")
+
 type Client struct {
 	client *redis.Client
 }
@@ -42,6 +46,21 @@ func (c *Client) Set(ctx context.Context, key string, value interface{}, expirat
 
 func (c *Client) Get(ctx context.Context, key string, dest interface{}) error {
 	val, err := c.client.Get(ctx, key).Result()
+	if errors.Is(err, redis.Nil) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal([]byte(val), dest)
+}
+
+// Take читает значение и удаляет ключ одной командой: одноразовые записи нельзя прочитать дважды
+func (c *Client) Take(ctx context.Context, key string, dest interface{}) error {
+	val, err := c.client.GetDel(ctx, key).Result()
+	if errors.Is(err, redis.Nil) {
+		return ErrNotFound
+	}
 	if err != nil {
 		return err
 	}
@@ -52,6 +71,38 @@ func (c *Client) Delete(ctx context.Context, key string) error {
 	return c.client.Del(ctx, key).Err()
 }
 
+func (c *Client) Exists(ctx context.Context, key string) (bool, error) {
+	n, err := c.client.Exists(ctx, key).Result()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+// Incr атомарно увеличивает счётчик. Срок жизни ставится при создании ключа,
+// поэтому счётчик считает события в окне от первого из них
+func (c *Client) Incr(ctx context.Context, key string, window time.Duration) (int64, error) {
+	pipe := c.client.TxPipeline()
+	incr := pipe.Incr(ctx, key)
+	pipe.ExpireNX(ctx, key, window)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, err
+	}
+	return incr.Val(), nil
+}
+
+// TTL возвращает оставшееся время жизни ключа, 0 если ключа нет или срок не задан
+func (c *Client) TTL(ctx context.Context, key string) (time.Duration, error) {
+	ttl, err := c.client.PTTL(ctx, key).Result()
+	if err != nil {
+		return 0, err
+	}
+	if ttl < 0 {
+		return 0, nil
+	}
+	return ttl, nil
+}
+
 func (c *Client) Close() error {
 	return c.client.Close()
 }
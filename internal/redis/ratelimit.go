@@ -0,0 +1,68 @@
+package redis
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// RateLimit - результат проверки лимита запросов
+type RateLimit struct {
+	Allowed   bool
+	Remaining int
+	// ResetAfter - через сколько освободится место в окне
+	ResetAfter time.Duration
+}
+
+// slidingWindowScript - скользящее окно на sorted set: каждый запрос хранится
+// с меткой времени, старые записи вычищаются перед подсчётом.
+// Скрипт выполняется атомарно, поэтому параллельные запросы не превысят лимит
+var slidingWindowScript = redis.NewScript(`
+local key = KEYS[1]
+local now = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+local limit = tonumber(ARGV[3])
+
+redis.call('ZREMRANGEBYSCORE', key, 0, now - window)
+local count = redis.call('ZCARD', key)
+local allowed = 0
+if count < limit then
+	redis.call('ZADD', key, now, ARGV[4])
+	count = count + 1
+	allowed = 1
+end
+redis.call('PEXPIRE', key, window)
+
+local reset = window
+local oldest = redis.call('ZRANGE', key, 0, 0, 'WITHSCORES')
+if oldest[2] then
+	reset = tonumber(oldest[2]) + window - now
+end
+
+return {allowed, limit - count, reset}
+`)
+
+// SlidingWindow учитывает запрос в окне window и проверяет, не превышен ли limit.
+// Отклонённые запросы в окно не записываются
+func (c *Client) SlidingWindow(ctx context.Context, key string, limit int, window time.Duration) (RateLimit, error) {
+	member := make([]byte, 8)
+	if _, err := rand.Read(member); err != nil {
+		return RateLimit{}, err
+	}
+
+	res, err := slidingWindowScript.Run(ctx, c.client, []string{key},
+		time.Now().UnixMilli(), window.Milliseconds(), limit, hex.EncodeToString(member),
+	).Int64Slice()
+	if err != nil {
+		return RateLimit{}, err
+	}
+
+	return RateLimit{
+		Allowed:    res[0] == 1,
+		Remaining:  int(res[1]),
+		ResetAfter: time.Duration(res[2]) * time.Millisecond,
+	}, nil
+}
@@ -0,0 +1,163 @@
+package sms
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"auth-user-service/internal/ratelimit"
+)
+
+var (
+	ErrCodeInvalid     = errors.New("invalid or expired code")
+	ErrTooManyRequests = errors.New("too many codes requested")
+)
+
+// ThrottledError сообщает, через сколько можно запросить новый код
+type ThrottledError struct {
+	RetryAfter time.Duration
+}
+
+func (e *ThrottledError) Error() string {
+	return fmt.Sprintf("%s, retry after %s", ErrTooManyRequests, e.RetryAfter)
+}
+
+func (e *ThrottledError) Unwrap() error {
+	return ErrTooManyRequests
+}
+
+// Config - параметры одноразовых кодов
+type Config struct {
+	CodeTTL    time.Duration
+	CodeLength int
+	// MaxAttempts - неверных вводов, после которых код сгорает
+	MaxAttempts int
+	// ResendInterval - пауза между SMS на один номер
+	ResendInterval time.Duration
+	// SendRate - сколько SMS можно отправить на один номер за окно
+	SendRate ratelimit.Rate
+}
+
+// OTP выдаёт и проверяет одноразовые коды из SMS
+type OTP struct {
+	sender Sender
+	codes  CodeStore
+	limits ratelimit.Store
+	cfg    Config
+}
+
+func NewOTP(sender Sender, codes CodeStore, limits ratelimit.Store, cfg Config) *OTP {
+	if cfg.CodeTTL <= 0 {
+		cfg.CodeTTL = 5 * time.Minute
+	}
+	if cfg.CodeLength <= 0 {
+		cfg.CodeLength = 6
+	}
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = 5
+	}
+	return &OTP{sender: sender, codes: codes, limits: limits, cfg: cfg}
+}
+
+// Send отправляет новый код на номер. purpose разделяет коды разных действий:
+// код подтверждения номера не подойдёт для входа. text - шаблон с %s на месте кода
+func (o *OTP) Send(ctx context.Context, purpose, phone, text string) error {
+	if err := o.throttle(ctx, phone); err != nil {
+		return err
+	}
+
+	code, err := generateCode(o.cfg.CodeLength)
+	if err != nil {
+		return err
+	}
+
+	id := codeID(purpose, phone)
+	if err := o.codes.Save(ctx, id, hashCode(id, code), o.cfg.CodeTTL); err != nil {
+		return err
+	}
+	return o.sender.Send(ctx, phone, fmt.Sprintf(text, code))
+}
+
+// Verify проверяет и гасит код. После MaxAttempts неверных вводов код сгорает
+func (o *OTP) Verify(ctx context.Context, purpose, phone, code string) error {
+	id := codeID(purpose, phone)
+	codeHash, err := o.codes.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+	if codeHash == "" {
+		return ErrCodeInvalid
+	}
+
+	if subtle.ConstantTimeCompare([]byte(codeHash), []byte(hashCode(id, code))) != 1 {
+		failures, err := o.codes.RegisterFailure(ctx, id, o.cfg.CodeTTL)
+		if err != nil {
+			return err
+		}
+		if failures >= o.cfg.MaxAttempts {
+			if err := o.codes.Delete(ctx, id); err != nil {
+				return err
+			}
+		}
+		return ErrCodeInvalid
+	}
+
+	return o.codes.Delete(ctx, id)
+}
+
+// TTL - срок действия кода, чтобы сообщить его клиенту
+func (o *OTP) TTL() time.Duration {
+	return o.cfg.CodeTTL
+}
+
+// throttle ограничивает SMS на один номер, чтобы через сервис нельзя было
+// засыпать чужой телефон сообщениями или потратить бюджет на рассылку
+func (o *OTP) throttle(ctx context.Context, phone string) error {
+	limits := []struct {
+		key  string
+		rate ratelimit.Rate
+	}{
+		{"sms_resend:" + phone, ratelimit.Rate{Limit: 1, Window: o.cfg.ResendInterval}},
+		{"sms_send:" + phone, o.cfg.SendRate},
+	}
+	for _, limit := range limits {
+		if !limit.rate.Enabled() {
+			continue
+		}
+		res, err := o.limits.Allow(ctx, limit.key, limit.rate)
+		if err != nil {
+			return err
+		}
+		if !res.Allowed {
+			return &ThrottledError{RetryAfter: res.ResetAfter}
+		}
+	}
+	return nil
+}
+
+func codeID(purpose, phone string) string {
+	return purpose + ":" + phone
+}
+
+// hashCode - хэш кода для хранения. Код короткий, поэтому хэш защищает только от
+// чтения кодов из Redis напрямую, а от перебора защищает MaxAttempts
+func hashCode(id, code string) string {
+	sum := sha256.Sum256([]byte(id + ":" + code))
+	return hex.EncodeToString(sum[:])
+}
+
+// generateCode - случайный код из цифр, с ведущими нулями
+func generateCode(length int) (string, error) {
+	upper := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(length)), nil)
+	n, err := rand.Int(rand.Reader, upper)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%0*d", length, n), nil
+}
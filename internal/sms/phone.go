@@ -0,0 +1,45 @@
+package sms
+
+import (
+	"errors"
+	"strings"
+)
+
+var ErrInvalidPhone = errors.New("invalid phone number")
+
+// NormalizePhone приводит номер к E.164: "+7 (999) 123-45-67" и "8 999 123 45 67"
+// становятся "+79991234567". Номер без "+" из 11 цифр на 8 или 7 считается российским,
+// из 10 цифр на 9 - российским мобильным без кода страны
+func NormalizePhone(phone string) (string, error) {
+	phone = strings.TrimSpace(phone)
+	international := strings.HasPrefix(phone, "+")
+
+	var digits strings.Builder
+	for i, r := range phone {
+		switch {
+		case r >= '0' && r <= '9':
+			digits.WriteRune(r)
+		case r == '+' && i == 0, r == ' ', r == '-', r == '(', r == ')', r == '.':
+		default:
+			return "", ErrInvalidPhone
+		}
+	}
+	number := digits.String()
+
+	if !international {
+		switch {
+		case len(number) == 11 && (number[0] == '8' || number[0] == '7'):
+			number = "7" + number[1:]
+		case len(number) == 10 && number[0] == '9':
+			number = "7" + number
+		default:
+			return "", ErrInvalidPhone
+		}
+	}
+
+	// E.164: код страны не начинается с 0, всего не больше 15 цифр
+	if len(number) < 8 || len(number) > 15 || number[0] == '0' {
+		return "", ErrInvalidPhone
+	}
+	return "+" + number, nil
+}
@@ -0,0 +1,53 @@
+package sms
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// Sender доставляет SMS. Номер уже нормализован (E.164, "+79991234567")
+type Sender interface {
+	Send(ctx context.Context, phone, text string) error
+}
+
+// LogSender пишет SMS в лог. Используется, пока не подключен реальный провайдер
+type LogSender struct{}
+
+func NewLogSender() *LogSender {
+	return &LogSender{}
+}
+
+func (s *LogSender) Send(_ context.Context, phone, text string) error {
+	log.Printf("📱 SMS to %s: %s", phone, text)
+	return nil
+}
+
+// FileSender дописывает SMS в файл - удобно для тестовых стендов и e2e-тестов
+type FileSender struct {
+	mu   sync.Mutex
+	path string
+}
+
+func NewFileSender(path string) *FileSender {
+	return &FileSender{path: path}
+}
+
+func (s *FileSender) Send(_ context.Context, phone, text string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	f, err := os.OpenFile(s.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	defer func(f *os.File) {
+		_ = f.Close()
+	}(f)
+
+	_, err = fmt.Fprintf(f, "%s\t%s\t%s\n", time.Now().Format(time.RFC3339), phone, text)
+	return err
+}
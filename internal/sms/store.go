@@ -0,0 +1,131 @@
+package sms
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"auth-user-service/internal/redis"
+)
+
+// CodeStore хранит хэши выданных кодов и счётчики неверных попыток.
+// id - назначение кода и номер, например "login:+79991234567"
+type CodeStore interface {
+	// Save заменяет прежний код и обнуляет счётчик попыток
+	Save(ctx context.Context, id, codeHash string, ttl time.Duration) error
+	// Get возвращает хэш кода, "" если кода нет или он истёк
+	Get(ctx context.Context, id string) (string, error)
+	// RegisterFailure увеличивает счётчик неверных попыток и возвращает его новое значение
+	RegisterFailure(ctx context.Context, id string, ttl time.Duration) (int, error)
+	Delete(ctx context.Context, id string) error
+}
+
+// NewCodeStore возвращает хранилище в Redis, а без Redis - в памяти процесса
+func NewCodeStore(redisClient *redis.Client) CodeStore {
+	if redisClient == nil {
+		log.Println("⚠️ Redis unavailable: SMS codes are kept in memory of this instance only")
+		return &memoryCodeStore{codes: make(map[string]memoryCode)}
+	}
+	return &redisCodeStore{redis: redisClient}
+}
+
+type redisCodeStore struct {
+	redis *redis.Client
+}
+
+func codeKey(id string) string {
+	return fmt.Sprintf("sms_otp:%s", id)
+}
+
+func codeFailuresKey(id string) string {
+	return fmt.Sprintf("sms_otp_failures:%s", id)
+}
+
+func (s *redisCodeStore) Save(ctx context.Context, id, codeHash string, ttl time.Duration) error {
+	if err := s.redis.Set(ctx, codeKey(id), codeHash, ttl); err != nil {
+		return err
+	}
+	return s.redis.Delete(ctx, codeFailuresKey(id))
+}
+
+func (s *redisCodeStore) Get(ctx context.Context, id string) (string, error) {
+	var codeHash string
+	err := s.redis.Get(ctx, codeKey(id), &codeHash)
+	if errors.Is(err, redis.ErrNotFound) {
+		return "", nil
+	}
+	return codeHash, err
+}
+
+func (s *redisCodeStore) RegisterFailure(ctx context.Context, id string, ttl time.Duration) (int, error) {
+	n, err := s.redis.Incr(ctx, codeFailuresKey(id), ttl)
+	return int(n), err
+}
+
+func (s *redisCodeStore) Delete(ctx context.Context, id string) error {
+	if err := s.redis.Delete(ctx, codeKey(id)); err != nil {
+		return err
+	}
+	return s.redis.Delete(ctx, codeFailuresKey(id))
+}
+
+type memoryCodeStore struct {
+	mu    sync.Mutex
+	codes map[string]memoryCode
+}
+
+type memoryCode struct {
+	hash      string
+	failures  int
+	expiresAt time.Time
+}
+
+func (s *memoryCodeStore) Save(_ context.Context, id, codeHash string, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for key, c := range s.codes {
+		if now.After(c.expiresAt) {
+			delete(s.codes, key)
+		}
+	}
+	s.codes[id] = memoryCode{hash: codeHash, expiresAt: now.Add(ttl)}
+	return nil
+}
+
+func (s *memoryCodeStore) Get(_ context.Context, id string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c, ok := s.codes[id]
+	if !ok || time.Now().After(c.expiresAt) {
+		return "", nil
+	}
+	return c.hash, nil
+}
+
+// RegisterFailure без кода ничего не считает: пробовать уже нечего
+func (s *memoryCodeStore) RegisterFailure(_ context.Context, id string, _ time.Duration) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c, ok := s.codes[id]
+	if !ok {
+		return 0, nil
+	}
+	c.failures++
+	s.codes[id] = c
+	return c.failures, nil
+}
+
+func (s *memoryCodeStore) Delete(_ context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.codes, id)
+	return nil
+}
@@ -0,0 +1,139 @@
+package social
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"sort"
+	"time"
+)
+
+var (
+	ErrUnknownProvider = errors.New("unknown login provider")
+	ErrInvalidState    = errors.New("invalid or expired oauth state")
+)
+
+// Login - результат возврата от провайдера
+type Login struct {
+	Identity *Identity
+	// LinkUserID - если не 0, аккаунт провайдера привязывается к этому пользователю
+	LinkUserID int
+}
+
+// Client - вход через внешних провайдеров: state, nonce и PKCE для каждого входа
+type Client struct {
+	providers map[string]*Provider
+	states    StateStore
+	// stateTTL - сколько пользователь может пробыть на странице провайдера
+	stateTTL time.Duration
+}
+
+func NewClient(providers []*Provider, states StateStore, stateTTL time.Duration) *Client {
+	c := &Client{
+		providers: make(map[string]*Provider, len(providers)),
+		states:    states,
+		stateTTL:  stateTTL,
+	}
+	for _, p := range providers {
+		c.providers[p.Name()] = p
+	}
+	return c
+}
+
+// Providers - имена подключённых провайдеров
+func (c *Client) Providers() []string {
+	names := make([]string, 0, len(c.providers))
+	for name := range c.providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Authorization - начатый вход: адрес страницы провайдера и state, который нужно
+// привязать к браузеру пользователя, чтобы callback не приняли из чужого браузера
+type Authorization struct {
+	URL       string
+	State     string
+	ExpiresIn time.Duration
+}
+
+// AuthURL начинает вход (linkUserID == 0) или привязку аккаунта провайдера
+// и возвращает адрес, на который нужно отправить браузер
+func (c *Client) AuthURL(ctx context.Context, provider string, linkUserID int) (*Authorization, error) {
+	p, ok := c.providers[provider]
+	if !ok {
+		return nil, ErrUnknownProvider
+	}
+
+	state, err := randomString()
+	if err != nil {
+		return nil, err
+	}
+	nonce, err := randomString()
+	if err != nil {
+		return nil, err
+	}
+	verifier, err := randomString()
+	if err != nil {
+		return nil, err
+	}
+
+	authURL, err := p.AuthCodeURL(ctx, state, nonce, codeChallenge(verifier))
+	if err != nil {
+		return nil, err
+	}
+
+	flow := &Flow{
+		Provider:     provider,
+		Nonce:        nonce,
+		CodeVerifier: verifier,
+		LinkUserID:   linkUserID,
+	}
+	if err := c.states.Save(ctx, state, flow, c.stateTTL); err != nil {
+		return nil, err
+	}
+	return &Authorization{URL: authURL, State: state, ExpiresIn: c.stateTTL}, nil
+}
+
+// Complete проверяет state и обменивает код авторизации на данные пользователя
+func (c *Client) Complete(ctx context.Context, provider, code, state string) (*Login, error) {
+	p, ok := c.providers[provider]
+	if !ok {
+		return nil, ErrUnknownProvider
+	}
+	if state == "" || code == "" {
+		return nil, ErrInvalidState
+	}
+
+	flow, err := c.states.Take(ctx, state)
+	if err != nil {
+		return nil, err
+	}
+	// state, выданный для другого провайдера, тоже недействителен
+	if flow == nil || flow.Provider != provider {
+		return nil, ErrInvalidState
+	}
+
+	identity, err := p.Exchange(ctx, code, flow.CodeVerifier, flow.Nonce)
+	if err != nil {
+		return nil, err
+	}
+	return &Login{Identity: identity, LinkUserID: flow.LinkUserID}, nil
+}
+
+func randomString() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// codeChallenge - PKCE S256 (RFC 7636)
+func codeChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
@@ -0,0 +1,419 @@
+package social
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// mockIssuer - локальный OIDC-провайдер: discovery, JWKS и token endpoint с проверкой PKCE
+type mockIssuer struct {
+	t      *testing.T
+	server *httptest.Server
+	key    *ecdsa.PrivateKey
+
+	mu    sync.Mutex
+	codes map[string]mockGrant
+	// idToken позволяет тесту испортить claims или подпись выдаваемого ID token
+	idToken func(claims jwt.MapClaims) (jwt.MapClaims, *ecdsa.PrivateKey)
+}
+
+type mockGrant struct {
+	challenge string
+	nonce     string
+}
+
+const (
+	mockClientID    = "test-client"
+	mockRedirectURL = "http://localhost:3000/oauth/callback/mock"
+	mockSubject     = "user-42"
+)
+
+func newMockIssuer(t *testing.T) *mockIssuer {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := &mockIssuer{t: t, key: key, codes: make(map[string]mockGrant)}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", m.discovery)
+	mux.HandleFunc("/jwks", m.jwks)
+	mux.HandleFunc("/token", m.token)
+	m.server = httptest.NewServer(mux)
+	t.Cleanup(m.server.Close)
+	return m
+}
+
+func (m *mockIssuer) issuer() string {
+	return m.server.URL
+}
+
+func (m *mockIssuer) discovery(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{
+		"issuer":                 m.issuer(),
+		"authorization_endpoint": m.issuer() + "/authorize",
+		"token_endpoint":         m.issuer() + "/token",
+		"jwks_uri":               m.issuer() + "/jwks",
+	})
+}
+
+func (m *mockIssuer) jwks(w http.ResponseWriter, _ *http.Request) {
+	public := m.key.PublicKey
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"keys": []map[string]string{{
+			"kty": "EC",
+			"kid": "mock-key",
+			"use": "sig",
+			"alg": "ES256",
+			"crv": "P-256",
+			"x":   base64.RawURLEncoding.EncodeToString(public.X.FillBytes(make([]byte, 32))),
+			"y":   base64.RawURLEncoding.EncodeToString(public.Y.FillBytes(make([]byte, 32))),
+		}},
+	})
+}
+
+// authorize - то, что провайдер делает, когда пользователь разрешил вход: запоминает
+// code_challenge и nonce из адреса страницы входа и выдаёт код
+func (m *mockIssuer) authorize(authURL string) (code, state string) {
+	m.t.Helper()
+
+	u, err := url.Parse(authURL)
+	if err != nil {
+		m.t.Fatal(err)
+	}
+	query := u.Query()
+	if got := query.Get("code_challenge_method"); got != "S256" {
+		m.t.Fatalf("code_challenge_method = %q, want S256", got)
+	}
+	if query.Get("client_id") != mockClientID || query.Get("redirect_uri") != mockRedirectURL {
+		m.t.Fatalf("unexpected client in authorization request: %s", u.RawQuery)
+	}
+
+	code = randomTestString(m.t)
+	m.mu.Lock()
+	m.codes[code] = mockGrant{challenge: query.Get("code_challenge"), nonce: query.Get("nonce")}
+	m.mu.Unlock()
+	return code, query.Get("state")
+}
+
+func (m *mockIssuer) token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_request"})
+		return
+	}
+
+	m.mu.Lock()
+	grant, ok := m.codes[r.PostForm.Get("code")]
+	delete(m.codes, r.PostForm.Get("code"))
+	m.mu.Unlock()
+
+	if !ok || r.PostForm.Get("client_id") != mockClientID || r.PostForm.Get("redirect_uri") != mockRedirectURL {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	}
+	if codeChallenge(r.PostForm.Get("code_verifier")) != grant.challenge {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant", "error_description": "PKCE verification failed"})
+		return
+	}
+
+	claims := jwt.MapClaims{
+		"iss":            m.issuer(),
+		"aud":            mockClientID,
+		"sub":            mockSubject,
+		"email":          "user@example.com",
+		"email_verified": true,
+		"given_name":     "Иван",
+		"family_name":    "Петров",
+		"nonce":          grant.nonce,
+		"iat":            time.Now().Unix(),
+		"exp":            time.Now().Add(5 * time.Minute).Unix(),
+	}
+	key := m.key
+	if m.idToken != nil {
+		claims, key = m.idToken(claims)
+	}
+
+	idToken := jwt.NewWithClaims(jwt.SigningMethodES256, claims)
+	idToken.Header["kid"] = "mock-key"
+	signed, err := idToken.SignedString(key)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{
+		"access_token": "mock-access-token",
+		"token_type":   "Bearer",
+		"id_token":     signed,
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+func randomTestString(t *testing.T) string {
+	t.Helper()
+	s, err := randomString()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func newTestClient(t *testing.T, m *mockIssuer) *Client {
+	t.Helper()
+
+	provider, err := NewProvider(ProviderConfig{
+		Name:        "mock",
+		ClientID:    mockClientID,
+		RedirectURL: mockRedirectURL,
+		Scopes:      []string{"openid", "email", "profile"},
+		Issuer:      m.issuer(),
+	}, m.server.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewClient([]*Provider{provider}, NewStateStore(nil), time.Minute)
+}
+
+func TestCompleteLogin(t *testing.T) {
+	m := newMockIssuer(t)
+	client := newTestClient(t, m)
+	ctx := context.Background()
+
+	authorization, err := client.AuthURL(ctx, "mock", 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, state := m.authorize(authorization.URL)
+	if state != authorization.State {
+		t.Fatalf("state in URL = %q, want %q", state, authorization.State)
+	}
+
+	login, err := client.Complete(ctx, "mock", code, state)
+	if err != nil {
+		t.Fatalf("Complete: %v", err)
+	}
+	if login.LinkUserID != 7 {
+		t.Errorf("LinkUserID = %d, want 7", login.LinkUserID)
+	}
+	want := Identity{
+		Provider:      "mock",
+		Subject:       mockSubject,
+		Email:         "user@example.com",
+		EmailVerified: true,
+		FirstName:     "Иван",
+		LastName:      "Петров",
+	}
+	if *login.Identity != want {
+		t.Errorf("Identity = %+v, want %+v", *login.Identity, want)
+	}
+
+	// state одноразовый
+	if _, err := client.Complete(ctx, "mock", code, state); !errors.Is(err, ErrInvalidState) {
+		t.Errorf("reused state: err = %v, want ErrInvalidState", err)
+	}
+}
+
+func TestCompleteRejectsInvalidState(t *testing.T) {
+	m := newMockIssuer(t)
+	client := newTestClient(t, m)
+	ctx := context.Background()
+
+	authorization, err := client.AuthURL(ctx, "mock", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, _ := m.authorize(authorization.URL)
+
+	for name, state := range map[string]string{
+		"empty":   "",
+		"unknown": randomTestString(t),
+	} {
+		if _, err := client.Complete(ctx, "mock", code, state); !errors.Is(err, ErrInvalidState) {
+			t.Errorf("%s state: err = %v, want ErrInvalidState", name, err)
+		}
+	}
+
+	// state другого провайдера
+	if err := client.states.Save(ctx, "foreign", &Flow{Provider: "google"}, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Complete(ctx, "mock", code, "foreign"); !errors.Is(err, ErrInvalidState) {
+		t.Errorf("foreign provider state: err = %v, want ErrInvalidState", err)
+	}
+}
+
+func TestExchangeRequiresPKCEVerifier(t *testing.T) {
+	m := newMockIssuer(t)
+	client := newTestClient(t, m)
+	ctx := context.Background()
+
+	authorization, err := client.AuthURL(ctx, "mock", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, state := m.authorize(authorization.URL)
+	flow, err := client.states.Take(ctx, state)
+	if err != nil || flow == nil {
+		t.Fatalf("flow not saved: %v", err)
+	}
+
+	if _, err := client.providers["mock"].Exchange(ctx, code, randomTestString(t), flow.Nonce); err == nil {
+		t.Fatal("Exchange with a wrong code_verifier succeeded")
+	}
+}
+
+func TestExchangeValidatesIDToken(t *testing.T) {
+	foreignKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		tamper func(m *mockIssuer, claims jwt.MapClaims) (jwt.MapClaims, *ecdsa.PrivateKey)
+	}{
+		{"nonce mismatch", func(m *mockIssuer, claims jwt.MapClaims) (jwt.MapClaims, *ecdsa.PrivateKey) {
+			claims["nonce"] = "other-nonce"
+			return claims, m.key
+		}},
+		{"missing nonce", func(m *mockIssuer, claims jwt.MapClaims) (jwt.MapClaims, *ecdsa.PrivateKey) {
+			delete(claims, "nonce")
+			return claims, m.key
+		}},
+		{"wrong audience", func(m *mockIssuer, claims jwt.MapClaims) (jwt.MapClaims, *ecdsa.PrivateKey) {
+			claims["aud"] = "other-client"
+			return claims, m.key
+		}},
+		{"wrong issuer", func(m *mockIssuer, claims jwt.MapClaims) (jwt.MapClaims, *ecdsa.PrivateKey) {
+			claims["iss"] = "https://evil.example.com"
+			return claims, m.key
+		}},
+		{"expired", func(m *mockIssuer, claims jwt.MapClaims) (jwt.MapClaims, *ecdsa.PrivateKey) {
+			claims["exp"] = time.Now().Add(-time.Hour).Unix()
+			return claims, m.key
+		}},
+		{"missing expiry", func(m *mockIssuer, claims jwt.MapClaims) (jwt.MapClaims, *ecdsa.PrivateKey) {
+			delete(claims, "exp")
+			return claims, m.key
+		}},
+		{"foreign signing key", func(_ *mockIssuer, claims jwt.MapClaims) (jwt.MapClaims, *ecdsa.PrivateKey) {
+			return claims, foreignKey
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newMockIssuer(t)
+			m.idToken = func(claims jwt.MapClaims) (jwt.MapClaims, *ecdsa.PrivateKey) {
+				return tt.tamper(m, claims)
+			}
+			client := newTestClient(t, m)
+			ctx := context.Background()
+
+			authorization, err := client.AuthURL(ctx, "mock", 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			code, state := m.authorize(authorization.URL)
+
+			if login, err := client.Complete(ctx, "mock", code, state); err == nil {
+				t.Fatalf("Complete succeeded with %s: %+v", tt.name, login.Identity)
+			}
+		})
+	}
+}
+
+func TestLookup(t *testing.T) {
+	// Как в doJSON: числа остаются json.Number
+	decoder := json.NewDecoder(strings.NewReader(`{"response": [{"id": 1234, "first_name": "Иван"}], "email": "user@example.com", "ok": true}`))
+	decoder.UseNumber()
+	var data map[string]interface{}
+	if err := decoder.Decode(&data); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string]string{
+		"response.0.id":         "1234",
+		"response.0.first_name": "Иван",
+		"response.1.id":         "",
+		"response.x.id":         "",
+		"email":                 "user@example.com",
+		"ok":                    "true",
+		"missing.field":         "",
+	}
+	for path, want := range tests {
+		if got := lookup(data, path); got != want {
+			t.Errorf("lookup(%q) = %q, want %q", path, got, want)
+		}
+	}
+}
+
+// VK: email приходит в ответе token endpoint, данные пользователя - массивом в users.get
+func TestExchangeVKStyleProvider(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/access_token", func(w http.ResponseWriter, _ *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"access_token": "vk-access-token",
+			"user_id":      1234,
+			"email":        "user@example.com",
+		})
+	})
+	mux.HandleFunc("/method/users.get", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer vk-access-token" {
+			writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid_token"})
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"response": []map[string]interface{}{{"id": 1234, "first_name": "Иван", "last_name": "Петров"}},
+		})
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	cfg := Preset("vk")
+	cfg.ClientID = mockClientID
+	cfg.RedirectURL = mockRedirectURL
+	cfg.AuthURL = server.URL + "/authorize"
+	cfg.TokenURL = server.URL + "/access_token"
+	cfg.UserInfoURL = server.URL + "/method/users.get?v=5.199"
+	provider, err := NewProvider(cfg, server.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	identity, err := provider.Exchange(context.Background(), "code", "verifier", "")
+	if err != nil {
+		t.Fatalf("Exchange: %v", err)
+	}
+	want := Identity{
+		Provider:  "vk",
+		Subject:   "1234",
+		Email:     "user@example.com",
+		FirstName: "Иван",
+		LastName:  "Петров",
+	}
+	if *identity != want {
+		t.Errorf("Identity = %+v, want %+v", *identity, want)
+	}
+}
@@ -0,0 +1,464 @@
+package social
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"auth-user-service/internal/token"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// ProviderConfig - настройки внешнего провайдера входа.
+//
+// Для OIDC-провайдеров достаточно Issuer: эндпоинты берутся из
+// /.well-known/openid-configuration, ID token проверяется по JWKS провайдера.
+// Для провайдеров на чистом OAuth2 задаются AuthURL, TokenURL и UserInfoURL,
+// а данные пользователя читаются из ответа userinfo.
+type ProviderConfig struct {
+	Name         string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+
+	Issuer string
+	// Эндпоинты OAuth2. Для OIDC перекрывают найденные через discovery
+	AuthURL     string
+	TokenURL    string
+	UserInfoURL string
+	// TokenScheme - схема заголовка Authorization при запросе userinfo (по умолчанию Bearer)
+	TokenScheme string
+
+	// Поля ответа userinfo, вложенные - через точку. По умолчанию - стандартные claims OIDC
+	SubjectField   string
+	EmailField     string
+	FirstNameField string
+	LastNameField  string
+	// TrustEmail - провайдер отдаёт только подтверждённые адреса, даже без email_verified
+	TrustEmail bool
+}
+
+// presets - известные провайдеры: достаточно задать client_id и client_secret
+var presets = map[string]ProviderConfig{
+	"google": {
+		Issuer: "https://accounts.google.com",
+		Scopes: []string{"openid", "email", "profile"},
+	},
+	"yandex": {
+		AuthURL:        "https://oauth.yandex.ru/authorize",
+		TokenURL:       "https://oauth.yandex.ru/token",
+		UserInfoURL:    "https://login.yandex.ru/info?format=json",
+		TokenScheme:    "OAuth",
+		Scopes:         []string{"login:email", "login:info"},
+		SubjectField:   "id",
+		EmailField:     "default_email",
+		FirstNameField: "first_name",
+		LastNameField:  "last_name",
+		TrustEmail:     true,
+	},
+	// VK отдаёт email только в ответе token endpoint, а users.get - массив из одного пользователя.
+	// Подтверждён ли адрес, VK не сообщает, поэтому email не считается проверенным
+	"vk": {
+		AuthURL:        "https://oauth.vk.com/authorize",
+		TokenURL:       "https://oauth.vk.com/access_token",
+		UserInfoURL:    "https://api.vk.com/method/users.get?v=5.199",
+		Scopes:         []string{"email"},
+		SubjectField:   "response.0.id",
+		EmailField:     "email",
+		FirstNameField: "response.0.first_name",
+		LastNameField:  "response.0.last_name",
+	},
+}
+
+// Preset возвращает настройки известного провайдера (пустые, если провайдер неизвестен)
+func Preset(name string) ProviderConfig {
+	cfg := presets[name]
+	cfg.Name = name
+	return cfg
+}
+
+// Identity - пользователь, подтверждённый внешним провайдером
+type Identity struct {
+	Provider      string
+	Subject       string
+	Email         string
+	EmailVerified bool
+	FirstName     string
+	LastName      string
+}
+
+// jwksRefreshInterval - не чаще этого перечитываем JWKS при встрече неизвестного kid
+const jwksRefreshInterval = time.Minute
+
+// Provider - клиент одного провайдера
+type Provider struct {
+	cfg  ProviderConfig
+	http *http.Client
+
+	mu          sync.Mutex
+	discovered  bool
+	jwksURL     string
+	keys        map[string]interface{}
+	keysFetched time.Time
+}
+
+func NewProvider(cfg ProviderConfig, httpClient *http.Client) (*Provider, error) {
+	if cfg.Name == "" || cfg.ClientID == "" {
+		return nil, errors.New("provider name and client id are required")
+	}
+	if cfg.Issuer == "" && (cfg.AuthURL == "" || cfg.TokenURL == "" || cfg.UserInfoURL == "") {
+		return nil, fmt.Errorf("provider %s: either issuer or auth, token and userinfo URLs are required", cfg.Name)
+	}
+	if cfg.TokenScheme == "" {
+		cfg.TokenScheme = "Bearer"
+	}
+	if cfg.SubjectField == "" {
+		cfg.SubjectField = "sub"
+	}
+	if cfg.EmailField == "" {
+		cfg.EmailField = "email"
+	}
+	if cfg.FirstNameField == "" {
+		cfg.FirstNameField = "given_name"
+	}
+	if cfg.LastNameField == "" {
+		cfg.LastNameField = "family_name"
+	}
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: 10 * time.Second}
+	}
+	return &Provider{cfg: cfg, http: httpClient}, nil
+}
+
+func (p *Provider) Name() string {
+	return p.cfg.Name
+}
+
+// oidc сообщает, проверяется ли вход по ID token
+func (p *Provider) oidc() bool {
+	return p.cfg.Issuer != ""
+}
+
+// AuthCodeURL - адрес страницы входа провайдера (authorization code flow с PKCE)
+func (p *Provider) AuthCodeURL(ctx context.Context, state, nonce, codeChallenge string) (string, error) {
+	if err := p.discover(ctx); err != nil {
+		return "", err
+	}
+
+	params := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {p.cfg.ClientID},
+		"redirect_uri":          {p.cfg.RedirectURL},
+		"state":                 {state},
+		"code_challenge":        {codeChallenge},
+		"code_challenge_method": {"S256"},
+	}
+	if len(p.cfg.Scopes) > 0 {
+		params.Set("scope", strings.Join(p.cfg.Scopes, " "))
+	}
+	if p.oidc() {
+		params.Set("nonce", nonce)
+	}
+
+	separator := "?"
+	if strings.Contains(p.cfg.AuthURL, "?") {
+		separator = "&"
+	}
+	return p.cfg.AuthURL + separator + params.Encode(), nil
+}
+
+// Exchange обменивает код авторизации на данные пользователя
+func (p *Provider) Exchange(ctx context.Context, code, codeVerifier, nonce string) (*Identity, error) {
+	if err := p.discover(ctx); err != nil {
+		return nil, err
+	}
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.cfg.RedirectURL},
+		"client_id":     {p.cfg.ClientID},
+		"client_secret": {p.cfg.ClientSecret},
+		"code_verifier": {codeVerifier},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.cfg.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	var tokens map[string]interface{}
+	status, err := p.doJSON(req, &tokens)
+	if err != nil {
+		return nil, err
+	}
+	accessToken, idToken := lookup(tokens, "access_token"), lookup(tokens, "id_token")
+	if status != http.StatusOK || (accessToken == "" && idToken == "") {
+		return nil, fmt.Errorf("%s token endpoint: status %d: %s %s", p.cfg.Name, status, lookup(tokens, "error"), lookup(tokens, "error_description"))
+	}
+
+	var claims map[string]interface{}
+	if p.oidc() {
+		claims, err = p.verifyIDToken(ctx, idToken, nonce)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// ID token может не содержать email (зависит от scope) - тогда дочитываем userinfo
+	if claims == nil || (lookup(claims, p.cfg.EmailField) == "" && p.cfg.UserInfoURL != "") {
+		info, err := p.userInfo(ctx, accessToken)
+		if err != nil {
+			return nil, err
+		}
+		if claims != nil && lookup(info, p.cfg.SubjectField) != lookup(claims, "sub") {
+			return nil, fmt.Errorf("%s userinfo subject does not match ID token", p.cfg.Name)
+		}
+		// Некоторые OAuth2-провайдеры (VK) возвращают email вместе с access token, а не в userinfo
+		if claims == nil && lookup(info, p.cfg.EmailField) == "" && info != nil {
+			if email := lookup(tokens, p.cfg.EmailField); email != "" {
+				info[p.cfg.EmailField] = email
+			}
+		}
+		claims = info
+	}
+
+	identity := &Identity{
+		Provider:  p.cfg.Name,
+		Subject:   lookup(claims, p.cfg.SubjectField),
+		Email:     lookup(claims, p.cfg.EmailField),
+		FirstName: lookup(claims, p.cfg.FirstNameField),
+		LastName:  lookup(claims, p.cfg.LastNameField),
+	}
+	identity.EmailVerified = identity.Email != "" && (p.cfg.TrustEmail || lookup(claims, "email_verified") == "true")
+	if identity.Subject == "" {
+		return nil, fmt.Errorf("%s did not return a subject", p.cfg.Name)
+	}
+	return identity, nil
+}
+
+// verifyIDToken проверяет подпись, issuer, audience, срок действия и nonce ID token
+func (p *Provider) verifyIDToken(ctx context.Context, idToken, nonce string) (map[string]interface{}, error) {
+	if idToken == "" {
+		return nil, fmt.Errorf("%s did not return an ID token", p.cfg.Name)
+	}
+
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(idToken, claims,
+		func(t *jwt.Token) (interface{}, error) {
+			kid, _ := t.Header["kid"].(string)
+			return p.key(ctx, kid)
+		},
+		jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512", "EdDSA"}),
+		jwt.WithIssuer(p.cfg.Issuer),
+		jwt.WithAudience(p.cfg.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(time.Minute),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%s ID token: %w", p.cfg.Name, err)
+	}
+
+	if got, _ := claims["nonce"].(string); got == "" || got != nonce {
+		return nil, fmt.Errorf("%s ID token: nonce mismatch", p.cfg.Name)
+	}
+	return claims, nil
+}
+
+func (p *Provider) userInfo(ctx context.Context, accessToken string) (map[string]interface{}, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.cfg.UserInfoURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", p.cfg.TokenScheme+" "+accessToken)
+	req.Header.Set("Accept", "application/json")
+
+	var info map[string]interface{}
+	status, err := p.doJSON(req, &info)
+	if err != nil {
+		return nil, err
+	}
+	if status != http.StatusOK {
+		return nil, fmt.Errorf("%s userinfo endpoint: status %d", p.cfg.Name, status)
+	}
+	return info, nil
+}
+
+// discoveryDocument - нужные поля /.well-known/openid-configuration
+type discoveryDocument struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	UserInfoEndpoint      string `json:"userinfo_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// discover один раз загружает discovery-документ OIDC-провайдера.
+// При ошибке повторит попытку на следующем запросе
+func (p *Provider) discover(ctx context.Context) error {
+	if !p.oidc() {
+		return nil
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.discovered {
+		return nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(p.cfg.Issuer, "/")+"/.well-known/openid-configuration", nil)
+	if err != nil {
+		return err
+	}
+
+	var doc discoveryDocument
+	status, err := p.doJSON(req, &doc)
+	if err != nil {
+		return err
+	}
+	if status != http.StatusOK {
+		return fmt.Errorf("%s discovery: status %d", p.cfg.Name, status)
+	}
+	if doc.Issuer != p.cfg.Issuer {
+		return fmt.Errorf("%s discovery: issuer %q does not match %q", p.cfg.Name, doc.Issuer, p.cfg.Issuer)
+	}
+	if doc.JWKSURI == "" {
+		return fmt.Errorf("%s discovery: jwks_uri is missing", p.cfg.Name)
+	}
+
+	if p.cfg.AuthURL == "" {
+		p.cfg.AuthURL = doc.AuthorizationEndpoint
+	}
+	if p.cfg.TokenURL == "" {
+		p.cfg.TokenURL = doc.TokenEndpoint
+	}
+	if p.cfg.UserInfoURL == "" {
+		p.cfg.UserInfoURL = doc.UserInfoEndpoint
+	}
+	p.jwksURL = doc.JWKSURI
+	p.discovered = true
+	return nil
+}
+
+// key возвращает ключ проверки подписи по kid. Неизвестный kid означает ротацию
+// ключей у провайдера - тогда JWKS перечитывается
+func (p *Provider) key(ctx context.Context, kid string) (interface{}, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if key, ok := p.findKey(kid); ok {
+		return key, nil
+	}
+	if time.Since(p.keysFetched) < jwksRefreshInterval {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.jwksURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	var set token.JWKSet
+	status, err := p.doJSON(req, &set)
+	if err != nil {
+		return nil, err
+	}
+	if status != http.StatusOK {
+		return nil, fmt.Errorf("%s jwks: status %d", p.cfg.Name, status)
+	}
+
+	p.keys = make(map[string]interface{}, len(set.Keys))
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		public, err := jwk.PublicKey()
+		if err != nil {
+			continue
+		}
+		p.keys[jwk.Kid] = public
+	}
+	p.keysFetched = time.Now()
+
+	if key, ok := p.findKey(kid); ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("unknown signing key %q", kid)
+}
+
+// findKey ищет ключ по kid. Без kid подходит только единственный ключ. Вызывается под mu
+func (p *Provider) findKey(kid string) (interface{}, bool) {
+	if kid == "" {
+		if len(p.keys) != 1 {
+			return nil, false
+		}
+		for _, key := range p.keys {
+			return key, true
+		}
+	}
+	key, ok := p.keys[kid]
+	return key, ok
+}
+
+// maxResponseSize - ответы провайдеров небольшие, больше читать незачем
+const maxResponseSize = 1 << 20
+
+func (p *Provider) doJSON(req *http.Request, dest interface{}) (int, error) {
+	resp, err := p.http.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer func(body io.ReadCloser) {
+		_ = body.Close()
+	}(resp.Body)
+
+	decoder := json.NewDecoder(io.LimitReader(resp.Body, maxResponseSize))
+	decoder.UseNumber()
+	if err := decoder.Decode(dest); err != nil && resp.StatusCode == http.StatusOK {
+		return resp.StatusCode, fmt.Errorf("%s: invalid response: %w", p.cfg.Name, err)
+	}
+	return resp.StatusCode, nil
+}
+
+// lookup достаёт значение поля по пути через точку и приводит его к строке.
+// Числовая часть пути - индекс в массиве ("response.0.id")
+func lookup(data map[string]interface{}, path string) string {
+	var value interface{} = data
+	for _, part := range strings.Split(path, ".") {
+		switch container := value.(type) {
+		case map[string]interface{}:
+			value = container[part]
+		case []interface{}:
+			index, err := strconv.Atoi(part)
+			if err != nil || index < 0 || index >= len(container) {
+				return ""
+			}
+			value = container[index]
+		default:
+			return ""
+		}
+	}
+
+	switch v := value.(type) {
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	case bool:
+		if v {
+			return "true"
+		}
+		return "false"
+	}
+	return ""
+}
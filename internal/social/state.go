@@ -0,0 +1,98 @@
+package social
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"auth-user-service/internal/redis"
+)
+
+// Flow - незавершённый вход через провайдера, хранится по параметру state
+type Flow struct {
+	Provider     string `json:"provider"`
+	Nonce        string `json:"nonce"`
+	CodeVerifier string `json:"code_verifier"`
+	// LinkUserID - пользователь, привязывающий аккаунт провайдера. 0 - обычный вход
+	LinkUserID int `json:"link_user_id,omitempty"`
+}
+
+// StateStore хранит Flow до возврата пользователя от провайдера. Take одноразовый:
+// повторный callback с тем же state не пройдёт
+type StateStore interface {
+	Save(ctx context.Context, state string, flow *Flow, ttl time.Duration) error
+	Take(ctx context.Context, state string) (*Flow, error)
+}
+
+// NewStateStore возвращает хранилище в Redis, а без Redis - в памяти процесса.
+// Без Redis вход работает, только если callback попадёт на тот же инстанс
+func NewStateStore(redisClient *redis.Client) StateStore {
+	if redisClient == nil {
+		log.Println("⚠️ Redis unavailable: social login state is kept in memory of this instance only")
+		return &memoryStateStore{flows: make(map[string]memoryFlow)}
+	}
+	return &redisStateStore{redis: redisClient}
+}
+
+type redisStateStore struct {
+	redis *redis.Client
+}
+
+func stateKey(state string) string {
+	return fmt.Sprintf("oauth_state:%s", state)
+}
+
+func (s *redisStateStore) Save(ctx context.Context, state string, flow *Flow, ttl time.Duration) error {
+	return s.redis.Set(ctx, stateKey(state), flow, ttl)
+}
+
+func (s *redisStateStore) Take(ctx context.Context, state string) (*Flow, error) {
+	var flow Flow
+	err := s.redis.Take(ctx, stateKey(state), &flow)
+	if errors.Is(err, redis.ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &flow, nil
+}
+
+type memoryStateStore struct {
+	mu    sync.Mutex
+	flows map[string]memoryFlow
+}
+
+type memoryFlow struct {
+	flow      Flow
+	expiresAt time.Time
+}
+
+func (s *memoryStateStore) Save(_ context.Context, state string, flow *Flow, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for key, f := range s.flows {
+		if now.After(f.expiresAt) {
+			delete(s.flows, key)
+		}
+	}
+	s.flows[state] = memoryFlow{flow: *flow, expiresAt: now.Add(ttl)}
+	return nil
+}
+
+func (s *memoryStateStore) Take(_ context.Context, state string) (*Flow, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	f, ok := s.flows[state]
+	delete(s.flows, state)
+	if !ok || time.Now().After(f.expiresAt) {
+		return nil, nil
+	}
+	return &f.flow, nil
+}
@@ -0,0 +1,160 @@
+package token
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Типы токенов (claim typ)
+const (
+	TypeAccess = "access"
+	// TypeClientAccess - access-токен стороннего OAuth-приложения. API сервиса его
+	// не принимает, он годится только для userinfo
+	TypeClientAccess = "client_access"
+	TypeMFAPending   = "mfa_pending"
+)
+
+var (
+	ErrInvalidToken   = errors.New("invalid token")
+	ErrWrongTokenType = errors.New("wrong token type")
+)
+
+// Claims - содержимое всех JWT, которые выпускает сервис
+type Claims struct {
+	UserID    int    `json:"user_id"`
+	Email     string `json:"email,omitempty"`
+	Type      string `json:"typ,omitempty"`
+	SessionID string `json:"sid,omitempty"`
+	// Roles - роли пользователя на момент выдачи токена
+	Roles    []string `json:"roles,omitempty"`
+	TenantID string   `json:"tenant_id,omitempty"`
+	// ClientID и Scope - для токенов, выданных стороннему приложению через OIDC
+	ClientID string `json:"client_id,omitempty"`
+	Scope    string `json:"scope,omitempty"`
+	// ServiceAccountID - токен выдан сервисному аккаунту, UserID при этом пустой
+	ServiceAccountID int `json:"service_account_id,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// IsServiceAccount - токен принадлежит сервисному аккаунту, а не пользователю
+func (c *Claims) IsServiceAccount() bool {
+	return c.ServiceAccountID != 0
+}
+
+// Config - параметры выпуска и проверки токенов
+type Config struct {
+	Issuer   string
+	Audience []string
+	// AccessTTL - время жизни access-токена
+	AccessTTL time.Duration
+	// Leeway - допустимое расхождение часов при проверке exp/nbf/iat
+	Leeway time.Duration
+}
+
+// Issuer выпускает и проверяет типизированные JWT
+type Issuer struct {
+	keys *KeyRing
+	cfg  Config
+}
+
+func NewIssuer(keys *KeyRing, cfg Config) *Issuer {
+	return &Issuer{keys: keys, cfg: cfg}
+}
+
+// AccessTTL - время жизни access-токенов
+func (i *Issuer) AccessTTL() time.Duration {
+	return i.cfg.AccessTTL
+}
+
+// Keys возвращает набор ключей подписи
+func (i *Issuer) Keys() *KeyRing {
+	return i.keys
+}
+
+// IssueAccess выпускает access-токен
+func (i *Issuer) IssueAccess(claims *Claims) (string, error) {
+	claims.Type = TypeAccess
+	return i.Issue(claims, i.cfg.AccessTTL)
+}
+
+// IssueClientAccess выпускает access-токен стороннего OAuth-приложения
+func (i *Issuer) IssueClientAccess(claims *Claims) (string, error) {
+	claims.Type = TypeClientAccess
+	return i.Issue(claims, i.cfg.AccessTTL)
+}
+
+// Issue заполняет стандартные claims (iss, sub, aud, iat, nbf, exp, jti) и подписывает токен
+func (i *Issuer) Issue(claims *Claims, ttl time.Duration) (string, error) {
+	jti, err := newJTI()
+	if err != nil {
+		return "", err
+	}
+
+	subject := strconv.Itoa(claims.UserID)
+	if claims.IsServiceAccount() {
+		subject = "service-account:" + strconv.Itoa(claims.ServiceAccountID)
+	}
+
+	now := time.Now()
+	claims.RegisteredClaims = jwt.RegisteredClaims{
+		Issuer:    i.cfg.Issuer,
+		Subject:   subject,
+		Audience:  i.cfg.Audience,
+		ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+		NotBefore: jwt.NewNumericDate(now),
+		IssuedAt:  jwt.NewNumericDate(now),
+		ID:        jti,
+	}
+
+	return i.keys.Sign(claims)
+}
+
+// Parse проверяет подпись, сроки, издателя, аудиторию и тип токена.
+// Токены без typ считаются access-токенами (выданы до появления claim)
+func (i *Issuer) Parse(tokenString, expectedType string) (*Claims, error) {
+	opts := []jwt.ParserOption{
+		jwt.WithValidMethods(i.keys.ValidMethods()),
+		jwt.WithLeeway(i.cfg.Leeway),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+	}
+	if i.cfg.Issuer != "" {
+		opts = append(opts, jwt.WithIssuer(i.cfg.Issuer))
+	}
+	if len(i.cfg.Audience) > 0 {
+		opts = append(opts, jwt.WithAudience(i.cfg.Audience...))
+	}
+
+	claims := &Claims{}
+	parsed, err := jwt.ParseWithClaims(tokenString, claims, i.keys.Keyfunc, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+	if !parsed.Valid || (claims.UserID == 0 && claims.ServiceAccountID == 0) {
+		return nil, ErrInvalidToken
+	}
+
+	typ := claims.Type
+	if typ == "" {
+		typ = TypeAccess
+	}
+	if typ != expectedType {
+		return nil, ErrWrongTokenType
+	}
+
+	return claims, nil
+}
+
+func newJTI() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
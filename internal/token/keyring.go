@@ -0,0 +1,251 @@
+package token
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Key - ключ подписи или проверки JWT
+type Key struct {
+	ID     string
+	Method jwt.SigningMethod
+	// signer - приватный ключ (или HMAC-секрет), nil для ключей только для проверки
+	signer interface{}
+	// verifier - публичный ключ (или HMAC-секрет)
+	verifier interface{}
+}
+
+// CanSign сообщает, есть ли у ключа приватная часть
+func (k *Key) CanSign() bool {
+	return k.signer != nil
+}
+
+// KeyRing - набор ключей: один активный для подписи и любое число выведенных из
+// ротации, которыми ещё проверяются ранее выданные токены
+type KeyRing struct {
+	active *Key
+	keys   map[string]*Key
+	// legacy - HMAC-ключ для токенов без kid, выданных до перехода на асимметричные ключи
+	legacy *Key
+	// legacyUntil - до какого момента принимаются токены без kid, если подпись уже асимметричная
+	legacyUntil time.Time
+}
+
+// LoadKeyRing загружает PEM-файлы ключей. Первый файл - активный ключ подписи
+// (обязательно приватный), остальные - старые ключи, которые принимаются при проверке.
+//
+// hmacSecret - прежний общий секрет HS256. Если файлов нет, он становится ключом
+// подписи. Если файлы есть, им проверяются токены без kid, но только до legacyUntil:
+// пока секрет принимается, любой, кто его знает, может выпустить токен. Нулевой
+// legacyUntil - секрет не принимается вовсе.
+func LoadKeyRing(files []string, hmacSecret string, legacyUntil time.Time) (*KeyRing, error) {
+	ring := &KeyRing{keys: make(map[string]*Key)}
+
+	if hmacSecret != "" {
+		ring.legacy = &Key{
+			ID:       "",
+			Method:   jwt.SigningMethodHS256,
+			signer:   []byte(hmacSecret),
+			verifier: []byte(hmacSecret),
+		}
+	}
+
+	for i, file := range files {
+		file = strings.TrimSpace(file)
+		if file == "" {
+			continue
+		}
+
+		key, err := loadKeyFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("load key %s: %w", file, err)
+		}
+
+		if ring.active == nil {
+			if i > 0 || !key.CanSign() {
+				return nil, fmt.Errorf("active signing key %s must be a private key", file)
+			}
+			ring.active = key
+		}
+		ring.keys[key.ID] = key
+	}
+
+	if ring.active == nil {
+		if ring.legacy == nil {
+			return nil, errors.New("no signing keys configured")
+		}
+		ring.active = ring.legacy
+		return ring, nil
+	}
+
+	if ring.legacy != nil {
+		if time.Now().Before(legacyUntil) {
+			ring.legacyUntil = legacyUntil
+		} else {
+			ring.legacy = nil
+		}
+	}
+
+	return ring, nil
+}
+
+// SigningKey возвращает активный ключ подписи
+func (r *KeyRing) SigningKey() *Key {
+	return r.active
+}
+
+// Asymmetric сообщает, подписываются ли токены асимметричным ключом
+func (r *KeyRing) Asymmetric() bool {
+	return r.active != r.legacy
+}
+
+// LegacyUntil - до какого момента принимаются токены прежнего HS256 секрета без kid.
+// Нулевое значение, если секрет не принимается или сам остаётся ключом подписи
+func (r *KeyRing) LegacyUntil() time.Time {
+	return r.legacyUntil
+}
+
+// acceptsLegacy сообщает, принимаются ли сейчас токены без kid
+func (r *KeyRing) acceptsLegacy() bool {
+	if r.legacy == nil {
+		return false
+	}
+	return r.active == r.legacy || time.Now().Before(r.legacyUntil)
+}
+
+// Sign подписывает claims активным ключом и проставляет kid в заголовок
+func (r *KeyRing) Sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(r.active.Method, claims)
+	if r.active.ID != "" {
+		token.Header["kid"] = r.active.ID
+	}
+	return token.SignedString(r.active.signer)
+}
+
+// Keyfunc подбирает ключ проверки по kid и следит, чтобы alg соответствовал ключу
+func (r *KeyRing) Keyfunc(token *jwt.Token) (interface{}, error) {
+	var key *Key
+	if kid, ok := token.Header["kid"].(string); ok && kid != "" {
+		key = r.keys[kid]
+		if key == nil {
+			return nil, fmt.Errorf("unknown signing key %q", kid)
+		}
+	} else {
+		if !r.acceptsLegacy() {
+			return nil, errors.New("token has no kid")
+		}
+		key = r.legacy
+	}
+
+	if token.Method.Alg() != key.Method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+	}
+	return key.verifier, nil
+}
+
+// ValidMethods - алгоритмы, которые допускаются при разборе токенов
+func (r *KeyRing) ValidMethods() []string {
+	seen := make(map[string]bool)
+	var methods []string
+	add := func(k *Key) {
+		if k != nil && !seen[k.Method.Alg()] {
+			seen[k.Method.Alg()] = true
+			methods = append(methods, k.Method.Alg())
+		}
+	}
+
+	if r.acceptsLegacy() {
+		add(r.legacy)
+	}
+	for _, k := range r.keys {
+		add(k)
+	}
+	return methods
+}
+
+func loadKeyFile(path string) (*Key, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+
+	var private, public interface{}
+	switch block.Type {
+	case "PRIVATE KEY":
+		private, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		private, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		private, err = x509.ParseECPrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		public, err = x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported PEM block %q", block.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if private != nil {
+		signer, ok := private.(crypto.Signer)
+		if !ok {
+			return nil, errors.New("unsupported private key type")
+		}
+		public = signer.Public()
+	}
+
+	method, err := methodForKey(public)
+	if err != nil {
+		return nil, err
+	}
+
+	kid, err := thumbprint(public)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Key{
+		ID:       kid,
+		Method:   method,
+		signer:   private,
+		verifier: public,
+	}, nil
+}
+
+func methodForKey(public interface{}) (jwt.SigningMethod, error) {
+	switch k := public.(type) {
+	case *rsa.PublicKey:
+		if k.N.BitLen() < 2048 {
+			return nil, errors.New("RSA keys must be at least 2048 bits")
+		}
+		return jwt.SigningMethodRS256, nil
+	case *ecdsa.PublicKey:
+		switch k.Curve {
+		case elliptic.P256():
+			return jwt.SigningMethodES256, nil
+		case elliptic.P384():
+			return jwt.SigningMethodES384, nil
+		}
+		return nil, errors.New("unsupported EC curve")
+	case ed25519.PublicKey:
+		return jwt.SigningMethodEdDSA, nil
+	}
+	return nil, fmt.Errorf("unsupported key type %T", public)
+}
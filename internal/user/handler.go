@@ -3,6 +3,8 @@ package user
 import (
 	"encoding/json"
 	"net/http"
+
+	"auth-user-service/internal/sms"
 )
 
 type Handler struct {
@@ -62,10 +64,16 @@ func (h *Handler) UpdateProfile(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Номер храним в одном формате, иначе тот же номер в другой записи сбросит подтверждение
+	phone := req.Phone
+	if normalized, err := sms.NormalizePhone(phone); err == nil {
+		phone = normalized
+	}
+
 	profile := &Profile{
 		FirstName: req.FirstName,
 		LastName:  req.LastName,
-		Phone:     req.Phone,
+		Phone:     phone,
 		Address:   req.Address,
 	}
 
@@ -2,12 +2,26 @@ package user
 
 import (
 	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
 	"time"
 )
 
+var (
+	ErrUserNotFound         = errors.New("user not found")
+	ErrDeletionNotScheduled = errors.New("account deletion not scheduled")
+)
+
 type Repository interface {
 	GetProfile(userID int) (*Profile, error)
 	UpdateProfile(userID int, profile *Profile) error
+	ListAccounts(filter AccountFilter) ([]Account, int, error)
+	GetAccount(userID int) (*Account, error)
+	DeleteUser(userID int) error
+	ScheduleDeletion(userID int, at time.Time) (time.Time, error)
+	CancelDeletion(userID int) error
+	ListDueDeletions(now time.Time) ([]int, error)
 }
 
 type repository struct {
@@ -19,28 +33,73 @@ func NewRepository(db *sql.DB) Repository {
 }
 
 type Profile struct {
-	ID        int       `json:"id"`
-	Email     string    `json:"email"`
-	FirstName string    `json:"first_name,omitempty"`
-	LastName  string    `json:"last_name,omitempty"`
-	Phone     string    `json:"phone,omitempty"`
-	Address   string    `json:"address,omitempty"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+	ID                  int        `json:"id"`
+	Email               string     `json:"email"`
+	FirstName           string     `json:"first_name,omitempty"`
+	LastName            string     `json:"last_name,omitempty"`
+	Phone               string     `json:"phone,omitempty"`
+	PhoneVerifiedAt     *time.Time `json:"phone_verified_at,omitempty"`
+	Address             string     `json:"address,omitempty"`
+	DeletionScheduledAt *time.Time `json:"deletion_scheduled_at,omitempty"`
+	CreatedAt           time.Time  `json:"created_at"`
+	UpdatedAt           time.Time  `json:"updated_at"`
+}
+
+// Account - сведения об аккаунте для администраторов
+type Account struct {
+	ID                  int        `json:"id"`
+	Email               string     `json:"email"`
+	FirstName           string     `json:"first_name,omitempty"`
+	LastName            string     `json:"last_name,omitempty"`
+	Phone               string     `json:"phone,omitempty"`
+	EmailVerifiedAt     *time.Time `json:"email_verified_at,omitempty"`
+	TwoFactorEnabled    bool       `json:"two_factor_enabled"`
+	DisabledAt          *time.Time `json:"disabled_at,omitempty"`
+	DeletionScheduledAt *time.Time `json:"deletion_scheduled_at,omitempty"`
+	CreatedAt           time.Time  `json:"created_at"`
+	UpdatedAt           time.Time  `json:"updated_at"`
+}
+
+// AccountFilter - параметры поиска аккаунтов
+type AccountFilter struct {
+	// Query ищется в email, имени, фамилии и телефоне
+	Query string
+	// Status: "active", "disabled" или пусто для всех
+	Status string
+	Limit  int
+	Offset int
+}
+
+const accountColumns = `u.id, u.email, COALESCE(u.first_name, ''), COALESCE(u.last_name, ''), COALESCE(p.phone, ''),
+		 u.email_verified_at, u.totp_enabled_at IS NOT NULL, u.disabled_at, u.deletion_scheduled_at, u.created_at, u.updated_at`
+
+func scanAccount(row interface{ Scan(...interface{}) error }) (*Account, error) {
+	var account Account
+	err := row.Scan(
+		&account.ID, &account.Email, &account.FirstName, &account.LastName, &account.Phone,
+		&account.EmailVerifiedAt, &account.TwoFactorEnabled, &account.DisabledAt, &account.DeletionScheduledAt,
+		&account.CreatedAt, &account.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &account, nil
 }
 
 func (r *repository) GetProfile(userID int) (*Profile, error) {
 	var profile Profile
 	err := r.db.QueryRow(
 		`SELECT u.id, u.email, COALESCE(u.first_name, ''), COALESCE(u.last_name, ''),
-		 COALESCE(p.phone, ''), COALESCE(p.address, ''), u.created_at, COALESCE(p.updated_at, u.created_at)
+		 COALESCE(p.phone, ''), p.phone_verified_at, COALESCE(p.address, ''), u.deletion_scheduled_at,
+		 u.created_at, COALESCE(p.updated_at, u.created_at)
 		 FROM users u 
 		 LEFT JOIN user_profiles p ON u.id = p.id 
 		 WHERE u.id = $1`,
 		userID,
 	).Scan(
 		&profile.ID, &profile.Email, &profile.FirstName, &profile.LastName,
-		&profile.Phone, &profile.Address, &profile.CreatedAt, &profile.UpdatedAt,
+		&profile.Phone, &profile.PhoneVerifiedAt, &profile.Address, &profile.DeletionScheduledAt,
+		&profile.CreatedAt, &profile.UpdatedAt,
 	)
 
 	if err == sql.ErrNoRows {
@@ -77,10 +136,12 @@ func (r *repository) UpdateProfile(userID int, profile *Profile) error {
 	}
 
 	if exists {
-		// Обновляем существующий профиль (только phone и address)
+		// Обновляем существующий профиль (только phone и address).
+		// Новый номер нужно подтвердить заново
 		_, err = r.db.Exec(
 			`UPDATE user_profiles
-			 SET phone = $1, address = $2, updated_at = NOW()
+			 SET phone = $1, address = $2, updated_at = NOW(),
+			     phone_verified_at = CASE WHEN phone IS DISTINCT FROM $1 THEN NULL ELSE phone_verified_at END
 			 WHERE id = $3`,
 			profile.Phone, profile.Address, userID,
 		)
@@ -95,3 +156,166 @@ func (r *repository) UpdateProfile(userID int, profile *Profile) error {
 
 	return err
 }
+
+func (r *repository) ListAccounts(filter AccountFilter) ([]Account, int, error) {
+	where := []string{"TRUE"}
+	var args []interface{}
+
+	if filter.Query != "" {
+		args = append(args, "%"+escapeLike(filter.Query)+"%")
+		n := len(args)
+		where = append(where, fmt.Sprintf(
+			"(u.email ILIKE $%d OR u.first_name ILIKE $%d OR u.last_name ILIKE $%d OR p.phone ILIKE $%d)",
+			n, n, n, n,
+		))
+	}
+
+	switch filter.Status {
+	case "active":
+		where = append(where, "u.disabled_at IS NULL")
+	case "disabled":
+		where = append(where, "u.disabled_at IS NOT NULL")
+	}
+
+	from := " FROM users u LEFT JOIN user_profiles p ON u.id = p.id WHERE " + strings.Join(where, " AND ")
+
+	var total int
+	if err := r.db.QueryRow("SELECT COUNT(*)"+from, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	args = append(args, filter.Limit, filter.Offset)
+	rows, err := r.db.Query(
+		"SELECT "+accountColumns+from+fmt.Sprintf(" ORDER BY u.created_at DESC LIMIT $%d OFFSET $%d", len(args)-1, len(args)),
+		args...,
+	)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer func(rows *sql.Rows) {
+		_ = rows.Close()
+	}(rows)
+
+	accounts := []Account{}
+	for rows.Next() {
+		account, err := scanAccount(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		accounts = append(accounts, *account)
+	}
+
+	return accounts, total, rows.Err()
+}
+
+func (r *repository) GetAccount(userID int) (*Account, error) {
+	account, err := scanAccount(r.db.QueryRow(
+		"SELECT "+accountColumns+" FROM users u LEFT JOIN user_profiles p ON u.id = p.id WHERE u.id = $1",
+		userID,
+	))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	return account, err
+}
+
+// DeleteUser удаляет аккаунт. Заказы остаются для учёта, но отвязываются от пользователя
+// и очищаются от персональных данных
+func (r *repository) DeleteUser(userID int) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func(tx *sql.Tx) {
+		_ = tx.Rollback()
+	}(tx)
+
+	if _, err := tx.Exec(
+		`UPDATE orders
+		 SET user_id = NULL, description = '', anonymized_at = NOW(), updated_at = NOW()
+		 WHERE user_id = $1`,
+		userID,
+	); err != nil {
+		return err
+	}
+
+	res, err := tx.Exec("DELETE FROM users WHERE id = $1", userID)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrUserNotFound
+	}
+
+	return tx.Commit()
+}
+
+// ScheduleDeletion назначает удаление аккаунта на время at. Повторный запрос
+// не переносит уже назначенную дату. Возвращает итоговую дату удаления
+func (r *repository) ScheduleDeletion(userID int, at time.Time) (time.Time, error) {
+	var scheduledAt time.Time
+	err := r.db.QueryRow(
+		`UPDATE users
+		 SET deletion_scheduled_at = COALESCE(deletion_scheduled_at, $1), updated_at = NOW()
+		 WHERE id = $2
+		 RETURNING deletion_scheduled_at`,
+		at, userID,
+	).Scan(&scheduledAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return time.Time{}, ErrUserNotFound
+	}
+	return scheduledAt, err
+}
+
+func (r *repository) CancelDeletion(userID int) error {
+	res, err := r.db.Exec(
+		`UPDATE users SET deletion_scheduled_at = NULL, updated_at = NOW()
+		 WHERE id = $1 AND deletion_scheduled_at IS NOT NULL`,
+		userID,
+	)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrDeletionNotScheduled
+	}
+	return nil
+}
+
+// ListDueDeletions - аккаунты, срок удаления которых наступил
+func (r *repository) ListDueDeletions(now time.Time) ([]int, error) {
+	rows, err := r.db.Query(
+		"SELECT id FROM users WHERE deletion_scheduled_at <= $1 ORDER BY deletion_scheduled_at",
+		now,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer func(rows *sql.Rows) {
+		_ = rows.Close()
+	}(rows)
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
+}
+
+// escapeLike экранирует спецсимволы шаблона LIKE
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
@@ -11,6 +11,13 @@ import (
 type Service interface {
 	GetProfile(userID int) (*Profile, error)
 	UpdateProfile(userID int, profile *Profile) error
+	ListAccounts(filter AccountFilter) ([]Account, int, error)
+	GetAccount(userID int) (*Account, error)
+	DeleteUser(userID int) error
+	ScheduleDeletion(userID int, at time.Time) (time.Time, error)
+	CancelDeletion(userID int) error
+	ListDueDeletions(now time.Time) ([]int, error)
+	InvalidateProfile(userID int) error
 }
 
 type service struct {
@@ -77,3 +84,58 @@ func (s *service) UpdateProfile(userID int, profile *Profile) error {
 
 	return nil
 }
+
+func (s *service) ListAccounts(filter AccountFilter) ([]Account, int, error) {
+	return s.repo.ListAccounts(filter)
+}
+
+func (s *service) GetAccount(userID int) (*Account, error) {
+	return s.repo.GetAccount(userID)
+}
+
+func (s *service) DeleteUser(userID int) error {
+	if err := s.repo.DeleteUser(userID); err != nil {
+		return err
+	}
+
+	// Инвалидируем кэш
+	if s.redis != nil {
+		cacheKey := fmt.Sprintf("user_profile:%d", userID)
+		ctx := context.Background()
+		err := s.redis.Delete(ctx, cacheKey)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ScheduleDeletion назначает удаление аккаунта. Дата удаления видна в профиле
+func (s *service) ScheduleDeletion(userID int, at time.Time) (time.Time, error) {
+	scheduledAt, err := s.repo.ScheduleDeletion(userID, at)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return scheduledAt, s.InvalidateProfile(userID)
+}
+
+func (s *service) CancelDeletion(userID int) error {
+	if err := s.repo.CancelDeletion(userID); err != nil {
+		return err
+	}
+	return s.InvalidateProfile(userID)
+}
+
+func (s *service) ListDueDeletions(now time.Time) ([]int, error) {
+	return s.repo.ListDueDeletions(now)
+}
+
+// InvalidateProfile удаляет профиль из кэша, например после смены email
+func (s *service) InvalidateProfile(userID int) error {
+	if s.redis == nil {
+		return nil
+	}
+	cacheKey := fmt.Sprintf("user_profile:%d", userID)
+	return s.redis.Delete(context.Background(), cacheKey)
+}
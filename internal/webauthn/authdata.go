@@ -0,0 +1,82 @@
+package webauthn
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// Флаги authenticator data
+const (
+	flagUserPresent    = 0x01
+	flagUserVerified   = 0x04
+	flagBackupEligible = 0x08
+	flagBackedUp       = 0x10
+	flagAttestedData   = 0x40
+	flagExtensions     = 0x80
+)
+
+var ErrMalformedAuthData = errors.New("malformed authenticator data")
+
+// authenticatorData - данные, которые подписывает аутентификатор (WebAuthn, 6.1)
+type authenticatorData struct {
+	rpIDHash  []byte
+	flags     byte
+	signCount uint32
+	// Заполнены только при регистрации (флаг AT)
+	aaguid       []byte
+	credentialID []byte
+	publicKey    []byte
+}
+
+func (d *authenticatorData) has(flag byte) bool {
+	return d.flags&flag != 0
+}
+
+func parseAuthenticatorData(data []byte) (*authenticatorData, error) {
+	if len(data) < 37 {
+		return nil, fmt.Errorf("%w: too short", ErrMalformedAuthData)
+	}
+
+	d := &authenticatorData{
+		rpIDHash:  data[:32],
+		flags:     data[32],
+		signCount: binary.BigEndian.Uint32(data[33:37]),
+	}
+	rest := data[37:]
+
+	if d.has(flagAttestedData) {
+		if len(rest) < 18 {
+			return nil, fmt.Errorf("%w: truncated attested credential data", ErrMalformedAuthData)
+		}
+		d.aaguid = rest[:16]
+		idLen := int(binary.BigEndian.Uint16(rest[16:18]))
+		rest = rest[18:]
+		if idLen == 0 || idLen > 1023 || len(rest) < idLen {
+			return nil, fmt.Errorf("%w: bad credential id length", ErrMalformedAuthData)
+		}
+		d.credentialID = rest[:idLen]
+		rest = rest[idLen:]
+
+		// Длина COSE-ключа не записана - узнаём её, разобрав CBOR
+		_, after, err := decodeCBOR(rest)
+		if err != nil {
+			return nil, fmt.Errorf("%w: credential public key: %v", ErrMalformedAuthData, err)
+		}
+		d.publicKey = rest[:len(rest)-len(after)]
+		rest = after
+	}
+
+	if d.has(flagExtensions) {
+		_, after, err := decodeCBOR(rest)
+		if err != nil {
+			return nil, fmt.Errorf("%w: extensions: %v", ErrMalformedAuthData, err)
+		}
+		rest = after
+	}
+
+	if len(rest) != 0 {
+		return nil, fmt.Errorf("%w: trailing data", ErrMalformedAuthData)
+	}
+	return d, nil
+}
@@ -0,0 +1,164 @@
+package webauthn
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// Минимальный декодер CBOR (RFC 8949) - ровно то, что встречается в attestationObject
+// и COSE-ключах: целые, байтовые и текстовые строки, массивы, словари и простые значения.
+// Строки неопределённой длины и теги аутентификаторы здесь не используют
+
+var ErrMalformedCBOR = errors.New("malformed CBOR")
+
+// maxCBORDepth ограничивает вложенность, чтобы специально собранные данные не уронили стек
+const maxCBORDepth = 16
+
+// decodeCBOR разбирает одно значение и возвращает остаток данных.
+// Целые - int64, строки байт - []byte, словари - map[interface{}]interface{}
+func decodeCBOR(data []byte) (interface{}, []byte, error) {
+	return decodeCBORItem(data, 0)
+}
+
+func decodeCBORItem(data []byte, depth int) (interface{}, []byte, error) {
+	if depth > maxCBORDepth {
+		return nil, nil, fmt.Errorf("%w: nesting too deep", ErrMalformedCBOR)
+	}
+	if len(data) == 0 {
+		return nil, nil, fmt.Errorf("%w: unexpected end of data", ErrMalformedCBOR)
+	}
+
+	major := data[0] >> 5
+	info := data[0] & 0x1f
+
+	// Простые значения и числа с плавающей точкой
+	if major == 7 {
+		switch info {
+		case 20:
+			return false, data[1:], nil
+		case 21:
+			return true, data[1:], nil
+		case 22, 23:
+			return nil, data[1:], nil
+		case 25:
+			if len(data) < 3 {
+				return nil, nil, fmt.Errorf("%w: truncated float", ErrMalformedCBOR)
+			}
+			return nil, data[3:], nil
+		case 26:
+			if len(data) < 5 {
+				return nil, nil, fmt.Errorf("%w: truncated float", ErrMalformedCBOR)
+			}
+			return float64(math.Float32frombits(binary.BigEndian.Uint32(data[1:5]))), data[5:], nil
+		case 27:
+			if len(data) < 9 {
+				return nil, nil, fmt.Errorf("%w: truncated float", ErrMalformedCBOR)
+			}
+			return math.Float64frombits(binary.BigEndian.Uint64(data[1:9])), data[9:], nil
+		}
+		return nil, nil, fmt.Errorf("%w: unsupported simple value %d", ErrMalformedCBOR, info)
+	}
+
+	arg, rest, err := readCBORArgument(data)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	switch major {
+	case 0:
+		if arg > math.MaxInt64 {
+			return nil, nil, fmt.Errorf("%w: integer overflow", ErrMalformedCBOR)
+		}
+		return int64(arg), rest, nil
+	case 1:
+		if arg > math.MaxInt64 {
+			return nil, nil, fmt.Errorf("%w: integer overflow", ErrMalformedCBOR)
+		}
+		return -1 - int64(arg), rest, nil
+	case 2, 3:
+		if arg > uint64(len(rest)) {
+			return nil, nil, fmt.Errorf("%w: truncated string", ErrMalformedCBOR)
+		}
+		value := rest[:arg]
+		if major == 3 {
+			return string(value), rest[arg:], nil
+		}
+		return append([]byte(nil), value...), rest[arg:], nil
+	case 4:
+		// Каждый элемент занимает хотя бы байт - так длина из заголовка не заставит выделить лишнюю память
+		if arg > uint64(len(rest)) {
+			return nil, nil, fmt.Errorf("%w: truncated array", ErrMalformedCBOR)
+		}
+		items := make([]interface{}, 0, arg)
+		for i := uint64(0); i < arg; i++ {
+			var item interface{}
+			item, rest, err = decodeCBORItem(rest, depth+1)
+			if err != nil {
+				return nil, nil, err
+			}
+			items = append(items, item)
+		}
+		return items, rest, nil
+	case 5:
+		if arg > uint64(len(rest)) {
+			return nil, nil, fmt.Errorf("%w: truncated map", ErrMalformedCBOR)
+		}
+		m := make(map[interface{}]interface{}, arg)
+		for i := uint64(0); i < arg; i++ {
+			var key, value interface{}
+			key, rest, err = decodeCBORItem(rest, depth+1)
+			if err != nil {
+				return nil, nil, err
+			}
+			switch key.(type) {
+			case int64, string:
+			default:
+				return nil, nil, fmt.Errorf("%w: unsupported map key", ErrMalformedCBOR)
+			}
+			value, rest, err = decodeCBORItem(rest, depth+1)
+			if err != nil {
+				return nil, nil, err
+			}
+			m[key] = value
+		}
+		return m, rest, nil
+	}
+
+	return nil, nil, fmt.Errorf("%w: unsupported major type %d", ErrMalformedCBOR, major)
+}
+
+// readCBORArgument читает аргумент заголовка (длину или значение целого)
+func readCBORArgument(data []byte) (uint64, []byte, error) {
+	info := data[0] & 0x1f
+	data = data[1:]
+
+	switch {
+	case info < 24:
+		return uint64(info), data, nil
+	case info == 24:
+		if len(data) < 1 {
+			break
+		}
+		return uint64(data[0]), data[1:], nil
+	case info == 25:
+		if len(data) < 2 {
+			break
+		}
+		return uint64(binary.BigEndian.Uint16(data)), data[2:], nil
+	case info == 26:
+		if len(data) < 4 {
+			break
+		}
+		return uint64(binary.BigEndian.Uint32(data)), data[4:], nil
+	case info == 27:
+		if len(data) < 8 {
+			break
+		}
+		return binary.BigEndian.Uint64(data), data[8:], nil
+	default:
+		return 0, nil, fmt.Errorf("%w: indefinite length is not supported", ErrMalformedCBOR)
+	}
+	return 0, nil, fmt.Errorf("%w: truncated header", ErrMalformedCBOR)
+}
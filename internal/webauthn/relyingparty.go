@@ -0,0 +1,427 @@
+package webauthn
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrInvalidSession         = errors.New("invalid or expired webauthn session")
+	ErrVerificationFailed     = errors.New("webauthn verification failed")
+	ErrUnsupportedAttestation = errors.New("unsupported attestation format")
+	ErrCloneDetected          = errors.New("authenticator sign counter did not increase")
+)
+
+// Config - параметры проверяющей стороны (Relying Party)
+type Config struct {
+	// RPID - домен сайта, на котором браузер вызывает navigator.credentials
+	RPID   string
+	RPName string
+	// Origins - адреса страниц, с которых разрешены церемонии
+	Origins []string
+	Timeout time.Duration
+	// UserVerification - "required", "preferred" или "discouraged"
+	UserVerification string
+}
+
+// User - владелец ключа в терминах WebAuthn
+type User struct {
+	ID          int
+	Name        string
+	DisplayName string
+}
+
+// Credential - зарегистрированный ключ. PublicKey хранится в формате COSE
+type Credential struct {
+	ID             []byte
+	PublicKey      []byte
+	SignCount      uint32
+	AAGUID         []byte
+	Transports     []string
+	BackupEligible bool
+	BackedUp       bool
+}
+
+// RelyingParty проводит церемонии регистрации и входа
+type RelyingParty struct {
+	cfg      Config
+	sessions SessionStore
+	rpIDHash [32]byte
+}
+
+func NewRelyingParty(cfg Config, sessions SessionStore) *RelyingParty {
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 5 * time.Minute
+	}
+	if cfg.UserVerification == "" {
+		cfg.UserVerification = "preferred"
+	}
+	return &RelyingParty{cfg: cfg, sessions: sessions, rpIDHash: sha256.Sum256([]byte(cfg.RPID))}
+}
+
+// Base64URL - бинарные поля WebAuthn в JSON (base64url без паддинга)
+type Base64URL []byte
+
+func (b Base64URL) MarshalJSON() ([]byte, error) {
+	return json.Marshal(base64.RawURLEncoding.EncodeToString(b))
+}
+
+func (b *Base64URL) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	decoded, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+	if err != nil {
+		return err
+	}
+	*b = decoded
+	return nil
+}
+
+// CredentialDescriptor - ссылка на ключ в allowCredentials и excludeCredentials
+type CredentialDescriptor struct {
+	Type       string    `json:"type"`
+	ID         Base64URL `json:"id"`
+	Transports []string  `json:"transports,omitempty"`
+}
+
+type credentialParameter struct {
+	Type string `json:"type"`
+	Alg  int    `json:"alg"`
+}
+
+// CreationOptions - publicKey для navigator.credentials.create, в формате
+// PublicKeyCredential.parseCreationOptionsFromJSON
+type CreationOptions struct {
+	RP struct {
+		ID   string `json:"id"`
+		Name string `json:"name"`
+	} `json:"rp"`
+	User struct {
+		ID          Base64URL `json:"id"`
+		Name        string    `json:"name"`
+		DisplayName string    `json:"displayName"`
+	} `json:"user"`
+	Challenge              Base64URL              `json:"challenge"`
+	PubKeyCredParams       []credentialParameter  `json:"pubKeyCredParams"`
+	Timeout                int64                  `json:"timeout"`
+	ExcludeCredentials     []CredentialDescriptor `json:"excludeCredentials"`
+	AuthenticatorSelection struct {
+		ResidentKey      string `json:"residentKey"`
+		UserVerification string `json:"userVerification"`
+	} `json:"authenticatorSelection"`
+	Attestation string `json:"attestation"`
+}
+
+// RequestOptions - publicKey для navigator.credentials.get
+type RequestOptions struct {
+	Challenge        Base64URL              `json:"challenge"`
+	Timeout          int64                  `json:"timeout"`
+	RPID             string                 `json:"rpId"`
+	AllowCredentials []CredentialDescriptor `json:"allowCredentials"`
+	UserVerification string                 `json:"userVerification"`
+}
+
+// RegistrationResponse - PublicKeyCredential из navigator.credentials.create (toJSON)
+type RegistrationResponse struct {
+	ID       string    `json:"id"`
+	RawID    Base64URL `json:"rawId"`
+	Type     string    `json:"type"`
+	Response struct {
+		ClientDataJSON    Base64URL `json:"clientDataJSON"`
+		AttestationObject Base64URL `json:"attestationObject"`
+		Transports        []string  `json:"transports"`
+	} `json:"response"`
+}
+
+// LoginResponse - PublicKeyCredential из navigator.credentials.get (toJSON)
+type LoginResponse struct {
+	ID       string    `json:"id"`
+	RawID    Base64URL `json:"rawId"`
+	Type     string    `json:"type"`
+	Response struct {
+		ClientDataJSON    Base64URL `json:"clientDataJSON"`
+		AuthenticatorData Base64URL `json:"authenticatorData"`
+		Signature         Base64URL `json:"signature"`
+		UserHandle        Base64URL `json:"userHandle"`
+	} `json:"response"`
+}
+
+// Assertion - результат проверки входа
+type Assertion struct {
+	// UserID - для кого начинали вход, 0 при входе без email
+	UserID    int
+	SignCount uint32
+	BackedUp  bool
+	// UserVerified - аутентификатор проверил PIN или биометрию, а не только касание
+	UserVerified bool
+}
+
+// UserHandle - user.id в WebAuthn. Это не email и не имя, а только id пользователя
+func UserHandle(userID int) []byte {
+	return []byte(strconv.Itoa(userID))
+}
+
+// BeginRegistration выдаёт параметры создания ключа. existing попадают в excludeCredentials,
+// чтобы один аутентификатор не регистрировался дважды
+func (rp *RelyingParty) BeginRegistration(ctx context.Context, user User, existing []Credential) (string, *CreationOptions, error) {
+	sessionID, challenge, err := rp.startCeremony(ctx, ceremonyRegistration, user.ID)
+	if err != nil {
+		return "", nil, err
+	}
+
+	options := &CreationOptions{
+		Challenge:          challenge,
+		Timeout:            rp.cfg.Timeout.Milliseconds(),
+		ExcludeCredentials: descriptors(existing),
+		Attestation:        "none",
+	}
+	options.RP.ID = rp.cfg.RPID
+	options.RP.Name = rp.cfg.RPName
+	options.User.ID = UserHandle(user.ID)
+	options.User.Name = user.Name
+	options.User.DisplayName = user.DisplayName
+	for _, alg := range SupportedAlgorithms {
+		options.PubKeyCredParams = append(options.PubKeyCredParams, credentialParameter{Type: "public-key", Alg: alg})
+	}
+	// Passkey - ключ, который аутентификатор хранит сам: вход без ввода email
+	options.AuthenticatorSelection.ResidentKey = "required"
+	options.AuthenticatorSelection.UserVerification = rp.cfg.UserVerification
+
+	return sessionID, options, nil
+}
+
+// FinishRegistration гасит церемонию и проверяет ответ браузера
+func (rp *RelyingParty) FinishRegistration(ctx context.Context, sessionID string, resp *RegistrationResponse) (int, *Credential, error) {
+	ceremony, err := rp.takeCeremony(ctx, sessionID, ceremonyRegistration)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	credential, err := rp.VerifyRegistration(ceremony.Challenge, resp)
+	if err != nil {
+		return 0, nil, err
+	}
+	return ceremony.UserID, credential, nil
+}
+
+// BeginLogin выдаёт параметры входа. userID == 0 - вход без email: браузер сам
+// предложит passkey для этого сайта
+func (rp *RelyingParty) BeginLogin(ctx context.Context, userID int, allowed []Credential) (string, *RequestOptions, error) {
+	sessionID, challenge, err := rp.startCeremony(ctx, ceremonyLogin, userID)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return sessionID, &RequestOptions{
+		Challenge:        challenge,
+		Timeout:          rp.cfg.Timeout.Milliseconds(),
+		RPID:             rp.cfg.RPID,
+		AllowCredentials: descriptors(allowed),
+		UserVerification: rp.cfg.UserVerification,
+	}, nil
+}
+
+// FinishLogin гасит церемонию и проверяет подпись ключом credential
+func (rp *RelyingParty) FinishLogin(ctx context.Context, sessionID string, resp *LoginResponse, credential *Credential) (*Assertion, error) {
+	ceremony, err := rp.takeCeremony(ctx, sessionID, ceremonyLogin)
+	if err != nil {
+		return nil, err
+	}
+
+	assertion, err := rp.VerifyAssertion(ceremony.Challenge, resp, credential)
+	if err != nil {
+		return nil, err
+	}
+	assertion.UserID = ceremony.UserID
+	return assertion, nil
+}
+
+// VerifyRegistration проверяет ответ navigator.credentials.create (WebAuthn, 7.1).
+// Принимается только аттестация "none": сервис не проверяет модели аутентификаторов
+func (rp *RelyingParty) VerifyRegistration(challenge []byte, resp *RegistrationResponse) (*Credential, error) {
+	if resp.Type != "public-key" {
+		return nil, fmt.Errorf("%w: credential type %q", ErrVerificationFailed, resp.Type)
+	}
+	if err := rp.verifyClientData(resp.Response.ClientDataJSON, "webauthn.create", challenge); err != nil {
+		return nil, err
+	}
+
+	raw, rest, err := decodeCBOR(resp.Response.AttestationObject)
+	if err != nil || len(rest) != 0 {
+		return nil, fmt.Errorf("%w: attestation object", ErrVerificationFailed)
+	}
+	attestation, ok := raw.(map[interface{}]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%w: attestation object", ErrVerificationFailed)
+	}
+	format, _ := attestation["fmt"].(string)
+	statement, _ := attestation["attStmt"].(map[interface{}]interface{})
+	rawAuthData, _ := attestation["authData"].([]byte)
+	if format != "none" || len(statement) != 0 {
+		return nil, fmt.Errorf("%w: %q", ErrUnsupportedAttestation, format)
+	}
+
+	authData, err := rp.verifyAuthenticatorData(rawAuthData)
+	if err != nil {
+		return nil, err
+	}
+	if !authData.has(flagAttestedData) {
+		return nil, fmt.Errorf("%w: no attested credential data", ErrVerificationFailed)
+	}
+	if !bytes.Equal(authData.credentialID, resp.RawID) {
+		return nil, fmt.Errorf("%w: credential id mismatch", ErrVerificationFailed)
+	}
+	if _, err := parsePublicKey(authData.publicKey); err != nil {
+		return nil, err
+	}
+
+	return &Credential{
+		ID:             append([]byte(nil), authData.credentialID...),
+		PublicKey:      append([]byte(nil), authData.publicKey...),
+		SignCount:      authData.signCount,
+		AAGUID:         append([]byte(nil), authData.aaguid...),
+		Transports:     resp.Response.Transports,
+		BackupEligible: authData.has(flagBackupEligible),
+		BackedUp:       authData.has(flagBackedUp),
+	}, nil
+}
+
+// VerifyAssertion проверяет ответ navigator.credentials.get (WebAuthn, 7.2).
+// Счётчик подписей должен расти: иначе ключ, скорее всего, скопирован. Синхронизируемые
+// passkeys счётчик не ведут и всегда присылают 0 - для них проверка пропускается
+func (rp *RelyingParty) VerifyAssertion(challenge []byte, resp *LoginResponse, credential *Credential) (*Assertion, error) {
+	if resp.Type != "public-key" {
+		return nil, fmt.Errorf("%w: credential type %q", ErrVerificationFailed, resp.Type)
+	}
+	if !bytes.Equal(resp.RawID, credential.ID) {
+		return nil, fmt.Errorf("%w: credential id mismatch", ErrVerificationFailed)
+	}
+	if err := rp.verifyClientData(resp.Response.ClientDataJSON, "webauthn.get", challenge); err != nil {
+		return nil, err
+	}
+
+	authData, err := rp.verifyAuthenticatorData(resp.Response.AuthenticatorData)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := parsePublicKey(credential.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	clientDataHash := sha256.Sum256(resp.Response.ClientDataJSON)
+	signed := append(append([]byte(nil), resp.Response.AuthenticatorData...), clientDataHash[:]...)
+	if !key.verify(signed, resp.Response.Signature) {
+		return nil, fmt.Errorf("%w: bad signature", ErrVerificationFailed)
+	}
+
+	if (authData.signCount != 0 || credential.SignCount != 0) && authData.signCount <= credential.SignCount {
+		return nil, ErrCloneDetected
+	}
+
+	return &Assertion{
+		SignCount:    authData.signCount,
+		BackedUp:     authData.has(flagBackedUp),
+		UserVerified: authData.has(flagUserVerified),
+	}, nil
+}
+
+// verifyClientData проверяет тип церемонии, challenge и origin из clientDataJSON
+func (rp *RelyingParty) verifyClientData(raw []byte, ceremonyType string, challenge []byte) error {
+	var clientData struct {
+		Type        string `json:"type"`
+		Challenge   string `json:"challenge"`
+		Origin      string `json:"origin"`
+		CrossOrigin bool   `json:"crossOrigin"`
+	}
+	if err := json.Unmarshal(raw, &clientData); err != nil {
+		return fmt.Errorf("%w: client data: %v", ErrVerificationFailed, err)
+	}
+
+	if clientData.Type != ceremonyType {
+		return fmt.Errorf("%w: client data type %q", ErrVerificationFailed, clientData.Type)
+	}
+	received, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(clientData.Challenge, "="))
+	if err != nil || subtle.ConstantTimeCompare(received, challenge) != 1 {
+		return fmt.Errorf("%w: challenge mismatch", ErrVerificationFailed)
+	}
+	if clientData.CrossOrigin {
+		return fmt.Errorf("%w: cross-origin ceremony", ErrVerificationFailed)
+	}
+	for _, origin := range rp.cfg.Origins {
+		if clientData.Origin == origin {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: origin %q is not allowed", ErrVerificationFailed, clientData.Origin)
+}
+
+// verifyAuthenticatorData проверяет rpIdHash и флаги присутствия и проверки пользователя
+func (rp *RelyingParty) verifyAuthenticatorData(raw []byte) (*authenticatorData, error) {
+	authData, err := parseAuthenticatorData(raw)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrVerificationFailed, err)
+	}
+	if !bytes.Equal(authData.rpIDHash, rp.rpIDHash[:]) {
+		return nil, fmt.Errorf("%w: rp id mismatch", ErrVerificationFailed)
+	}
+	if !authData.has(flagUserPresent) {
+		return nil, fmt.Errorf("%w: user not present", ErrVerificationFailed)
+	}
+	if rp.cfg.UserVerification == "required" && !authData.has(flagUserVerified) {
+		return nil, fmt.Errorf("%w: user not verified", ErrVerificationFailed)
+	}
+	return authData, nil
+}
+
+func (rp *RelyingParty) startCeremony(ctx context.Context, ceremonyType string, userID int) (string, []byte, error) {
+	challenge := make([]byte, 32)
+	if _, err := rand.Read(challenge); err != nil {
+		return "", nil, err
+	}
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", nil, err
+	}
+	sessionID := base64.RawURLEncoding.EncodeToString(id)
+
+	ceremony := &Ceremony{Type: ceremonyType, Challenge: challenge, UserID: userID}
+	if err := rp.sessions.Save(ctx, sessionID, ceremony, rp.cfg.Timeout); err != nil {
+		return "", nil, err
+	}
+	return sessionID, challenge, nil
+}
+
+func (rp *RelyingParty) takeCeremony(ctx context.Context, sessionID, ceremonyType string) (*Ceremony, error) {
+	if sessionID == "" {
+		return nil, ErrInvalidSession
+	}
+	ceremony, err := rp.sessions.Take(ctx, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	if ceremony == nil || ceremony.Type != ceremonyType {
+		return nil, ErrInvalidSession
+	}
+	return ceremony, nil
+}
+
+func descriptors(credentials []Credential) []CredentialDescriptor {
+	result := []CredentialDescriptor{}
+	for _, c := range credentials {
+		result = append(result, CredentialDescriptor{Type: "public-key", ID: c.ID, Transports: c.Transports})
+	}
+	return result
+}
@@ -0,0 +1,360 @@
+package webauthn
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+const (
+	testRPID   = "example.com"
+	testOrigin = "https://example.com"
+)
+
+func newTestRelyingParty(userVerification string) *RelyingParty {
+	return NewRelyingParty(Config{
+		RPID:             testRPID,
+		RPName:           "Example",
+		Origins:          []string{testOrigin},
+		UserVerification: userVerification,
+	}, NewSessionStore(nil))
+}
+
+// softAuthenticator - программный аутентификатор с ключом P-256 в памяти
+type softAuthenticator struct {
+	t            *testing.T
+	key          *ecdsa.PrivateKey
+	credentialID []byte
+	signCount    uint32
+}
+
+func newSoftAuthenticator(t *testing.T) *softAuthenticator {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		t.Fatal(err)
+	}
+	return &softAuthenticator{t: t, key: key, credentialID: id}
+}
+
+// ceremony - то, что браузер и аутентификатор кладут в ответ. Тесты портят отдельные поля
+type ceremony struct {
+	typ       string
+	challenge []byte
+	origin    string
+	rpID      string
+	flags     byte
+}
+
+func (a *softAuthenticator) clientData(c ceremony) []byte {
+	a.t.Helper()
+
+	data, err := json.Marshal(map[string]interface{}{
+		"type":        c.typ,
+		"challenge":   base64.RawURLEncoding.EncodeToString(c.challenge),
+		"origin":      c.origin,
+		"crossOrigin": false,
+	})
+	if err != nil {
+		a.t.Fatal(err)
+	}
+	return data
+}
+
+func (a *softAuthenticator) authenticatorData(c ceremony, attested []byte) []byte {
+	rpIDHash := sha256.Sum256([]byte(c.rpID))
+	data := append([]byte(nil), rpIDHash[:]...)
+	data = append(data, c.flags)
+	data = binary.BigEndian.AppendUint32(data, a.signCount)
+	return append(data, attested...)
+}
+
+// coseKey - публичный ключ в формате COSE_Key (EC2, ES256)
+func (a *softAuthenticator) coseKey() []byte {
+	size := 32
+	return cborMap(
+		cborInt(coseKty), cborInt(coseKtyEC2),
+		cborInt(coseAlg), cborInt(AlgES256),
+		cborInt(coseCrvOrN), cborInt(coseCrvP256),
+		cborInt(coseXOrE), cborBytes(a.key.X.FillBytes(make([]byte, size))),
+		cborInt(coseY), cborBytes(a.key.Y.FillBytes(make([]byte, size))),
+	)
+}
+
+// create - ответ navigator.credentials.create с аттестацией "none"
+func (a *softAuthenticator) create(c ceremony) *RegistrationResponse {
+	attested := make([]byte, 16) // AAGUID
+	attested = binary.BigEndian.AppendUint16(attested, uint16(len(a.credentialID)))
+	attested = append(attested, a.credentialID...)
+	attested = append(attested, a.coseKey()...)
+
+	resp := &RegistrationResponse{
+		ID:    base64.RawURLEncoding.EncodeToString(a.credentialID),
+		RawID: a.credentialID,
+		Type:  "public-key",
+	}
+	resp.Response.ClientDataJSON = a.clientData(c)
+	resp.Response.AttestationObject = cborMap(
+		cborText("fmt"), cborText("none"),
+		cborText("attStmt"), cborMap(),
+		cborText("authData"), cborBytes(a.authenticatorData(c, attested)),
+	)
+	resp.Response.Transports = []string{"internal"}
+	return resp
+}
+
+// get - ответ navigator.credentials.get: подпись authenticatorData || SHA-256(clientDataJSON)
+func (a *softAuthenticator) get(c ceremony) *LoginResponse {
+	a.t.Helper()
+
+	authData := a.authenticatorData(c, nil)
+	clientData := a.clientData(c)
+	clientDataHash := sha256.Sum256(clientData)
+	digest := sha256.Sum256(append(append([]byte(nil), authData...), clientDataHash[:]...))
+	signature, err := ecdsa.SignASN1(rand.Reader, a.key, digest[:])
+	if err != nil {
+		a.t.Fatal(err)
+	}
+
+	resp := &LoginResponse{
+		ID:    base64.RawURLEncoding.EncodeToString(a.credentialID),
+		RawID: a.credentialID,
+		Type:  "public-key",
+	}
+	resp.Response.ClientDataJSON = clientData
+	resp.Response.AuthenticatorData = authData
+	resp.Response.Signature = signature
+	return resp
+}
+
+// Минимальный кодировщик CBOR: только то, что нужно аутентификатору
+func cborHead(major byte, n uint64) []byte {
+	switch {
+	case n < 24:
+		return []byte{major<<5 | byte(n)}
+	case n <= 0xff:
+		return []byte{major<<5 | 24, byte(n)}
+	case n <= 0xffff:
+		return binary.BigEndian.AppendUint16([]byte{major<<5 | 25}, uint16(n))
+	}
+	return binary.BigEndian.AppendUint32([]byte{major<<5 | 26}, uint32(n))
+}
+
+func cborInt(v int) []byte {
+	if v < 0 {
+		return cborHead(1, uint64(-1-v))
+	}
+	return cborHead(0, uint64(v))
+}
+
+func cborBytes(b []byte) []byte {
+	return append(cborHead(2, uint64(len(b))), b...)
+}
+
+func cborText(s string) []byte {
+	return append(cborHead(3, uint64(len(s))), s...)
+}
+
+// cborMap собирает map из уже закодированных ключей и значений, идущих парами
+func cborMap(items ...[]byte) []byte {
+	data := cborHead(5, uint64(len(items)/2))
+	for _, item := range items {
+		data = append(data, item...)
+	}
+	return data
+}
+
+func registrationCeremony(challenge []byte) ceremony {
+	return ceremony{
+		typ:       "webauthn.create",
+		challenge: challenge,
+		origin:    testOrigin,
+		rpID:      testRPID,
+		flags:     flagUserPresent | flagUserVerified | flagAttestedData,
+	}
+}
+
+func loginCeremony(challenge []byte) ceremony {
+	return ceremony{
+		typ:       "webauthn.get",
+		challenge: challenge,
+		origin:    testOrigin,
+		rpID:      testRPID,
+		flags:     flagUserPresent | flagUserVerified,
+	}
+}
+
+func TestRegistrationAndLogin(t *testing.T) {
+	rp := newTestRelyingParty("preferred")
+	authenticator := newSoftAuthenticator(t)
+	ctx := context.Background()
+
+	sessionID, creation, err := rp.BeginRegistration(ctx, User{ID: 42, Name: "user@example.com"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	userID, credential, err := rp.FinishRegistration(ctx, sessionID, authenticator.create(registrationCeremony(creation.Challenge)))
+	if err != nil {
+		t.Fatalf("FinishRegistration: %v", err)
+	}
+	if userID != 42 {
+		t.Errorf("registration user = %d, want 42", userID)
+	}
+	if string(credential.ID) != string(authenticator.credentialID) {
+		t.Errorf("credential id = %x, want %x", credential.ID, authenticator.credentialID)
+	}
+
+	// Церемония одноразовая
+	if _, _, err := rp.FinishRegistration(ctx, sessionID, authenticator.create(registrationCeremony(creation.Challenge))); !errors.Is(err, ErrInvalidSession) {
+		t.Errorf("reused registration session: err = %v, want ErrInvalidSession", err)
+	}
+
+	authenticator.signCount = 1
+	sessionID, request, err := rp.BeginLogin(ctx, 42, []Credential{*credential})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertion, err := rp.FinishLogin(ctx, sessionID, authenticator.get(loginCeremony(request.Challenge)), credential)
+	if err != nil {
+		t.Fatalf("FinishLogin: %v", err)
+	}
+	if assertion.UserID != 42 || assertion.SignCount != 1 || !assertion.UserVerified {
+		t.Errorf("assertion = %+v, want user 42, sign count 1, user verified", assertion)
+	}
+
+	// Сессия регистрации не подходит для входа
+	sessionID, _, err = rp.BeginRegistration(ctx, User{ID: 42}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rp.FinishLogin(ctx, sessionID, authenticator.get(loginCeremony(request.Challenge)), credential); !errors.Is(err, ErrInvalidSession) {
+		t.Errorf("registration session used for login: err = %v, want ErrInvalidSession", err)
+	}
+}
+
+func TestVerifyRegistrationRejects(t *testing.T) {
+	challenge := []byte("registration-challenge-0123456789")
+
+	tests := []struct {
+		name             string
+		userVerification string
+		tamper           func(c *ceremony)
+	}{
+		{"challenge mismatch", "preferred", func(c *ceremony) { c.challenge = []byte("other-challenge") }},
+		{"origin mismatch", "preferred", func(c *ceremony) { c.origin = "https://evil.example.com" }},
+		{"wrong ceremony type", "preferred", func(c *ceremony) { c.typ = "webauthn.get" }},
+		{"rp id mismatch", "preferred", func(c *ceremony) { c.rpID = "evil.example.com" }},
+		{"user not present", "preferred", func(c *ceremony) { c.flags &^= flagUserPresent }},
+		{"user not verified", "required", func(c *ceremony) { c.flags &^= flagUserVerified }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rp := newTestRelyingParty(tt.userVerification)
+			c := registrationCeremony(challenge)
+			tt.tamper(&c)
+
+			_, err := rp.VerifyRegistration(challenge, newSoftAuthenticator(t).create(c))
+			if !errors.Is(err, ErrVerificationFailed) {
+				t.Fatalf("err = %v, want ErrVerificationFailed", err)
+			}
+		})
+	}
+}
+
+func TestVerifyAssertionRejects(t *testing.T) {
+	challenge := []byte("login-challenge-0123456789abcdef")
+
+	tests := []struct {
+		name             string
+		userVerification string
+		tamper           func(c *ceremony)
+	}{
+		{"challenge mismatch", "preferred", func(c *ceremony) { c.challenge = []byte("other-challenge") }},
+		{"origin mismatch", "preferred", func(c *ceremony) { c.origin = "https://evil.example.com" }},
+		{"wrong ceremony type", "preferred", func(c *ceremony) { c.typ = "webauthn.create" }},
+		{"rp id mismatch", "preferred", func(c *ceremony) { c.rpID = "evil.example.com" }},
+		{"user not present", "preferred", func(c *ceremony) { c.flags &^= flagUserPresent }},
+		{"user not verified", "required", func(c *ceremony) { c.flags &^= flagUserVerified }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rp := newTestRelyingParty(tt.userVerification)
+			authenticator := newSoftAuthenticator(t)
+			credential := &Credential{ID: authenticator.credentialID, PublicKey: authenticator.coseKey()}
+
+			authenticator.signCount = 1
+			c := loginCeremony(challenge)
+			tt.tamper(&c)
+
+			_, err := rp.VerifyAssertion(challenge, authenticator.get(c), credential)
+			if !errors.Is(err, ErrVerificationFailed) {
+				t.Fatalf("err = %v, want ErrVerificationFailed", err)
+			}
+		})
+	}
+}
+
+func TestVerifyAssertionRejectsForeignKey(t *testing.T) {
+	rp := newTestRelyingParty("preferred")
+	challenge := []byte("login-challenge-0123456789abcdef")
+
+	owner := newSoftAuthenticator(t)
+	credential := &Credential{ID: owner.credentialID, PublicKey: owner.coseKey()}
+
+	// Тот же id ключа, но подпись чужим ключом
+	impostor := newSoftAuthenticator(t)
+	impostor.credentialID = owner.credentialID
+
+	_, err := rp.VerifyAssertion(challenge, impostor.get(loginCeremony(challenge)), credential)
+	if !errors.Is(err, ErrVerificationFailed) {
+		t.Fatalf("err = %v, want ErrVerificationFailed", err)
+	}
+}
+
+func TestVerifyAssertionSignCounter(t *testing.T) {
+	challenge := []byte("login-challenge-0123456789abcdef")
+
+	tests := []struct {
+		name    string
+		stored  uint32
+		current uint32
+		wantErr error
+	}{
+		{"counter increased", 5, 6, nil},
+		{"counter regressed", 5, 3, ErrCloneDetected},
+		{"counter repeated", 5, 5, ErrCloneDetected},
+		{"counter reset to zero", 5, 0, ErrCloneDetected},
+		{"synced passkey without counter", 0, 0, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rp := newTestRelyingParty("preferred")
+			authenticator := newSoftAuthenticator(t)
+			credential := &Credential{ID: authenticator.credentialID, PublicKey: authenticator.coseKey(), SignCount: tt.stored}
+
+			authenticator.signCount = tt.current
+			assertion, err := rp.VerifyAssertion(challenge, authenticator.get(loginCeremony(challenge)), credential)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && assertion.SignCount != tt.current {
+				t.Errorf("SignCount = %d, want %d", assertion.SignCount, tt.current)
+			}
+		})
+	}
+}
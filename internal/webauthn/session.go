@@ -0,0 +1,102 @@
+package webauthn
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"auth-user-service/internal/redis"
+)
+
+// Типы церемоний
+const (
+	ceremonyRegistration = "registration"
+	ceremonyLogin        = "login"
+)
+
+// Ceremony - начатая регистрация или вход: challenge и для кого он выдан
+type Ceremony struct {
+	Type      string `json:"type"`
+	Challenge []byte `json:"challenge"`
+	// UserID - владелец ключа. При входе без email (discoverable credentials) 0
+	UserID int `json:"user_id,omitempty"`
+}
+
+// SessionStore хранит церемонии до ответа браузера. Take одноразовый:
+// challenge нельзя использовать повторно
+type SessionStore interface {
+	Save(ctx context.Context, id string, ceremony *Ceremony, ttl time.Duration) error
+	Take(ctx context.Context, id string) (*Ceremony, error)
+}
+
+// NewSessionStore возвращает хранилище в Redis, а без Redis - в памяти процесса
+func NewSessionStore(redisClient *redis.Client) SessionStore {
+	if redisClient == nil {
+		log.Println("⚠️ Redis unavailable: WebAuthn challenges are kept in memory of this instance only")
+		return &memorySessionStore{ceremonies: make(map[string]memoryCeremony)}
+	}
+	return &redisSessionStore{redis: redisClient}
+}
+
+type redisSessionStore struct {
+	redis *redis.Client
+}
+
+func sessionKey(id string) string {
+	return fmt.Sprintf("webauthn_session:%s", id)
+}
+
+func (s *redisSessionStore) Save(ctx context.Context, id string, ceremony *Ceremony, ttl time.Duration) error {
+	return s.redis.Set(ctx, sessionKey(id), ceremony, ttl)
+}
+
+func (s *redisSessionStore) Take(ctx context.Context, id string) (*Ceremony, error) {
+	var ceremony Ceremony
+	err := s.redis.Take(ctx, sessionKey(id), &ceremony)
+	if errors.Is(err, redis.ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &ceremony, nil
+}
+
+type memorySessionStore struct {
+	mu         sync.Mutex
+	ceremonies map[string]memoryCeremony
+}
+
+type memoryCeremony struct {
+	ceremony  Ceremony
+	expiresAt time.Time
+}
+
+func (s *memorySessionStore) Save(_ context.Context, id string, ceremony *Ceremony, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for key, c := range s.ceremonies {
+		if now.After(c.expiresAt) {
+			delete(s.ceremonies, key)
+		}
+	}
+	s.ceremonies[id] = memoryCeremony{ceremony: *ceremony, expiresAt: now.Add(ttl)}
+	return nil
+}
+
+func (s *memorySessionStore) Take(_ context.Context, id string) (*Ceremony, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c, ok := s.ceremonies[id]
+	delete(s.ceremonies, id)
+	if !ok || time.Now().After(c.expiresAt) {
+		return nil, nil
+	}
+	return &c.ceremony, nil
+}
@@ -0,0 +1,13 @@
+-- Revert refresh token rotation columns
+DROP INDEX IF EXISTS idx_auth_tokens_family_id;
+DROP INDEX IF EXISTS idx_auth_tokens_token_hash;
+
+ALTER TABLE auth_tokens
+    DROP COLUMN revoked_at,
+    DROP COLUMN used_at,
+    DROP COLUMN family_id,
+    ALTER COLUMN token_hash TYPE VARCHAR(500);
+
+ALTER TABLE auth_tokens RENAME COLUMN token_hash TO token;
+
+CREATE INDEX idx_auth_tokens_token ON auth_tokens(token);
@@ -0,0 +1,17 @@
+-- Refresh-токены храним только в виде SHA-256 хеша и объединяем в семейства для ротации.
+-- До этой миграции таблица не заполнялась, поэтому старые записи можно удалить.
+DELETE FROM auth_tokens;
+
+DROP INDEX IF EXISTS idx_auth_tokens_token;
+
+ALTER TABLE auth_tokens RENAME COLUMN token TO token_hash;
+
+ALTER TABLE auth_tokens
+    ALTER COLUMN token_hash TYPE VARCHAR(64),
+    ADD COLUMN family_id VARCHAR(64) NOT NULL,
+    ADD COLUMN used_at TIMESTAMP,
+    ADD COLUMN revoked_at TIMESTAMP;
+
+-- Indexes for rotation and family revocation
+CREATE UNIQUE INDEX idx_auth_tokens_token_hash ON auth_tokens(token_hash);
+CREATE INDEX idx_auth_tokens_family_id ON auth_tokens(family_id);
@@ -0,0 +1,13 @@
+-- Create password_reset_tokens table
+CREATE TABLE password_reset_tokens (
+                                       id SERIAL PRIMARY KEY,
+                                       user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+                                       token_hash VARCHAR(64) NOT NULL,
+                                       expires_at TIMESTAMP NOT NULL,
+                                       used_at TIMESTAMP,
+                                       created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Indexes for password reset tokens
+CREATE UNIQUE INDEX idx_password_reset_tokens_token_hash ON password_reset_tokens(token_hash);
+CREATE INDEX idx_password_reset_tokens_user_id ON password_reset_tokens(user_id);
@@ -0,0 +1,5 @@
+-- Remove email verification
+DROP TABLE IF EXISTS email_verification_tokens;
+
+ALTER TABLE users
+DROP COLUMN email_verified_at;
@@ -0,0 +1,17 @@
+-- Add email verification status to users table
+ALTER TABLE users
+    ADD COLUMN email_verified_at TIMESTAMP;
+
+-- Create email_verification_tokens table
+CREATE TABLE email_verification_tokens (
+                                           id SERIAL PRIMARY KEY,
+                                           user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+                                           token_hash VARCHAR(64) NOT NULL,
+                                           expires_at TIMESTAMP NOT NULL,
+                                           used_at TIMESTAMP,
+                                           created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Indexes for email verification tokens
+CREATE UNIQUE INDEX idx_email_verification_tokens_token_hash ON email_verification_tokens(token_hash);
+CREATE INDEX idx_email_verification_tokens_user_id ON email_verification_tokens(user_id);
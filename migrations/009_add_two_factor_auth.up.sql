@@ -0,0 +1,17 @@
+-- Add TOTP two-factor authentication to users table
+ALTER TABLE users
+    ADD COLUMN totp_secret VARCHAR(64),
+    ADD COLUMN totp_enabled_at TIMESTAMP,
+    ADD COLUMN totp_last_step BIGINT NOT NULL DEFAULT 0;
+
+-- Create user_recovery_codes table
+CREATE TABLE user_recovery_codes (
+                                     id SERIAL PRIMARY KEY,
+                                     user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+                                     code_hash VARCHAR(255) NOT NULL,
+                                     used_at TIMESTAMP,
+                                     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Index for recovery codes
+CREATE INDEX idx_user_recovery_codes_user_id ON user_recovery_codes(user_id);
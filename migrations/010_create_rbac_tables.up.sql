@@ -0,0 +1,52 @@
+-- Create roles table
+CREATE TABLE roles (
+                       id SERIAL PRIMARY KEY,
+                       name VARCHAR(50) UNIQUE NOT NULL,
+                       description TEXT,
+                       created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Create permissions table
+CREATE TABLE permissions (
+                             id SERIAL PRIMARY KEY,
+                             name VARCHAR(100) UNIQUE NOT NULL,
+                             description TEXT,
+                             created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Create role_permissions table
+CREATE TABLE role_permissions (
+                                  role_id INTEGER NOT NULL REFERENCES roles(id) ON DELETE CASCADE,
+                                  permission_id INTEGER NOT NULL REFERENCES permissions(id) ON DELETE CASCADE,
+                                  PRIMARY KEY (role_id, permission_id)
+);
+
+-- Create user_roles table
+CREATE TABLE user_roles (
+                            user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+                            role_id INTEGER NOT NULL REFERENCES roles(id) ON DELETE CASCADE,
+                            created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+                            PRIMARY KEY (user_id, role_id)
+);
+
+-- Index for role lookups
+CREATE INDEX idx_user_roles_role_id ON user_roles(role_id);
+
+-- Default roles and permissions
+INSERT INTO roles (name, description) VALUES
+    ('admin', 'Full access to staff tooling'),
+    ('support', 'Customer support staff');
+
+INSERT INTO permissions (name, description) VALUES
+    ('users:read', 'View user accounts'),
+    ('users:write', 'Modify user accounts'),
+    ('roles:assign', 'Assign and revoke roles'),
+    ('sessions:revoke', 'Revoke user sessions'),
+    ('orders:read_all', 'View orders of all users');
+
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT r.id, p.id FROM roles r CROSS JOIN permissions p WHERE r.name = 'admin';
+
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT r.id, p.id FROM roles r JOIN permissions p ON p.name IN ('users:read', 'sessions:revoke', 'orders:read_all')
+WHERE r.name = 'support';
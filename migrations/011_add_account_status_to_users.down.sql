@@ -0,0 +1,7 @@
+-- Remove account status flags from users table
+DROP INDEX IF EXISTS idx_users_disabled_at;
+DROP INDEX IF EXISTS idx_users_created_at;
+
+ALTER TABLE users
+DROP COLUMN password_reset_required,
+DROP COLUMN disabled_at;
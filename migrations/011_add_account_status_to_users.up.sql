@@ -0,0 +1,8 @@
+-- Add account status flags to users table
+ALTER TABLE users
+    ADD COLUMN disabled_at TIMESTAMP,
+    ADD COLUMN password_reset_required BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- Indexes for admin search
+CREATE INDEX idx_users_created_at ON users(created_at DESC);
+CREATE INDEX idx_users_disabled_at ON users(disabled_at) WHERE disabled_at IS NOT NULL;
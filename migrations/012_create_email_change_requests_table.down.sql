@@ -0,0 +1,2 @@
+-- Drop email_change_requests table
+DROP TABLE IF EXISTS email_change_requests;
@@ -0,0 +1,14 @@
+-- Create email_change_requests table
+CREATE TABLE email_change_requests (
+                                       id SERIAL PRIMARY KEY,
+                                       user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+                                       new_email VARCHAR(255) NOT NULL,
+                                       token_hash VARCHAR(64) NOT NULL,
+                                       expires_at TIMESTAMP NOT NULL,
+                                       used_at TIMESTAMP,
+                                       created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Indexes for email change requests
+CREATE UNIQUE INDEX idx_email_change_requests_token_hash ON email_change_requests(token_hash);
+CREATE INDEX idx_email_change_requests_user_id ON email_change_requests(user_id);
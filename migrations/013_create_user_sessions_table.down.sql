@@ -0,0 +1,2 @@
+-- Drop user_sessions table
+DROP TABLE IF EXISTS user_sessions;
@@ -0,0 +1,22 @@
+-- Create user_sessions table: one row per refresh-token family (login on a device)
+CREATE TABLE user_sessions (
+                               id VARCHAR(64) PRIMARY KEY,
+                               user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+                               user_agent TEXT NOT NULL DEFAULT '',
+                               ip_address VARCHAR(45) NOT NULL DEFAULT '',
+                               created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+                               last_used_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+                               expires_at TIMESTAMP NOT NULL,
+                               revoked_at TIMESTAMP
+);
+
+-- Indexes for user sessions
+CREATE INDEX idx_user_sessions_user_id ON user_sessions(user_id);
+
+-- Existing active token families become sessions without device details
+INSERT INTO user_sessions (id, user_id, created_at, last_used_at, expires_at)
+SELECT family_id, user_id, MIN(created_at), MAX(created_at), MAX(expires_at)
+FROM auth_tokens
+WHERE revoked_at IS NULL
+GROUP BY family_id, user_id
+HAVING MAX(expires_at) > NOW();
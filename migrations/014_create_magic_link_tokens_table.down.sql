@@ -0,0 +1,2 @@
+-- Drop magic_link_tokens table
+DROP TABLE IF EXISTS magic_link_tokens;
@@ -0,0 +1,13 @@
+-- Create magic_link_tokens table: links are bound to an email, the account may not exist yet (auto-registration)
+CREATE TABLE magic_link_tokens (
+                                   id SERIAL PRIMARY KEY,
+                                   email VARCHAR(255) NOT NULL,
+                                   token_hash VARCHAR(64) NOT NULL,
+                                   expires_at TIMESTAMP NOT NULL,
+                                   used_at TIMESTAMP,
+                                   created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Indexes for magic link tokens
+CREATE UNIQUE INDEX idx_magic_link_tokens_token_hash ON magic_link_tokens(token_hash);
+CREATE INDEX idx_magic_link_tokens_email ON magic_link_tokens(email);
@@ -0,0 +1,14 @@
+-- Create user_identities table: accounts of external login providers linked to users
+CREATE TABLE user_identities (
+                                 id SERIAL PRIMARY KEY,
+                                 user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+                                 provider VARCHAR(50) NOT NULL,
+                                 subject VARCHAR(255) NOT NULL,
+                                 email VARCHAR(255) NOT NULL DEFAULT '',
+                                 created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+                                 last_login_at TIMESTAMP
+);
+
+-- One external account links to one user, and a user has one account per provider
+CREATE UNIQUE INDEX idx_user_identities_provider_subject ON user_identities(provider, subject);
+CREATE UNIQUE INDEX idx_user_identities_user_provider ON user_identities(user_id, provider);
@@ -0,0 +1,10 @@
+-- Drop oauth_clients table and OAuth client columns of user_sessions
+DELETE FROM permissions WHERE name = 'clients:manage';
+
+DROP INDEX IF EXISTS idx_user_sessions_client_id;
+
+ALTER TABLE user_sessions
+DROP COLUMN scope,
+DROP COLUMN client_id;
+
+DROP TABLE IF EXISTS oauth_clients;
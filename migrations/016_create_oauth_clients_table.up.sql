@@ -0,0 +1,22 @@
+-- Create oauth_clients table: our other apps that sign users in through this service (OIDC)
+CREATE TABLE oauth_clients (
+                               id VARCHAR(64) PRIMARY KEY,
+                               name VARCHAR(255) NOT NULL,
+                               secret_hash VARCHAR(64),
+                               redirect_uris TEXT[] NOT NULL,
+                               created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Sessions opened for an OAuth client; refresh tokens are accepted only from that client
+ALTER TABLE user_sessions
+    ADD COLUMN client_id VARCHAR(64),
+    ADD COLUMN scope TEXT NOT NULL DEFAULT '';
+
+CREATE INDEX idx_user_sessions_client_id ON user_sessions(client_id) WHERE client_id IS NOT NULL;
+
+INSERT INTO permissions (name, description) VALUES
+    ('clients:manage', 'Register and delete OAuth clients');
+
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT r.id, p.id FROM roles r JOIN permissions p ON p.name = 'clients:manage'
+WHERE r.name = 'admin';
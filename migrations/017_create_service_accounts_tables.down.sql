@@ -0,0 +1,5 @@
+-- Drop service_accounts and api_keys tables
+DELETE FROM permissions WHERE name = 'service_accounts:manage';
+
+DROP TABLE IF EXISTS api_keys;
+DROP TABLE IF EXISTS service_accounts;
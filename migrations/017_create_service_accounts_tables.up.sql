@@ -0,0 +1,31 @@
+-- Create service_accounts table: non-human clients (background jobs, integrations)
+CREATE TABLE service_accounts (
+                                  id SERIAL PRIMARY KEY,
+                                  name VARCHAR(255) NOT NULL,
+                                  scopes TEXT[] NOT NULL DEFAULT '{}',
+                                  created_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+                                  created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+                                  disabled_at TIMESTAMP
+);
+
+-- Create api_keys table: only a SHA-256 hash of the key is stored
+CREATE TABLE api_keys (
+                          id VARCHAR(32) PRIMARY KEY,
+                          service_account_id INTEGER NOT NULL REFERENCES service_accounts(id) ON DELETE CASCADE,
+                          name VARCHAR(255) NOT NULL DEFAULT '',
+                          prefix VARCHAR(16) NOT NULL,
+                          key_hash VARCHAR(64) UNIQUE NOT NULL,
+                          expires_at TIMESTAMP,
+                          last_used_at TIMESTAMP,
+                          revoked_at TIMESTAMP,
+                          created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_api_keys_service_account_id ON api_keys(service_account_id);
+
+INSERT INTO permissions (name, description) VALUES
+    ('service_accounts:manage', 'Create service accounts and manage their API keys');
+
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT r.id, p.id FROM roles r JOIN permissions p ON p.name = 'service_accounts:manage'
+WHERE r.name = 'admin';
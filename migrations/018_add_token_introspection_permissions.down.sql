@@ -0,0 +1,2 @@
+-- Drop token introspection permissions
+DELETE FROM permissions WHERE name IN ('tokens:introspect', 'tokens:revoke');
@@ -0,0 +1,8 @@
+-- Permissions for service accounts calling /oauth/introspect and /oauth/revoke
+INSERT INTO permissions (name, description) VALUES
+    ('tokens:introspect', 'Check whether access and refresh tokens are active'),
+    ('tokens:revoke', 'Revoke access and refresh tokens');
+
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT r.id, p.id FROM roles r JOIN permissions p ON p.name IN ('tokens:introspect', 'tokens:revoke')
+WHERE r.name = 'admin';
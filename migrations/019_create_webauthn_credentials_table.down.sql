@@ -0,0 +1,5 @@
+-- Drop webauthn_credentials table and passkey-only flag
+ALTER TABLE users
+DROP COLUMN passkey_only;
+
+DROP TABLE IF EXISTS webauthn_credentials;
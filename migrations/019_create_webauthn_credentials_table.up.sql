@@ -0,0 +1,21 @@
+-- Create webauthn_credentials table: passkeys registered by users
+CREATE TABLE webauthn_credentials (
+                                      id SERIAL PRIMARY KEY,
+                                      user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+                                      credential_id BYTEA NOT NULL UNIQUE,
+                                      public_key BYTEA NOT NULL,
+                                      sign_count BIGINT NOT NULL DEFAULT 0,
+                                      aaguid BYTEA,
+                                      transports TEXT[] NOT NULL DEFAULT '{}',
+                                      name VARCHAR(100) NOT NULL DEFAULT '',
+                                      backup_eligible BOOLEAN NOT NULL DEFAULT FALSE,
+                                      backed_up BOOLEAN NOT NULL DEFAULT FALSE,
+                                      created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+                                      last_used_at TIMESTAMP
+);
+
+CREATE INDEX idx_webauthn_credentials_user_id ON webauthn_credentials(user_id);
+
+-- Users who opted in to passkeys only can no longer sign in with a password
+ALTER TABLE users
+    ADD COLUMN passkey_only BOOLEAN NOT NULL DEFAULT FALSE;
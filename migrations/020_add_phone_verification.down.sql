@@ -0,0 +1,5 @@
+-- Remove phone verification from user_profiles
+DROP INDEX IF EXISTS idx_user_profiles_verified_phone;
+
+ALTER TABLE user_profiles
+DROP COLUMN phone_verified_at;
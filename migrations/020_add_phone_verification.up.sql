@@ -0,0 +1,6 @@
+-- Add phone verification to user_profiles
+ALTER TABLE user_profiles
+    ADD COLUMN phone_verified_at TIMESTAMP;
+
+-- A verified phone signs in to exactly one account
+CREATE UNIQUE INDEX idx_user_profiles_verified_phone ON user_profiles(phone) WHERE phone_verified_at IS NOT NULL;
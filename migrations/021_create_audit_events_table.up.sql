@@ -0,0 +1,37 @@
+-- Create audit_events table: append-only journal of security events.
+-- No foreign keys: events must outlive the accounts they describe
+CREATE TABLE audit_events (
+                              id BIGSERIAL PRIMARY KEY,
+                              type VARCHAR(64) NOT NULL,
+                              user_id INTEGER,
+                              actor_id INTEGER,
+                              ip_address VARCHAR(64) NOT NULL DEFAULT '',
+                              user_agent VARCHAR(512) NOT NULL DEFAULT '',
+                              request_id VARCHAR(128) NOT NULL DEFAULT '',
+                              metadata JSONB,
+                              created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_audit_events_user_id ON audit_events(user_id, created_at DESC);
+CREATE INDEX idx_audit_events_actor_id ON audit_events(actor_id, created_at DESC) WHERE actor_id IS NOT NULL;
+CREATE INDEX idx_audit_events_type ON audit_events(type, created_at DESC);
+CREATE INDEX idx_audit_events_created_at ON audit_events(created_at DESC);
+
+-- Rows can only be added: updates and deletes are rejected
+CREATE FUNCTION audit_events_append_only() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'audit_events is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER audit_events_append_only
+    BEFORE UPDATE OR DELETE ON audit_events
+    FOR EACH ROW EXECUTE FUNCTION audit_events_append_only();
+
+-- Permission to read the audit log
+INSERT INTO permissions (name, description) VALUES
+    ('audit:read', 'Read the security audit log');
+
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT r.id, p.id FROM roles r JOIN permissions p ON p.name = 'audit:read'
+WHERE r.name = 'admin';
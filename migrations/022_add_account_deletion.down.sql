@@ -0,0 +1,15 @@
+-- Remove scheduled account deletion. Anonymized orders have no owner and cannot be kept
+DELETE FROM orders WHERE user_id IS NULL;
+
+ALTER TABLE orders
+DROP CONSTRAINT orders_user_id_fkey,
+DROP COLUMN anonymized_at;
+
+ALTER TABLE orders
+    ALTER COLUMN user_id SET NOT NULL,
+    ADD CONSTRAINT orders_user_id_fkey FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE;
+
+DROP INDEX IF EXISTS idx_users_deletion_scheduled_at;
+
+ALTER TABLE users
+DROP COLUMN deletion_scheduled_at;
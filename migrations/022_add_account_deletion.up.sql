@@ -0,0 +1,14 @@
+-- Add scheduled account deletion to users table
+ALTER TABLE users
+    ADD COLUMN deletion_scheduled_at TIMESTAMP;
+
+CREATE INDEX idx_users_deletion_scheduled_at ON users(deletion_scheduled_at) WHERE deletion_scheduled_at IS NOT NULL;
+
+-- Orders outlive deleted accounts: the owner is detached and personal data removed
+ALTER TABLE orders
+    DROP CONSTRAINT orders_user_id_fkey;
+
+ALTER TABLE orders
+    ALTER COLUMN user_id DROP NOT NULL,
+    ADD CONSTRAINT orders_user_id_fkey FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE SET NULL,
+    ADD COLUMN anonymized_at TIMESTAMP;
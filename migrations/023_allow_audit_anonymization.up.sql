@@ -0,0 +1,17 @@
+-- Allow erasing personal data of deleted accounts from audit_events.
+-- The purge sets audit.anonymize for its transaction; even then only ip_address,
+-- user_agent and metadata may change, the event itself and deletes stay forbidden
+CREATE OR REPLACE FUNCTION audit_events_append_only() RETURNS trigger AS $$
+BEGIN
+    IF TG_OP = 'UPDATE' AND current_setting('audit.anonymize', true) = 'on'
+        AND NEW.id = OLD.id
+        AND NEW.type = OLD.type
+        AND NEW.user_id IS NOT DISTINCT FROM OLD.user_id
+        AND NEW.actor_id IS NOT DISTINCT FROM OLD.actor_id
+        AND NEW.request_id = OLD.request_id
+        AND NEW.created_at = OLD.created_at THEN
+        RETURN NEW;
+    END IF;
+    RAISE EXCEPTION 'audit_events is append-only';
+END;
+$$ LANGUAGE plpgsql;
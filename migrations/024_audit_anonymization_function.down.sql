@@ -0,0 +1,23 @@
+-- Return to the audit.anonymize setting checked by the trigger
+CREATE OR REPLACE FUNCTION audit_events_append_only() RETURNS trigger AS $$
+BEGIN
+    IF TG_OP = 'UPDATE' AND current_setting('audit.anonymize', true) = 'on'
+        AND NEW.id = OLD.id
+        AND NEW.type = OLD.type
+        AND NEW.user_id IS NOT DISTINCT FROM OLD.user_id
+        AND NEW.actor_id IS NOT DISTINCT FROM OLD.actor_id
+        AND NEW.request_id = OLD.request_id
+        AND NEW.created_at = OLD.created_at THEN
+        RETURN NEW;
+    END IF;
+    RAISE EXCEPTION 'audit_events is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+GRANT UPDATE, DELETE, TRUNCATE ON audit_events TO CURRENT_USER;
+
+DROP FUNCTION IF EXISTS anonymize_audit_events(INTEGER, TEXT);
+
+REVOKE ALL ON audit_events FROM audit_anonymizer;
+REVOKE USAGE ON SCHEMA public FROM audit_anonymizer;
+DROP ROLE IF EXISTS audit_anonymizer;
@@ -0,0 +1,59 @@
+-- Anonymization of audit_events goes through a single SECURITY DEFINER function
+-- owned by a dedicated role. The application role loses UPDATE and DELETE on the
+-- journal, and the trigger trusts only the function owner instead of a session
+-- setting any connection could set
+DO $$
+BEGIN
+    IF NOT EXISTS (SELECT 1 FROM pg_roles WHERE rolname = 'audit_anonymizer') THEN
+        CREATE ROLE audit_anonymizer NOLOGIN;
+    END IF;
+END
+$$;
+
+GRANT USAGE ON SCHEMA public TO audit_anonymizer;
+GRANT SELECT, UPDATE ON audit_events TO audit_anonymizer;
+
+CREATE FUNCTION anonymize_audit_events(p_user_id INTEGER, p_email TEXT) RETURNS void
+    LANGUAGE plpgsql
+    SECURITY DEFINER
+    SET search_path = public, pg_temp
+AS $$
+BEGIN
+    -- Events of the account itself: network data and addresses in metadata
+    UPDATE audit_events
+    SET ip_address = '', user_agent = '', metadata = NULLIF(metadata - 'email' - 'new_email' - 'name', '{}'::jsonb)
+    WHERE user_id = p_user_id;
+
+    -- Actions the account performed on others
+    UPDATE audit_events
+    SET ip_address = '', user_agent = ''
+    WHERE actor_id = p_user_id AND user_id IS DISTINCT FROM p_user_id;
+
+    -- Failed logins for unknown or blocked addresses are stored without user_id
+    UPDATE audit_events
+    SET ip_address = '', user_agent = '', metadata = NULLIF(metadata - 'email', '{}'::jsonb)
+    WHERE user_id IS NULL AND LOWER(metadata->>'email') = LOWER(p_email);
+END;
+$$;
+
+ALTER FUNCTION anonymize_audit_events(INTEGER, TEXT) OWNER TO audit_anonymizer;
+REVOKE ALL ON FUNCTION anonymize_audit_events(INTEGER, TEXT) FROM PUBLIC;
+GRANT EXECUTE ON FUNCTION anonymize_audit_events(INTEGER, TEXT) TO CURRENT_USER;
+
+REVOKE UPDATE, DELETE, TRUNCATE ON audit_events FROM PUBLIC, CURRENT_USER;
+
+-- Only the function owner may update, and only ip_address, user_agent and metadata
+CREATE OR REPLACE FUNCTION audit_events_append_only() RETURNS trigger AS $$
+BEGIN
+    IF TG_OP = 'UPDATE' AND current_user = 'audit_anonymizer'
+        AND NEW.id = OLD.id
+        AND NEW.type = OLD.type
+        AND NEW.user_id IS NOT DISTINCT FROM OLD.user_id
+        AND NEW.actor_id IS NOT DISTINCT FROM OLD.actor_id
+        AND NEW.request_id = OLD.request_id
+        AND NEW.created_at = OLD.created_at THEN
+        RETURN NEW;
+    END IF;
+    RAISE EXCEPTION 'audit_events is append-only';
+END;
+$$ LANGUAGE plpgsql;
@@ -0,0 +1,14 @@
+-- Create account_deletion_tokens table: emailed confirmation of account deletion
+-- for accounts that have no password to confirm it with
+CREATE TABLE account_deletion_tokens (
+                                         id SERIAL PRIMARY KEY,
+                                         user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+                                         token_hash VARCHAR(64) NOT NULL,
+                                         expires_at TIMESTAMP NOT NULL,
+                                         used_at TIMESTAMP,
+                                         created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Indexes for account deletion tokens
+CREATE UNIQUE INDEX idx_account_deletion_tokens_token_hash ON account_deletion_tokens(token_hash);
+CREATE INDEX idx_account_deletion_tokens_user_id ON account_deletion_tokens(user_id);